@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jdpolicano/govault/internal/audit"
+)
+
+// auditCommand runs the audit subcommands and returns the exit code.
+func auditCommand(args []string) int {
+	if len(args) < 1 || args[0] != "verify" {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	flags := flag.NewFlagSet("audit verify", flag.ContinueOnError)
+	partial := flags.Bool("partial", false, "accept a log whose oldest events were rotated away")
+	keyFile := flags.String("key", audit.DefaultChainKeyPath(), "the chain key file the server audited with")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	key, err := os.ReadFile(*keyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reading chain key:", err)
+		return 1
+	}
+
+	// rotated files are given oldest first and verified as one continuous chain.
+	readers := make([]io.Reader, 0, flags.NArg())
+	for _, path := range flags.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+
+	verify := audit.Verify
+	if *partial {
+		verify = audit.VerifyPartial
+	}
+	res, err := verify(io.MultiReader(readers...), key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "verification failed after %d events: %s\n", res.Events, err)
+		return 1
+	}
+	fmt.Printf("ok: %d events verified, last hash %s\n", res.Events, res.LastHash)
+	return 0
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/jdpolicano/govault/internal/server/routes/file"
+)
+
+// putFileCommand uploads a file as a binary secret, keeping its permissions.
+func putFileCommand(args []string) int {
+	flags := flag.NewFlagSet("put-file", flag.ContinueOnError)
+	addr := flags.String("addr", defaultAddr, "the server's address")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	key, path := flags.Arg(0), flags.Arg(1)
+	token, ok := sessionToken()
+	if !ok {
+		return 2
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	query := url.Values{"key": {key}, "mode": {fmt.Sprintf("%04o", info.Mode().Perm())}}
+	req, err := http.NewRequest("POST", *addr+"/file/put?"+query.Encode(), f)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// getFileCommand downloads a binary secret to a file, or to stdout for "-",
+// creating the file with the permissions it was uploaded with.
+func getFileCommand(args []string) int {
+	flags := flag.NewFlagSet("get-file", flag.ContinueOnError)
+	addr := flags.String("addr", defaultAddr, "the server's address")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	key, path := flags.Arg(0), flags.Arg(1)
+	token, ok := sessionToken()
+	if !ok {
+		return 2
+	}
+
+	req, err := http.NewRequest("GET", *addr+"/file/get?"+url.Values{"key": {key}}.Encode(), nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if path == "-" {
+		if _, err := io.Copy(os.Stdout, res.Body); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	// files without a recorded mode are kept private, as secrets.
+	mode := fs.FileMode(0600)
+	if v := res.Header.Get(file.ModeHeader); v != "" {
+		if m, err := strconv.ParseUint(v, 8, 32); err == nil {
+			mode = fs.FileMode(m).Perm()
+		}
+	}
+	if err := writeFile(path, res.Body, mode); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// writeFile replaces the file at path with the contents of r and gives it mode,
+// whether or not it existed before. The contents go to a temporary file first,
+// so a download that is cut short leaves the old file as it was.
+func writeFile(path string, r io.Reader, mode fs.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err == nil {
+		err = f.Chmod(mode)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// responseError returns the error of a failed response, which the server sends
+// as json.
+func responseError(res *http.Response) error {
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+	var envelope struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&envelope); err != nil || envelope.Error == "" {
+		return fmt.Errorf("%s", res.Status)
+	}
+	return fmt.Errorf("%s: %s", res.Status, envelope.Error)
+}
+
+func sessionToken() (string, bool) {
+	token := os.Getenv("GOVAULT_TOKEN")
+	if token == "" {
+		fmt.Fprintln(os.Stderr, "GOVAULT_TOKEN must hold a token")
+		return "", false
+	}
+	return token, true
+}
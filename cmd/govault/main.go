@@ -1,3 +1,57 @@
 package main
 
-func main() {}
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `usage: govault <command> [arguments]
+
+commands:
+  audit verify [-partial] [-key file] <file>...
+                                     check the hash chain of an audit log under
+                                     the server's chain key, rotated files
+                                     given oldest first
+  operator init [-config file] [-vault path] [-shares n -threshold t]
+                                     create the keyring and print the key shares,
+                                     enrolling the config file's key provider
+  operator unseal [-addr url]         submit a key share read from stdin
+  operator seal [-addr url]           seal the server, using the admin token
+                                     in GOVAULT_TOKEN
+  operator rekey [-addr url] [-shares n -threshold t]
+                                     replace the key shares, using the admin
+                                     token in GOVAULT_TOKEN and the current
+                                     key shares read from stdin
+  put-file [-addr url] <key> <file>   store a file as a binary secret along with
+                                     its permissions, using the token in
+                                     GOVAULT_TOKEN
+  get-file [-addr url] <key> <file>   write a binary secret to a file, or to
+                                     stdout for -, with the permissions it was
+                                     stored with
+  transit serve [-listen addr] [-key file]
+                                     run a local transit service for the
+                                     transit key provider, authenticating with
+                                     GOVAULT_TRANSIT_TOKEN
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	switch os.Args[1] {
+	case "audit":
+		os.Exit(auditCommand(os.Args[2:]))
+	case "transit":
+		os.Exit(transitCommand(os.Args[2:]))
+	case "operator":
+		os.Exit(operatorCommand(os.Args[2:]))
+	case "put-file":
+		os.Exit(putFileCommand(os.Args[2:]))
+	case "get-file":
+		os.Exit(getFileCommand(os.Args[2:]))
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/jdpolicano/govault/internal/server"
+	"github.com/jdpolicano/govault/internal/server/routes/sys"
+)
+
+const defaultAddr = "http://localhost:8080"
+
+// operatorCommand runs the operator subcommands and returns the exit code.
+func operatorCommand(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	switch args[0] {
+	case "init":
+		return operatorInit(args[1:])
+	case "unseal":
+		return operatorUnseal(args[1:])
+	case "seal":
+		return operatorSeal(args[1:])
+	case "rekey":
+		return operatorRekey(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+}
+
+// operatorInit creates the keyring on disk and prints the key shares once. With
+// a config file naming a key provider, the barrier key is also wrapped by it so
+// the server unseals itself.
+func operatorInit(args []string) int {
+	flags := flag.NewFlagSet("operator init", flag.ContinueOnError)
+	configFile := flags.String("config", "", "the server's json config file")
+	path := flags.String("vault", "", "the server's vault path, overriding the config file")
+	shares := flags.Int("shares", 1, "key shares to split the unseal key into")
+	threshold := flags.Int("threshold", 1, "key shares needed to unseal")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	config := server.DefaultConfig()
+	if *configFile != "" {
+		if err := server.LoadConfigFile(*configFile, config); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if *path != "" {
+		config.VaultPath = *path
+	}
+	provider, err := server.NewKeyProvider(config.Seal)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	keys, err := server.InitVault(config, *shares, *threshold, provider)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if keys == nil {
+			return 1
+		}
+	}
+	if provider != nil {
+		fmt.Printf("the server will unseal itself with %s, the key shares below are for recovery.\n\n", provider.Name())
+	}
+	printShares(keys, *threshold)
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// operatorUnseal reads one key share from stdin and submits it to the server.
+func operatorUnseal(args []string) int {
+	flags := flag.NewFlagSet("operator unseal", flag.ContinueOnError)
+	addr := flags.String("addr", defaultAddr, "the server's address")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	key, err := readShare(bufio.NewReader(os.Stdin))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var status server.SealStatus
+	if err := call(*addr+"/v1/sys/unseal", "", sys.UnsealRequest{Key: key}, &status); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if status.Sealed {
+		fmt.Printf("sealed, %d of %d key shares submitted\n", status.Progress, status.Threshold)
+	} else {
+		fmt.Println("unsealed")
+	}
+	return 0
+}
+
+// operatorSeal seals the server using the admin token in GOVAULT_TOKEN.
+func operatorSeal(args []string) int {
+	flags := flag.NewFlagSet("operator seal", flag.ContinueOnError)
+	addr := flags.String("addr", defaultAddr, "the server's address")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	token, ok := adminToken()
+	if !ok {
+		return 2
+	}
+	if err := call(*addr+"/v1/sys/seal", token, nil, nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println("sealed")
+	return 0
+}
+
+// operatorRekey starts a rekey with the admin token in GOVAULT_TOKEN, then reads
+// current key shares from stdin until the server hands back the new set.
+func operatorRekey(args []string) int {
+	flags := flag.NewFlagSet("operator rekey", flag.ContinueOnError)
+	addr := flags.String("addr", defaultAddr, "the server's address")
+	shares := flags.Int("shares", 1, "key shares to split the new unseal key into")
+	threshold := flags.Int("threshold", 1, "new key shares needed to unseal")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	token, ok := adminToken()
+	if !ok {
+		return 2
+	}
+	var res sys.RekeyResponse
+	begin := sys.RekeyInitRequest{Shares: *shares, Threshold: *threshold}
+	if err := call(*addr+"/v1/sys/rekey/init", token, begin, &res); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	in := bufio.NewReader(os.Stdin)
+	for !res.Complete {
+		fmt.Fprintf(os.Stderr, "%d of %d current key shares submitted\n", res.Progress, res.Required)
+		key, err := readShare(in)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		update := sys.RekeyUpdateRequest{Nonce: res.Nonce, Key: key}
+		if err := call(*addr+"/v1/sys/rekey/update", "", update, &res); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	printShares(res.Keys, res.Threshold)
+	return 0
+}
+
+func printShares(keys [][]byte, threshold int) {
+	for i, key := range keys {
+		fmt.Printf("key share %d: %s\n", i+1, base64.StdEncoding.EncodeToString(key))
+	}
+	fmt.Printf("\n%d of these key shares are needed to unseal. store them apart and somewhere safe,\n", threshold)
+	fmt.Println("they are not kept by the server and cannot be recovered.")
+}
+
+func readShare(in *bufio.Reader) ([]byte, error) {
+	fmt.Fprint(os.Stderr, "key share: ")
+	line, err := in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(line))
+	if err != nil {
+		return nil, fmt.Errorf("key share is not valid base64")
+	}
+	return key, nil
+}
+
+func adminToken() (string, bool) {
+	token := os.Getenv("GOVAULT_TOKEN")
+	if token == "" {
+		fmt.Fprintln(os.Stderr, "GOVAULT_TOKEN must hold an admin token")
+		return "", false
+	}
+	return token, true
+}
+
+// call posts body as json and decodes the data of a successful response into out.
+func call(url, token string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	var envelope struct {
+		Data  json.RawMessage `json:"data"`
+		Error string          `json:"error"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("%s: %w", res.Status, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", res.Status, envelope.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/jdpolicano/govault/internal/audit"
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+// transitCommand runs a local transit service for the transit key provider to
+// call, standing in for a KMS during development.
+func transitCommand(args []string) int {
+	if len(args) < 1 || args[0] != "serve" {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	flags := flag.NewFlagSet("transit serve", flag.ContinueOnError)
+	listen := flags.String("listen", "localhost:8200", "the address to listen on")
+	keyFile := flags.String("key", "./.govault-transit/root.key", "the root key file, created if missing")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	root, err := audit.LoadOrCreateKey(*keyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	token := os.Getenv("GOVAULT_TRANSIT_TOKEN")
+	if token == "" {
+		fmt.Fprintln(os.Stderr, "warning: GOVAULT_TRANSIT_TOKEN is empty, requests will not be authenticated")
+	}
+	fmt.Fprintf(os.Stderr, "transit listening on %s\n", *listen)
+	if err := http.ListenAndServe(*listen, vault.TransitHandler(root, token)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -1,26 +1,174 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/jdpolicano/govault/internal/audit"
 	"github.com/jdpolicano/govault/internal/server"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+	"github.com/jdpolicano/govault/internal/server/routes/admin"
+	"github.com/jdpolicano/govault/internal/server/routes/approle"
+	"github.com/jdpolicano/govault/internal/server/routes/file"
 	"github.com/jdpolicano/govault/internal/server/routes/get"
+	"github.com/jdpolicano/govault/internal/server/routes/group"
 	"github.com/jdpolicano/govault/internal/server/routes/login"
+	"github.com/jdpolicano/govault/internal/server/routes/policy"
 	"github.com/jdpolicano/govault/internal/server/routes/register"
+	"github.com/jdpolicano/govault/internal/server/routes/secrets"
 	"github.com/jdpolicano/govault/internal/server/routes/set"
+	"github.com/jdpolicano/govault/internal/server/routes/sys"
+	"github.com/jdpolicano/govault/internal/server/routes/token"
+	"github.com/jdpolicano/govault/internal/server/routes/totp"
 )
 
 func main() {
 	config := server.DefaultConfig()
+	configFile := flag.String("config", "", "json config file, overridden by flags given on the command line")
+	flag.Func("admin", "a username allowed to use the admin api (repeatable)", func(u string) error {
+		config.Admins = append(config.Admins, u)
+		return nil
+	})
+	flag.Var(&config.Registration.Mode, "registration", "who may register: open, invite or disabled")
+	flag.Int64Var(&config.MaxSecretSize, "max-secret-size", config.MaxSecretSize, "the largest secret value accepted, in bytes")
+	flag.Int64Var(&config.MaxFileSize, "max-file-size", config.MaxFileSize, "the largest file accepted by /file/put, in bytes")
+	flag.IntVar(&config.KDF.Concurrency, "kdf-concurrency", config.KDF.Concurrency, "password key derivations allowed to run at once")
+	flag.IntVar(&config.KDF.QueueDepth, "kdf-queue-depth", config.KDF.QueueDepth, "requests allowed to wait for a key derivation before being turned away")
+	flag.DurationVar(&config.KDF.Timeout, "kdf-timeout", config.KDF.Timeout, "the longest a request waits for a key derivation")
+	flag.StringVar((*string)(&config.TOTP), "totp", string(config.TOTP), "two-factor policy: disabled, optional or required")
+	flag.StringVar(&config.Audit.File, "audit", filepath.Join(config.VaultPath, "audit.log"), "rotating audit log file, empty to disable")
+	flag.Func("audit-syslog", "ship audit events to syslog at network:address, e.g. unixgram:/dev/log or udp:localhost:514", func(v string) error {
+		network, addr, found := strings.Cut(v, ":")
+		if !found {
+			return fmt.Errorf("expected network:address")
+		}
+		config.Audit.SyslogNetwork, config.Audit.SyslogAddr = network, addr
+		return nil
+	})
+	flag.StringVar(&config.Audit.Socket, "audit-socket", "", "unix socket to stream audit events to as json lines")
+	flag.BoolVar(&config.Audit.FailClosed, "audit-fail-closed", false, "reject requests when no audit sink can record them")
+	auditHMAC := flag.Bool("audit-hmac", false, "record hmacs of secret names in the audit log instead of the names")
+	chainKey := flag.String("audit-chain-key", audit.DefaultChainKeyPath(), "file holding the key of the audit hash chain, created if missing; keep it apart from the log")
+	flag.StringVar(&config.Log.Format, "log-format", config.Log.Format, "log format: json or text")
+	flag.TextVar(&config.Log.Level, "log-level", config.Log.Level, "lowest level logged: debug, info, warn or error")
+	flag.Parse()
+	if *configFile != "" {
+		if err := server.LoadConfigFile(*configFile, config); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		config.Audit.File = filepath.Join(config.VaultPath, "audit.log")
+		// parse again so flags given on the command line win over the file.
+		flag.Parse()
+	}
+
+	if err := config.KDF.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if config.MetricsToken == "" {
+		config.MetricsToken = os.Getenv("GOVAULT_METRICS_TOKEN")
+	}
+
 	refs := server.NewServerRefs(config)
+	if *auditHMAC {
+		key, err := audit.LoadOrCreateKey(filepath.Join(config.VaultPath, "audit.key"))
+		if err != nil {
+			refs.Log.Error("loading audit hmac key", "err", err)
+			return
+		}
+		config.Audit.HMAC = key
+	}
+	if config.Audit.Enabled() {
+		if *chainKey == "" {
+			refs.Log.Error("auditing needs a chain key file, set -audit-chain-key")
+			return
+		}
+		if filepath.Dir(*chainKey) == filepath.Dir(config.Audit.File) {
+			refs.Log.Warn("the audit chain key is kept beside the audit log, anyone able to edit the log can rewrite its chain", "key", *chainKey)
+		}
+		key, err := audit.LoadOrCreateKey(*chainKey)
+		if err != nil {
+			refs.Log.Error("loading audit chain key", "err", err)
+			return
+		}
+		config.Audit.ChainKey = key
+	}
+	if err := refs.OpenAudit(); err != nil {
+		refs.Log.Error("opening audit sinks", "err", err)
+		return
+	}
+	if err := refs.AutoUnseal(); err != nil {
+		refs.Log.Error("auto-unseal failed, waiting for key shares", "err", err)
+	}
 	http.HandleFunc("/register", register.Handler(refs))
 	http.HandleFunc("/login", login.Handler(refs))
 	http.HandleFunc("/get", get.Handler(refs))
 	http.HandleFunc("/set", set.Handler(refs))
-	fmt.Println("listening on port 8080")
-	if e := http.ListenAndServe("localhost:8080", nil); e != nil {
-		fmt.Println(e)
+	http.HandleFunc("/patch", set.PatchHandler(refs))
+	http.HandleFunc("/file/put", file.UploadHandler(refs))
+	http.HandleFunc("/file/get", file.DownloadHandler(refs))
+	http.HandleFunc("/list", secrets.ListHandler(refs))
+	http.HandleFunc("/delete", secrets.DeleteHandler(refs))
+	http.HandleFunc("/move", secrets.MoveHandler(refs))
+	http.HandleFunc("/metadata", secrets.MetadataHandler(refs))
+	http.HandleFunc("/token", token.Handler(refs))
+	http.HandleFunc("/approle/create", approle.CreateHandler(refs))
+	http.HandleFunc("/approle/rotate", approle.RotateHandler(refs))
+	http.HandleFunc("/approle/revoke", approle.RevokeHandler(refs))
+	http.HandleFunc("/approle/list", approle.ListHandler(refs))
+	http.HandleFunc("/approle/login", approle.LoginHandler(refs))
+	http.HandleFunc("/group/create", group.CreateHandler(refs))
+	http.HandleFunc("/group/list", group.ListHandler(refs))
+	http.HandleFunc("/group/members/add", group.AddMemberHandler(refs))
+	http.HandleFunc("/group/members/remove", group.RemoveMemberHandler(refs))
+	http.HandleFunc("/group/get", group.GetHandler(refs))
+	http.HandleFunc("/group/set", group.SetHandler(refs))
+	http.HandleFunc("/totp/enroll", totp.EnrollHandler(refs))
+	http.HandleFunc("/totp/confirm", totp.ConfirmHandler(refs))
+	http.HandleFunc("/totp/disable", totp.DisableHandler(refs))
+	http.HandleFunc("/v1/admin/lockouts", admin.LockoutsHandler(refs))
+	http.HandleFunc("/v1/admin/lockouts/clear", admin.UnlockHandler(refs))
+	http.HandleFunc("/v1/admin/users", admin.UsersHandler(refs))
+	http.HandleFunc("/v1/admin/users/disable", admin.DisableUserHandler(refs))
+	http.HandleFunc("/v1/admin/users/enable", admin.EnableUserHandler(refs))
+	http.HandleFunc("/v1/admin/users/logout", admin.LogoutUserHandler(refs))
+	http.HandleFunc("/v1/admin/users/delete", admin.DeleteUserHandler(refs))
+	http.HandleFunc("/v1/admin/users/admin", admin.SetAdminHandler(refs))
+	http.HandleFunc("/v1/admin/registration", admin.RegistrationHandler(refs))
+	http.HandleFunc("/v1/admin/invites", admin.InvitesHandler(refs))
+	http.HandleFunc("/v1/admin/invites/create", admin.CreateInviteHandler(refs))
+	http.HandleFunc("/v1/admin/invites/revoke", admin.RevokeInviteHandler(refs))
+	http.HandleFunc("/v1/policy/list", policy.ListHandler(refs))
+	http.HandleFunc("/v1/policy/write", policy.WriteHandler(refs))
+	http.HandleFunc("/v1/policy/delete", policy.DeleteHandler(refs))
+	http.HandleFunc("/v1/policy/attach", policy.AttachHandler(refs))
+	http.HandleFunc("/v1/policy/explain", policy.ExplainHandler(refs))
+	http.HandleFunc("/metrics", sys.MetricsHandler(refs))
+	http.HandleFunc("/healthz", sys.HealthHandler(refs))
+	http.HandleFunc("/readyz", sys.ReadyHandler(refs))
+	http.HandleFunc("/v1/sys/status", sys.StatusHandler(refs))
+	http.HandleFunc("/v1/sys/seal-status", sys.SealStatusHandler(refs))
+	http.HandleFunc("/v1/sys/unseal", sys.UnsealHandler(refs))
+	http.HandleFunc("/v1/sys/seal", sys.SealHandler(refs))
+	http.HandleFunc("/v1/sys/rekey/init", sys.RekeyInitHandler(refs))
+	http.HandleFunc("/v1/sys/rekey/update", sys.RekeyUpdateHandler(refs))
+	handler := middleware.Chain(http.DefaultServeMux.ServeHTTP,
+		middleware.RequestID(),
+		middleware.Instrument(refs, http.DefaultServeMux),
+		middleware.RequireUnsealed(refs, "/healthz", "/readyz", "/metrics", "/v1/sys/"),
+	)
+	if status := refs.SealStatus(); !status.Initialized {
+		refs.Log.Warn("vault is not initialized, run govault operator init", "vault", config.VaultPath)
+	}
+	refs.Log.Info("listening", "addr", "localhost:8080", "sealed", refs.Barrier.Sealed())
+	if e := http.ListenAndServe("localhost:8080", handler); e != nil {
+		refs.Log.Error("server stopped", "err", e)
 		return
 	}
 }
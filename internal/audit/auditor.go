@@ -0,0 +1,196 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrNoSinkRecorded = errors.New("no audit sink could record the event")
+var ErrNoChainKey = errors.New("auditing needs a chain key")
+
+// Auditor stamps events into a hash chain keyed by the chain key and ships them
+// to every sink. Each sink
+// is written by a goroutine of its own, fed in chain order, so a slow sink holds up
+// neither the chain nor the other sinks.
+type Auditor struct {
+	sync.Mutex
+	key    []byte // the chain key
+	sinks  []*sinkWriter
+	seq    uint64 // the sequence number of the last event recorded
+	prev   string // the hash of the last event recorded
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// sinkQueue is how many events may wait for a sink before Record blocks on it.
+const sinkQueue = 64
+
+// sinkWriter ships the events queued for one sink and keeps track of how it did.
+type sinkWriter struct {
+	sink     Sink
+	queue    chan pendingEvent
+	failures atomic.Uint64
+	mu       sync.Mutex
+	lastErr  error // the outcome of the last write
+}
+
+// pendingEvent is an event waiting for a sink, with where to report the outcome.
+type pendingEvent struct {
+	ev   Event
+	done chan<- error
+}
+
+func (w *sinkWriter) run() {
+	for p := range w.queue {
+		err := w.sink.Write(p.ev)
+		w.mu.Lock()
+		w.lastErr = err
+		w.mu.Unlock()
+		if err != nil {
+			w.failures.Add(1)
+			err = fmt.Errorf("%s: %w", w.sink.Name(), err)
+		}
+		p.done <- err
+	}
+}
+
+func (w *sinkWriter) last() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lastErr
+}
+
+// NewAuditor creates an auditor chaining events under key and writing them to
+// sinks. The chain resumes from the last event of the first sink able to report
+// one.
+func NewAuditor(key []byte, sinks ...Sink) (*Auditor, error) {
+	if len(key) == 0 {
+		return nil, ErrNoChainKey
+	}
+	a := &Auditor{key: key}
+	for _, s := range sinks {
+		r, ok := s.(Resumer)
+		if !ok {
+			continue
+		}
+		last, err := r.Last()
+		if err != nil {
+			return nil, fmt.Errorf("resuming audit chain from %s: %w", s.Name(), err)
+		}
+		a.seq, a.prev = last.Seq, last.Hash
+		break
+	}
+	for _, s := range sinks {
+		w := &sinkWriter{sink: s, queue: make(chan pendingEvent, sinkQueue)}
+		a.sinks = append(a.sinks, w)
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			w.run()
+		}()
+	}
+	return a, nil
+}
+
+// Record stamps ev with its place in the chain and writes it to every sink. It
+// fails with ErrNoSinkRecorded only when every sink failed, or the auditor has
+// been closed; the event still takes its place in the chain so a sink recovering
+// later shows the gap.
+func (a *Auditor) Record(ev Event) (Event, error) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	done := make(chan error, len(a.sinks))
+
+	// only the stamping and queueing happen under the lock, which is what keeps
+	// every sink seeing the events in chain order.
+	a.Lock()
+	if a.closed {
+		a.Unlock()
+		return ev, fmt.Errorf("%w: the auditor is closed", ErrNoSinkRecorded)
+	}
+	ev.Seq = a.seq + 1
+	ev.Prev = a.prev
+	hash, err := ComputeHash(a.key, ev)
+	if err != nil {
+		a.Unlock()
+		return ev, err
+	}
+	ev.Hash = hash
+	a.seq, a.prev = ev.Seq, ev.Hash
+	for _, w := range a.sinks {
+		w.queue <- pendingEvent{ev: ev, done: done}
+	}
+	a.Unlock()
+
+	var errs []error
+	for range a.sinks {
+		if err := <-done; err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == len(a.sinks) && len(a.sinks) > 0 {
+		return ev, errors.Join(append([]error{ErrNoSinkRecorded}, errs...)...)
+	}
+	return ev, errors.Join(errs...)
+}
+
+// SinkStatus reports how a sink has been doing.
+type SinkStatus struct {
+	Name     string `json:"name"`
+	Failures uint64 `json:"failures"`
+	LastErr  string `json:"last_error,omitempty"`
+}
+
+// Status reports the failure counts and last outcome of every sink.
+func (a *Auditor) Status() []SinkStatus {
+	out := make([]SinkStatus, len(a.sinks))
+	for i, w := range a.sinks {
+		out[i] = SinkStatus{Name: w.sink.Name(), Failures: w.failures.Load()}
+		if err := w.last(); err != nil {
+			out[i].LastErr = err.Error()
+		}
+	}
+	return out
+}
+
+// Healthy returns an error when the last write to every sink failed, the same
+// condition under which Record reports ErrNoSinkRecorded.
+func (a *Auditor) Healthy() error {
+	if len(a.sinks) == 0 {
+		return nil
+	}
+	errs := []error{ErrNoSinkRecorded}
+	for _, w := range a.sinks {
+		err := w.last()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", w.sink.Name(), err))
+	}
+	return errors.Join(errs...)
+}
+
+// Close waits for the queued events to be written and closes every sink.
+func (a *Auditor) Close() error {
+	a.Lock()
+	if a.closed {
+		a.Unlock()
+		return nil
+	}
+	a.closed = true
+	for _, w := range a.sinks {
+		close(w.queue)
+	}
+	a.Unlock()
+	a.wg.Wait()
+
+	var errs []error
+	for _, w := range a.sinks {
+		errs = append(errs, w.sink.Close())
+	}
+	return errors.Join(errs...)
+}
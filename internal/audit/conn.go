@@ -0,0 +1,51 @@
+package audit
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// writeTimeout bounds how long a network sink may stall a request.
+const writeTimeout = 2 * time.Second
+
+// redialConn is a lazily dialed connection that is re-established once when a
+// write fails, so a restarted collector doesn't need the server restarted too.
+type redialConn struct {
+	sync.Mutex
+	network string
+	addr    string
+	conn    net.Conn
+}
+
+func (c *redialConn) send(b []byte) error {
+	c.Lock()
+	defer c.Unlock()
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if c.conn == nil {
+			c.conn, err = net.DialTimeout(c.network, c.addr, writeTimeout)
+			if err != nil {
+				continue
+			}
+		}
+		c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err = c.conn.Write(b); err == nil {
+			return nil
+		}
+		c.conn.Close()
+		c.conn = nil
+	}
+	return err
+}
+
+func (c *redialConn) close() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
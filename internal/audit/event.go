@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PhaseRequest marks an event written before an operation runs.
+const PhaseRequest = "request"
+
+// Results recorded for an operation.
+const (
+	ResultSuccess = "success"
+	ResultDenied  = "denied" // the caller was not authenticated or not allowed
+	ResultFailure = "failure"
+	ResultPending = "pending" // the operation has not run yet
+)
+
+// Event records a single operation against the vault. Every event carries the
+// hash of the event before it, so removing or editing one breaks the chain. The
+// hashes are hmacs under a chain key kept apart from the log, since anyone able
+// to edit the log could otherwise just recompute them.
+type Event struct {
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Phase     string    `json:"phase,omitempty"` // "request" for the event written before a fail-closed operation runs
+	User      string    `json:"user,omitempty"`
+	Session   string    `json:"session,omitempty"` // the hash of the session token, never the token
+	Key       string    `json:"key,omitempty"`     // the secret name, or its hmac when names are hidden
+	Target    string    `json:"target,omitempty"`  // the account an admin operation acted on
+	RequestID string    `json:"request_id,omitempty"`
+	Client    string    `json:"client"`
+	Status    int       `json:"status"`
+	Result    string    `json:"result"`
+	Prev      string    `json:"prev"` // the hash of the previous event
+	Hash      string    `json:"hash"` // the hmac of this event including prev
+}
+
+// ResultFor classifies an http status code.
+func ResultFor(status int) string {
+	switch {
+	case status == 401 || status == 403 || status == 429:
+		return ResultDenied
+	case status >= 400:
+		return ResultFailure
+	default:
+		return ResultSuccess
+	}
+}
+
+// ComputeHash returns the chain hash of ev under key, which covers every field
+// but Hash.
+func ComputeHash(key []byte, ev Event) (string, error) {
+	ev.Hash = ""
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// DefaultChainKeyPath is where the chain key is kept unless configured
+// otherwise: under the user's config directory, away from the vault path and the
+// log. It is empty when there is no such directory.
+func DefaultChainKeyPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "govault", "audit-chain.key")
+}
+
+// LoadOrCreateKey reads the hmac key at path, generating and saving a new random
+// one the first time.
+func LoadOrCreateKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err == nil {
+		return key, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	return key, os.WriteFile(path, key, 0600)
+}
+
+// HMACKey hides a secret name behind a keyed hash, so the log can show that the
+// same secret was touched twice without revealing its name.
+func HMACKey(key []byte, name string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,139 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileSink appends events to a file as newline delimited json, rotating it to
+// path.1, path.2 and so on once it grows past a size limit.
+type FileSink struct {
+	sync.Mutex
+	path     string
+	maxBytes int64 // rotate once the file reaches this size, zero never rotates
+	maxFiles int   // rotated files to keep
+	file     *os.File
+	size     int64
+}
+
+// NewFileSink opens the log at path, creating it if needed.
+func NewFileSink(path string, maxBytes int64, maxFiles int) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	fs := &FileSink{path: path, maxBytes: maxBytes, maxFiles: maxFiles}
+	if err := fs.open(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *FileSink) Name() string {
+	return "file:" + fs.path
+}
+
+func (fs *FileSink) Write(ev Event) error {
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	fs.Lock()
+	defer fs.Unlock()
+	if fs.maxBytes > 0 && fs.size > 0 && fs.size+int64(len(line)) > fs.maxBytes {
+		if err := fs.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := fs.file.Write(line)
+	fs.size += int64(n)
+	return err
+}
+
+// Last returns the final event in the current file, or in the most recent rotated
+// file when the current one is empty.
+func (fs *FileSink) Last() (Event, error) {
+	fs.Lock()
+	defer fs.Unlock()
+	last, err := lastEvent(fs.path)
+	if err != nil || last.Seq != 0 || fs.maxFiles == 0 {
+		return last, err
+	}
+	last, err = lastEvent(rotatedName(fs.path, 1))
+	if os.IsNotExist(err) {
+		return last, nil
+	}
+	return last, err
+}
+
+func (fs *FileSink) Close() error {
+	fs.Lock()
+	defer fs.Unlock()
+	return fs.file.Close()
+}
+
+func (fs *FileSink) open() error {
+	f, err := os.OpenFile(fs.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	fs.file, fs.size = f, info.Size()
+	return nil
+}
+
+// rotate shifts path.N to path.N+1, dropping the oldest, and starts a new file.
+func (fs *FileSink) rotate() error {
+	if err := fs.file.Close(); err != nil {
+		return err
+	}
+	if fs.maxFiles > 0 {
+		os.Remove(rotatedName(fs.path, fs.maxFiles))
+		for i := fs.maxFiles - 1; i >= 1; i-- {
+			os.Rename(rotatedName(fs.path, i), rotatedName(fs.path, i+1))
+		}
+		if err := os.Rename(fs.path, rotatedName(fs.path, 1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(fs.path); err != nil {
+		return err
+	}
+	return fs.open()
+}
+
+func rotatedName(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// lastEvent returns the final event in the file at path, or the zero Event for an
+// empty file.
+func lastEvent(path string) (Event, error) {
+	var last Event
+	f, err := os.Open(path)
+	if err != nil {
+		return last, err
+	}
+	defer f.Close()
+	var line []byte
+	scanner := newEventScanner(f)
+	for scanner.Scan() {
+		line = append(line[:0], scanner.Bytes()...)
+	}
+	if err := scanner.Err(); err != nil && err != io.EOF {
+		return last, err
+	}
+	if len(line) == 0 {
+		return last, nil
+	}
+	err = json.Unmarshal(line, &last)
+	return last, err
+}
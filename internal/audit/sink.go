@@ -0,0 +1,14 @@
+package audit
+
+// Sink is a destination audit events are shipped to.
+type Sink interface {
+	Name() string         // identifies the sink in logs and metrics
+	Write(ev Event) error // deliver a single event
+	Close() error
+}
+
+// Resumer is implemented by sinks that keep the events they were sent and can
+// report the last one, so the hash chain survives a restart.
+type Resumer interface {
+	Last() (Event, error)
+}
@@ -0,0 +1,29 @@
+package audit
+
+import "encoding/json"
+
+// SocketSink streams events as newline delimited json to a unix socket, for a
+// local shipper to forward.
+type SocketSink struct {
+	conn *redialConn
+}
+
+func NewSocketSink(path string) *SocketSink {
+	return &SocketSink{&redialConn{network: "unix", addr: path}}
+}
+
+func (s *SocketSink) Name() string {
+	return "socket:" + s.conn.addr
+}
+
+func (s *SocketSink) Write(ev Event) error {
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return s.conn.send(append(line, '\n'))
+}
+
+func (s *SocketSink) Close() error {
+	return s.conn.close()
+}
@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// facilityAuthPriv is the syslog facility for security and authorization messages.
+const facilityAuthPriv = 10
+
+// Syslog severities used for audit results.
+const (
+	severityWarning = 4
+	severityNotice  = 5
+	severityInfo    = 6
+)
+
+// SyslogSink sends events as RFC 5424 messages over a local datagram socket,
+// either "unixgram" (such as /dev/log) or "udp". The message body is the event json.
+type SyslogSink struct {
+	conn     *redialConn
+	hostname string
+	appName  string
+	pid      int
+}
+
+func NewSyslogSink(network, addr, appName string) *SyslogSink {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &SyslogSink{
+		conn:     &redialConn{network: network, addr: addr},
+		hostname: hostname,
+		appName:  appName,
+		pid:      os.Getpid(),
+	}
+}
+
+func (s *SyslogSink) Name() string {
+	return "syslog:" + s.conn.network + ":" + s.conn.addr
+}
+
+func (s *SyslogSink) Write(ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return s.conn.send(s.format(ev, body))
+}
+
+func (s *SyslogSink) Close() error {
+	return s.conn.close()
+}
+
+// format renders an RFC 5424 message:
+// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (s *SyslogSink) format(ev Event, body []byte) []byte {
+	pri := facilityAuthPriv*8 + severityFor(ev.Result)
+	ts := ev.Time.UTC().Format(time.RFC3339Nano)
+	header := fmt.Sprintf("<%d>1 %s %s %s %d audit - ", pri, ts, s.hostname, s.appName, s.pid)
+	return append([]byte(header), body...)
+}
+
+func severityFor(result string) int {
+	switch result {
+	case ResultFailure:
+		return severityWarning
+	case ResultDenied:
+		return severityNotice
+	default:
+		return severityInfo
+	}
+}
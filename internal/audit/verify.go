@@ -0,0 +1,73 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// VerifyResult summarizes a verified log.
+type VerifyResult struct {
+	Events   uint64 // the number of events checked
+	FirstSeq uint64 // the sequence number of the first event
+	LastHash string // the hash of the final event, worth recording elsewhere to detect truncation
+}
+
+// Verify walks the events in r and checks that every event hashes correctly
+// under the chain key, links to the one before it and follows it in sequence.
+// The log must start at the first event ever written.
+func Verify(r io.Reader, key []byte) (VerifyResult, error) {
+	return verify(r, key, true)
+}
+
+// VerifyPartial is Verify for logs whose oldest events have been rotated away,
+// so the first event may link to one that is no longer present.
+func VerifyPartial(r io.Reader, key []byte) (VerifyResult, error) {
+	return verify(r, key, false)
+}
+
+func verify(r io.Reader, key []byte, fromStart bool) (VerifyResult, error) {
+	var res VerifyResult
+	if len(key) == 0 {
+		return res, ErrNoChainKey
+	}
+	var prev Event
+	scanner := newEventScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var ev Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return res, fmt.Errorf("line %d: malformed event: %w", line, err)
+		}
+		want, err := ComputeHash(key, ev)
+		if err != nil {
+			return res, fmt.Errorf("line %d: %w", line, err)
+		}
+		if ev.Hash != want {
+			return res, fmt.Errorf("line %d: event %d has been altered", line, ev.Seq)
+		}
+		if line == 1 {
+			if fromStart && (ev.Seq != 1 || ev.Prev != "") {
+				return res, fmt.Errorf("line %d: log starts at event %d, earlier events are missing", line, ev.Seq)
+			}
+			res.FirstSeq = ev.Seq
+		}
+		if line > 1 && (ev.Prev != prev.Hash || ev.Seq != prev.Seq+1) {
+			return res, fmt.Errorf("line %d: chain broken between events %d and %d", line, prev.Seq, ev.Seq)
+		}
+		prev = ev
+		res.Events++
+		res.LastHash = ev.Hash
+	}
+	return res, scanner.Err()
+}
+
+// newEventScanner splits r into lines, allowing for events larger than the
+// default scanner buffer.
+func newEventScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return scanner
+}
@@ -0,0 +1,269 @@
+// Package metrics implements the small subset of Prometheus instrumentation the
+// server needs, rendered in the text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets suit request latencies measured in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// KDFBuckets suit password key derivations, which take hundreds of milliseconds.
+var KDFBuckets = []float64{.1, .25, .5, .75, 1, 1.5, 2, 3, 5, 10}
+
+// Sample is a single labelled value reported by a function collector.
+type Sample struct {
+	Labels []string // label values, in the order of the collector's label names
+	Value  float64
+}
+
+// collector is anything the registry can render.
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds the metrics exposed on /metrics.
+type Registry struct {
+	sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.Lock()
+	defer r.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Counter registers a counter partitioned by labels.
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{name, help, labels}, values: make(map[string]*counterValue)}
+	r.register(c)
+	return c
+}
+
+// Histogram registers a histogram partitioned by labels.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{desc: desc{name, help, labels}, buckets: buckets, values: make(map[string]*histogramValue)}
+	r.register(h)
+	return h
+}
+
+// GaugeFunc registers a gauge whose value is read from fn at scrape time.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(&funcCollector{desc{name, help, nil}, "gauge", func() []Sample {
+		return []Sample{{Value: fn()}}
+	}})
+}
+
+// CounterFunc registers a counter whose labelled values are read from fn at
+// scrape time, for counts kept elsewhere.
+func (r *Registry) CounterFunc(name, help string, labels []string, fn func() []Sample) {
+	r.register(&funcCollector{desc{name, help, labels}, "counter", fn})
+}
+
+// Expose renders every metric in the text exposition format.
+func (r *Registry) Expose(w io.Writer) {
+	r.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.Unlock()
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler serves the registry for Prometheus to scrape.
+func (r *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Expose(w)
+	}
+}
+
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (d desc) header(w io.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, typ)
+}
+
+// labelKey joins label values into a map key.
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// formatLabels renders {name="value",...}, with extra appended as-is.
+func (d desc) formatLabels(values []string, extra string) string {
+	parts := make([]string, 0, len(values)+1)
+	for i, v := range values {
+		if i < len(d.labels) {
+			parts = append(parts, d.labels[i]+`="`+escapeLabel(v)+`"`)
+		}
+	}
+	if extra != "" {
+		parts = append(parts, extra)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func (d desc) checkLabels(values []string) {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+}
+
+// CounterVec is a monotonically increasing count partitioned by labels.
+type CounterVec struct {
+	desc
+	sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	value  float64
+}
+
+// Inc adds one to the counter with the given label values.
+func (c *CounterVec) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Add adds v to the counter with the given label values.
+func (c *CounterVec) Add(v float64, labels ...string) {
+	c.checkLabels(labels)
+	c.Lock()
+	defer c.Unlock()
+	key := labelKey(labels)
+	cv, ok := c.values[key]
+	if !ok {
+		cv = &counterValue{labels: append([]string(nil), labels...)}
+		c.values[key] = cv
+	}
+	cv.value += v
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.Lock()
+	defer c.Unlock()
+	c.header(w, "counter")
+	for _, key := range sortedKeys(c.values) {
+		cv := c.values[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.formatLabels(cv.labels, ""), formatFloat(cv.value))
+	}
+}
+
+// HistogramVec counts observations into cumulative buckets, partitioned by labels.
+type HistogramVec struct {
+	desc
+	sync.Mutex
+	buckets []float64
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// Observe records v against the histogram with the given label values.
+func (h *HistogramVec) Observe(v float64, labels ...string) {
+	h.checkLabels(labels)
+	h.Lock()
+	defer h.Unlock()
+	key := labelKey(labels)
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogramValue{labels: append([]string(nil), labels...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			hv.counts[i]++
+			break
+		}
+	}
+	hv.count++
+	hv.sum += v
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.Lock()
+	defer h.Unlock()
+	h.header(w, "histogram")
+	for _, key := range sortedKeys(h.values) {
+		hv := h.values[key]
+		var cumulative uint64
+		for i, b := range h.buckets {
+			cumulative += hv.counts[i]
+			le := `le="` + formatFloat(b) + `"`
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.formatLabels(hv.labels, le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.formatLabels(hv.labels, `le="+Inf"`), hv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.formatLabels(hv.labels, ""), formatFloat(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.formatLabels(hv.labels, ""), hv.count)
+	}
+}
+
+// funcCollector reads its samples from a function at scrape time.
+type funcCollector struct {
+	desc
+	typ string
+	fn  func() []Sample
+}
+
+func (f *funcCollector) write(w io.Writer) {
+	f.header(w, f.typ)
+	for _, s := range f.fn() {
+		fmt.Fprintf(w, "%s%s %s\n", f.name, f.formatLabels(s.Labels, ""), formatFloat(s.Value))
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a label value the way the exposition format expects.
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(strings.ToValidUTF8(s, "\uFFFD"))
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/netip"
+	"time"
+
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/store"
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+// roleKeyInfo binds keys derived from a secret id to their use for wrapping vault keys.
+const roleKeyInfo = "govault approle wrap"
+
+// RoleCredentials are handed to the owner once, when a role is issued or rotated.
+// The secret id is never stored and cannot be recovered afterwards.
+type RoleCredentials struct {
+	RoleID   string `json:"role_id"`
+	SecretID string `json:"secret_id"`
+}
+
+// NewRole issues a machine identity that can access the owner's vault with at
+// most scope. Logins are only accepted from cidrs when any are given.
+func NewRole(owner Session, scope Scope, cidrs []string, ttl time.Duration) (store.Role, RoleCredentials, error) {
+	var none store.Role
+	scope, err := owner.Scope.Narrow(scope)
+	if err != nil {
+		return none, RoleCredentials{}, err
+	}
+	if err := validateCIDRs(cidrs); err != nil {
+		return none, RoleCredentials{}, err
+	}
+	id, err := vault.GenerateRandBytes(16)
+	if err != nil {
+		return none, RoleCredentials{}, err
+	}
+	role := store.Role{
+		ID:       hex.EncodeToString(id),
+		Owner:    owner.User,
+		CIDRs:    cidrs,
+		Paths:    scope.Paths,
+		ReadOnly: scope.ReadOnly,
+		TTL:      int64(ttl / time.Second),
+		Policies: scope.Policies,
+	}
+	return RotateRoleSecret(owner, role)
+}
+
+// RotateRoleSecret replaces the secret id of role, invalidating the previous one.
+func RotateRoleSecret(owner Session, role store.Role) (store.Role, RoleCredentials, error) {
+	secret, err := vault.GenerateRandBytes(32)
+	if err != nil {
+		return role, RoleCredentials{}, err
+	}
+	wrapKey, err := vault.DeriveSubkey(secret, roleKeyInfo)
+	if err != nil {
+		return role, RoleCredentials{}, err
+	}
+	cipher, nonce, err := vault.EncryptBytes(wrapKey, owner.Key)
+	if err != nil {
+		return role, RoleCredentials{}, err
+	}
+	hash := sha256.Sum256(secret)
+	role.SecretHash = hash[:]
+	role.WrappedKey = store.CipherText{Nonce: nonce, Text: cipher}
+	creds := RoleCredentials{role.ID, base64.RawURLEncoding.EncodeToString(secret)}
+	return role, creds, nil
+}
+
+// OpenRole checks secretID against role and the client address against its cidrs,
+// returning the owner's vault key when both pass.
+func OpenRole(role store.Role, secretID string, remoteAddr string) ([]byte, error) {
+	secret, err := base64.RawURLEncoding.DecodeString(secretID)
+	if err != nil {
+		return nil, e.IncorrectRoleCredentials
+	}
+	hash := sha256.Sum256(secret)
+	if subtle.ConstantTimeCompare(hash[:], role.SecretHash) != 1 {
+		return nil, e.IncorrectRoleCredentials
+	}
+	if !addressAllowed(role.CIDRs, remoteAddr) {
+		return nil, e.AddressNotAllowed
+	}
+	wrapKey, err := vault.DeriveSubkey(secret, roleKeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	return vault.Decrypt(role.WrappedKey.Nonce, wrapKey, role.WrappedKey.Text)
+}
+
+// RoleScope returns the scope sessions for role are restricted to.
+func RoleScope(role store.Role) Scope {
+	return Scope{Paths: role.Paths, ReadOnly: role.ReadOnly}
+}
+
+func validateCIDRs(cidrs []string) error {
+	for _, c := range cidrs {
+		if _, err := netip.ParsePrefix(c); err != nil {
+			return e.InvalidCIDR
+		}
+	}
+	return nil
+}
+
+// addressAllowed reports whether remoteAddr, as found on http.Request, falls
+// within one of cidrs. An empty list allows every address.
+func addressAllowed(cidrs []string, remoteAddr string) bool {
+	if len(cidrs) == 0 {
+		return true
+	}
+	addr, err := ClientAddr(remoteAddr)
+	if err != nil {
+		return false
+	}
+	for _, c := range cidrs {
+		prefix, err := netip.ParsePrefix(c)
+		if err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
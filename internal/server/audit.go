@@ -0,0 +1,48 @@
+package server
+
+import "net/http"
+
+// AuditRecord collects what the middleware and handlers learn about a request so
+// that it can be written to the audit log once the response is known.
+type AuditRecord struct {
+	User    string
+	Session string
+	Key     string
+	Target  string
+}
+
+// auditRecord returns the record for req, or nil when the route is not audited.
+func auditRecord(req *http.Request) *AuditRecord {
+	rec, _ := req.Context().Value(AuditKey{}).(*AuditRecord)
+	return rec
+}
+
+// NoteAuditUser records the user a request acts as, for routes that run before a
+// session exists such as login.
+func NoteAuditUser(req *http.Request, user string) {
+	if rec := auditRecord(req); rec != nil {
+		rec.User = user
+	}
+}
+
+// NoteAuditSession records the authenticated session of a request.
+func NoteAuditSession(req *http.Request, sess Session) {
+	if rec := auditRecord(req); rec != nil {
+		rec.User = sess.User
+		rec.Session = sess.ID
+	}
+}
+
+// NoteAuditKey records the secret a request addresses.
+func NoteAuditKey(req *http.Request, key string) {
+	if rec := auditRecord(req); rec != nil {
+		rec.Key = key
+	}
+}
+
+// NoteAuditTarget records the account an admin request acts on.
+func NoteAuditTarget(req *http.Request, user string) {
+	if rec := auditRecord(req); rec != nil {
+		rec.Target = user
+	}
+}
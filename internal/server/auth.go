@@ -3,6 +3,7 @@ package server
 import (
 	"encoding/json"
 	"net/http"
+	"net/netip"
 )
 
 type TokenSuccess struct {
@@ -12,6 +13,8 @@ type TokenSuccess struct {
 type AuthCredentials struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	OTP      string `json:"otp,omitempty"`    // a totp or recovery code for accounts with two-factor enabled
+	Invite   string `json:"invite,omitempty"` // an invite code, when registration is invite only
 }
 
 // validateRequest decodes and validates the request body.
@@ -27,3 +30,22 @@ func SendToken(w http.ResponseWriter, token string) {
 	res := TokenSuccess{Token: token}
 	JSONResponse(w, NewServerSuccess(res))
 }
+
+// ClientAddr parses the address portion of a request's RemoteAddr.
+func ClientAddr(remoteAddr string) (netip.Addr, error) {
+	if ap, err := netip.ParseAddrPort(remoteAddr); err == nil {
+		return ap.Addr().Unmap(), nil
+	}
+	addr, err := netip.ParseAddr(remoteAddr)
+	return addr.Unmap(), err
+}
+
+// RequestAddr returns the client address of req in canonical form, falling back
+// to the raw RemoteAddr when it cannot be parsed.
+func RequestAddr(req *http.Request) string {
+	addr, err := ClientAddr(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return addr.String()
+}
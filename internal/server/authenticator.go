@@ -0,0 +1,127 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	e "github.com/jdpolicano/govault/internal/server/errors"
+)
+
+// TokenPrefix is prepended to every session token handed out by the server.
+const TokenPrefix = "govault-"
+
+// authRealm is the realm advertised in WWW-Authenticate challenges.
+const authRealm = "govault"
+
+// AuthError describes why a request could not be authenticated. It carries the
+// HTTP status and the RFC 6750 error code the client should be challenged with.
+type AuthError struct {
+	Status int    // the http status to respond with
+	Code   string // the bearer error code, empty when no credentials were presented
+	Err    error  // the underlying reason
+}
+
+func (a *AuthError) Error() string {
+	return a.Err.Error()
+}
+
+func (a *AuthError) Unwrap() error {
+	return a.Err
+}
+
+// Challenge renders the WWW-Authenticate header value for this error.
+func (a *AuthError) Challenge() string {
+	if a.Code == "" {
+		return fmt.Sprintf("Bearer realm=%q", authRealm)
+	}
+	return fmt.Sprintf("Bearer realm=%q, error=%q, error_description=%q", authRealm, a.Code, a.Err.Error())
+}
+
+var (
+	errMissingToken   = &AuthError{http.StatusUnauthorized, "", e.MissingAuthorizationHeader}
+	errMalformedToken = &AuthError{http.StatusBadRequest, "invalid_request", e.MalformedAuthorizationHeader}
+	errUnknownToken   = &AuthError{http.StatusUnauthorized, "invalid_token", e.UnknownSession}
+	errExpiredToken   = &AuthError{http.StatusUnauthorized, "invalid_token", e.AuthorizationExpired}
+	errOutOfScope     = &AuthError{http.StatusForbidden, "insufficient_scope", e.InsufficientScope}
+)
+
+// Authenticator resolves bearer tokens on incoming requests to live sessions.
+type Authenticator struct {
+	sessions *SessionMap
+}
+
+func NewAuthenticator(sessions *SessionMap) *Authenticator {
+	return &Authenticator{sessions}
+}
+
+// Authenticate extracts the bearer token from the request and returns the session
+// it refers to. The returned error is always an *AuthError.
+func (a *Authenticator) Authenticate(r *http.Request) (Session, error) {
+	var none Session
+	token, err := ParseBearerToken(r.Header.Get("Authorization"))
+	if err != nil {
+		return none, err
+	}
+
+	sess, found := a.sessions.Get(token)
+	if !found || len(sess.User) == 0 || len(sess.Key) == 0 {
+		return none, errUnknownToken
+	}
+
+	if sess.Expired() {
+		a.sessions.Delete(token)
+		return none, errExpiredToken
+	}
+
+	return sess, nil
+}
+
+// Spend spends one use of a limited session once a request has been authorized.
+// The returned error is always an *AuthError.
+func (a *Authenticator) Spend(sess Session) error {
+	if sess.Uses > 0 && !a.sessions.Spend(sess) {
+		return errUnknownToken
+	}
+	return nil
+}
+
+// Authorize checks that the session's scope permits cap on key. The returned
+// error is always an *AuthError.
+func (a *Authenticator) Authorize(sess Session, cap Capability, key string) error {
+	if !sess.Scope.Allows(cap, key) {
+		return errOutOfScope
+	}
+	return nil
+}
+
+// ParseBearerToken pulls the session token out of an Authorization header value
+// of the form "Bearer govault-<token>". The token is returned as it was issued,
+// prefix included.
+func ParseBearerToken(header string) (string, error) {
+	if len(header) == 0 {
+		return "", errMissingToken
+	}
+
+	scheme, cred, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", errMalformedToken
+	}
+
+	token := strings.TrimSpace(cred)
+	rest, found := strings.CutPrefix(token, TokenPrefix)
+	if !found || len(rest) == 0 || strings.ContainsAny(rest, " \t") {
+		return "", errMalformedToken
+	}
+	return token, nil
+}
+
+// WriteAuthError responds to the client with the challenge and status for err.
+func WriteAuthError(w http.ResponseWriter, err error) {
+	authErr, ok := err.(*AuthError)
+	if !ok {
+		authErr = &AuthError{http.StatusUnauthorized, "invalid_token", err}
+	}
+	w.Header().Set("WWW-Authenticate", authErr.Challenge())
+	JSONResponse(w, NewResponse(authErr.Status, nil, authErr.Err))
+}
@@ -1,11 +1,95 @@
 package server
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"time"
+
+	e "github.com/jdpolicano/govault/internal/server/errors"
+)
 
 type ContextConfig struct {
-	DefaultTTL time.Duration
-	SaltSize   int
-	VaultPath  string
+	DefaultTTL    time.Duration
+	SaltSize      int
+	VaultPath     string
+	Lockout       LockoutPolicy
+	Admins        []string // users allowed to call the admin api
+	KDF           KDFConfig
+	TOTP          TOTPPolicy
+	Issuer        string // the issuer shown in authenticator apps
+	Audit         AuditConfig
+	Log           LogConfig
+	Seal          SealConfig
+	Registration  RegistrationConfig
+	MaxSecretSize int64  // the largest secret value accepted, in bytes
+	MaxFileSize   int64  // the largest file accepted by the file routes, which stream rather than hold it in memory
+	MetricsToken  string // bearer token scrapers present to /metrics, read from GOVAULT_METRICS_TOKEN when empty; /metrics is off without one
+}
+
+// RegistrationConfig decides who may create an account and what it may be called.
+type RegistrationConfig struct {
+	Mode      RegistrationMode
+	InviteTTL time.Duration // how long an invite lasts unless the admin minting it says otherwise
+	Reserved  []string      // names nobody may register, on top of the built in ones
+}
+
+// SealConfig chooses the key provider the vault unseals itself with at boot. The
+// vault waits for key shares when no provider is configured.
+type SealConfig struct {
+	Provider string        // "file", "transit" or empty
+	KeyFile  string        // the key file of the file provider
+	Transit  TransitConfig // the service used by the transit provider
+}
+
+// TransitConfig locates a transit service and the key it wraps the barrier key with.
+type TransitConfig struct {
+	Address string // base url, such as http://localhost:8200
+	Key     string // name of the wrapping key
+	Token   string // bearer token, read from GOVAULT_TRANSIT_TOKEN when empty
+}
+
+// AuditConfig chooses where audit events are shipped. Auditing is off when no sink
+// is configured.
+type AuditConfig struct {
+	File          string // path of a rotating log file
+	FileMaxBytes  int64  // rotate the file once it reaches this size, zero never rotates
+	FileMaxFiles  int    // rotated files to keep
+	SyslogNetwork string // "unixgram" or "udp"
+	SyslogAddr    string // such as /dev/log or localhost:514, empty disables syslog
+	Socket        string // a unix socket to stream newline delimited json to
+	FailClosed    bool   // reject requests that no sink can record
+	HMAC          []byte // when set, secret names are hmaced with this key before being audited
+	ChainKey      []byte // keys the hash chain of audit events, required once any sink is configured
+}
+
+// Enabled reports whether any sink is configured.
+func (a AuditConfig) Enabled() bool {
+	return a.File != "" || a.SyslogAddr != "" || a.Socket != ""
+}
+
+// KDFConfig bounds the password key derivations run for logins and registrations.
+type KDFConfig struct {
+	Concurrency int           // derivations allowed to run at once
+	QueueDepth  int           // requests allowed to wait for a free slot
+	Timeout     time.Duration // the longest a request waits before giving up
+}
+
+// Validate checks that k allows at least one derivation at a time and waits a
+// positive time for one.
+func (k KDFConfig) Validate() error {
+	switch {
+	case k.Concurrency < 1:
+		return errors.New("kdf concurrency must be at least 1")
+	case k.QueueDepth < 0:
+		return errors.New("kdf queue depth must not be negative")
+	case k.Timeout <= 0:
+		return errors.New("kdf timeout must be a positive duration")
+	}
+	return nil
 }
 
 func DefaultConfig() *ContextConfig {
@@ -13,5 +97,167 @@ func DefaultConfig() *ContextConfig {
 		DefaultTTL: time.Hour * 24,
 		SaltSize:   16,
 		VaultPath:  "./.govault",
+		Lockout: LockoutPolicy{
+			UserThreshold: 5,
+			AddrThreshold: 20,
+			BaseDelay:     time.Second,
+			MaxDelay:      time.Minute * 15,
+			Window:        time.Minute * 15,
+		},
+		KDF: KDFConfig{
+			Concurrency: max(runtime.NumCPU()/2, 1),
+			QueueDepth:  64,
+			Timeout:     time.Second * 10,
+		},
+		TOTP:   TOTPOptional,
+		Issuer: "govault",
+		Audit: AuditConfig{
+			FileMaxBytes:  64 << 20,
+			FileMaxFiles:  8,
+			SyslogNetwork: "unixgram",
+		},
+		Log:           LogConfig{Format: "json", Level: slog.LevelInfo},
+		Registration:  RegistrationConfig{Mode: RegistrationOpen, InviteTTL: time.Hour * 24 * 7},
+		MaxSecretSize: 1 << 20,
+		MaxFileSize:   256 << 20,
+	}
+}
+
+// CheckSecretSize returns e.SecretTooLarge for a secret value of more than
+// MaxSecretSize bytes.
+func (c *ContextConfig) CheckSecretSize(n int64) error {
+	if n > c.MaxSecretSize {
+		return e.SecretTooLarge
+	}
+	return nil
+}
+
+// MaxBodySize is the largest json request body accepted: room for a secret of
+// MaxSecretSize bytes escaped as a json string, and the request's other fields.
+func (c *ContextConfig) MaxBodySize() int64 {
+	return 2*c.MaxSecretSize + 64<<10
+}
+
+// IsAdmin reports whether user is configured as an administrator.
+func (c *ContextConfig) IsAdmin(user string) bool {
+	for _, a := range c.Admins {
+		if a == user {
+			return true
+		}
+	}
+	return false
+}
+
+// fileConfig is the json config file. Settings it leaves out keep their defaults.
+type fileConfig struct {
+	VaultPath *string     `json:"vaultPath"`
+	Admins    []string    `json:"admins"`
+	TOTP      *TOTPPolicy `json:"totp"`
+	Issuer    *string     `json:"issuer"`
+	Seal      *struct {
+		Provider string `json:"provider"`
+		KeyFile  string `json:"keyFile"`
+		Transit  struct {
+			Address string `json:"address"`
+			Key     string `json:"key"`
+			Token   string `json:"token"`
+		} `json:"transit"`
+	} `json:"seal"`
+	MaxSecretSize *int64  `json:"maxSecretSize"`
+	MaxFileSize   *int64  `json:"maxFileSize"`
+	MetricsToken  *string `json:"metricsToken"`
+	KDF           *struct {
+		Concurrency *int   `json:"concurrency"`
+		QueueDepth  *int   `json:"queueDepth"`
+		Timeout     string `json:"timeout"`
+	} `json:"kdf"`
+	Registration *struct {
+		Mode      RegistrationMode `json:"mode"`
+		InviteTTL string           `json:"inviteTTL"`
+		Reserved  []string         `json:"reserved"`
+	} `json:"registration"`
+}
+
+// LoadConfigFile applies the settings in the json file at path to c.
+func LoadConfigFile(path string, c *ContextConfig) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var fc fileConfig
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&fc); err != nil {
+		return fmt.Errorf("reading config %s: %w", path, err)
+	}
+	if fc.VaultPath != nil {
+		c.VaultPath = *fc.VaultPath
+	}
+	c.Admins = append(c.Admins, fc.Admins...)
+	if fc.TOTP != nil {
+		c.TOTP = *fc.TOTP
+	}
+	if fc.Issuer != nil {
+		c.Issuer = *fc.Issuer
+	}
+	if fc.MaxSecretSize != nil {
+		if *fc.MaxSecretSize <= 0 {
+			return fmt.Errorf("reading config %s: maxSecretSize must be a positive number of bytes", path)
+		}
+		c.MaxSecretSize = *fc.MaxSecretSize
+	}
+	if fc.MaxFileSize != nil {
+		if *fc.MaxFileSize <= 0 {
+			return fmt.Errorf("reading config %s: maxFileSize must be a positive number of bytes", path)
+		}
+		c.MaxFileSize = *fc.MaxFileSize
+	}
+	if fc.MetricsToken != nil {
+		c.MetricsToken = *fc.MetricsToken
+	}
+	if k := fc.KDF; k != nil {
+		kdf := c.KDF
+		if k.Concurrency != nil {
+			kdf.Concurrency = *k.Concurrency
+		}
+		if k.QueueDepth != nil {
+			kdf.QueueDepth = *k.QueueDepth
+		}
+		if k.Timeout != "" {
+			timeout, err := time.ParseDuration(k.Timeout)
+			if err != nil {
+				return fmt.Errorf("reading config %s: kdf.timeout must be a positive duration", path)
+			}
+			kdf.Timeout = timeout
+		}
+		if err := kdf.Validate(); err != nil {
+			return fmt.Errorf("reading config %s: %w", path, err)
+		}
+		c.KDF = kdf
+	}
+	if fc.Seal != nil {
+		c.Seal = SealConfig{
+			Provider: fc.Seal.Provider,
+			KeyFile:  fc.Seal.KeyFile,
+			Transit:  TransitConfig(fc.Seal.Transit),
+		}
+	}
+	if r := fc.Registration; r != nil {
+		if r.Mode != "" {
+			if err := r.Mode.Validate(); err != nil {
+				return fmt.Errorf("reading config %s: %w", path, err)
+			}
+			c.Registration.Mode = r.Mode
+		}
+		if r.InviteTTL != "" {
+			ttl, err := time.ParseDuration(r.InviteTTL)
+			if err != nil || ttl <= 0 {
+				return fmt.Errorf("reading config %s: registration.inviteTTL must be a positive duration", path)
+			}
+			c.Registration.InviteTTL = ttl
+		}
+		c.Registration.Reserved = append(c.Registration.Reserved, r.Reserved...)
 	}
+	return nil
 }
@@ -5,3 +5,9 @@ type SessionKey struct{}
 
 // BodyKey is the context key used to store parsed request bodies.
 type BodyKey struct{}
+
+// AuditKey is the context key used to store the audit record of the current request.
+type AuditKey struct{}
+
+// RequestIDKey is the context key used to store the id of the current request.
+type RequestIDKey struct{}
@@ -11,10 +11,65 @@ var MissingPassword = errors.New("\"password\" is required for logging in")
 var IncorrectCredentials = errors.New("username or password incorrect")
 var MissingAuthorizationHeader = errors.New("Authorization Failed")
 var MalformedAuthorizationHeader = errors.New("Authorization Header Malformed")
-var AuthorizationExpired = errors.New("Authorization Header Malformed")
+var AuthorizationExpired = errors.New("Authorization Expired")
+var UnknownSession = errors.New("no such session")
+var InsufficientScope = errors.New("token is not permitted to perform this operation")
+var ScopeEscalation = errors.New("requested scope exceeds the scope of the issuing token")
+var IncorrectRoleCredentials = errors.New("role id or secret id incorrect")
+var AddressNotAllowed = errors.New("login is not permitted from this address")
+var InvalidCIDR = errors.New("cidrs must be valid network prefixes such as 10.0.0.0/8")
+var TooManyAttempts = errors.New("too many failed attempts, try again later")
+var AdminRequired = errors.New("this operation requires an administrator")
+var OTPRequired = errors.New("a two-factor code is required for this account")
+var IncorrectOTP = errors.New("two-factor code incorrect")
+var TOTPAlreadyEnrolled = errors.New("two-factor authentication is already enabled")
+var TOTPNotPending = errors.New("no two-factor enrollment is awaiting confirmation")
+var TOTPUnavailable = errors.New("two-factor authentication is disabled on this server")
+var EnrollmentRequired = errors.New("two-factor enrollment is required before using this account")
+var MetricsDisabled = errors.New("metrics are disabled on this server")
+var IncorrectMetricsToken = errors.New("metrics token incorrect")
+var AuditUnavailable = errors.New("the request could not be audited")
+var VaultSealed = errors.New("vault is sealed")
+var MissingUnsealKey = errors.New("an unseal key share is required")
+var NoRekeyInProgress = errors.New("no rekey is in progress")
+var RekeyNonceMismatch = errors.New("nonce does not match the rekey in progress")
+var MissingGroup = errors.New("a group name is required")
+var InvalidGroupName = errors.New("group names are up to 64 lowercase letters, digits, '.', '_' or '-', starting with a letter or digit")
+var NotGroupMember = errors.New("not a member of this group")
+var GroupAdminRequired = errors.New("this operation requires a group admin")
+var LastGroupAdmin = errors.New("a group must keep at least one admin")
+var NoKeyPair = errors.New("user has no key pair yet and must log in once before joining a group")
+var AlreadyGroupMember = errors.New("user is already a member of this group")
+var GroupChanged = errors.New("the group changed while the request was handled, retry")
+var PolicyDenied = errors.New("no policy grants this operation")
+var InvalidPolicy = errors.New("a policy needs a name of letters, digits, - and _, and rules with a path and known capabilities")
+var BuiltinPolicy = errors.New("built-in policies cannot be changed")
+var UnknownPolicy = errors.New("no such policy")
+var AccountDisabled = errors.New("this account has been disabled")
+var RegistrationClosed = errors.New("registration is closed")
+var InviteRequired = errors.New("registration requires an invite")
+var InvalidInvite = errors.New("invite is invalid, used or expired")
+var InvalidRegistrationMode = errors.New("registration mode must be open, invite or disabled")
+var InvalidUsername = errors.New("usernames are 3 to 64 lowercase letters, digits, '.', '_' or '-', starting with a letter or digit")
+var ReservedUsername = errors.New("this username is reserved")
+var SelfAdminAction = errors.New("administrators cannot disable, delete or demote themselves")
+var InvalidSecretPath = errors.New("secret keys are \"/\" separated paths without empty, \".\" or \"..\" segments or \"*\", and directories end in \"/\"")
+var ConfirmationRequired = errors.New("deleting a directory requires \"confirm\" to repeat its path")
+var NoSuchSecret = errors.New("no such secret")
+var SecretExists = errors.New("a secret already exists at the destination")
+var InvalidMetadata = errors.New("labels are up to 32 keys of letters, digits, '.', '_', '-' or '/' with values of up to 256 bytes, and descriptions up to 1024 bytes")
+var NotAnObject = errors.New("secret is not a json object of fields")
+var NoSuchField = errors.New("secret has no such field")
+var SecretChanged = errors.New("the secret changed while the request was handled, retry")
+var SecretTooLarge = errors.New("secret is larger than the server accepts")
+var UseFileRoute = errors.New("secret is too large to read as json, download it from /file/get")
+var RequestTooLarge = errors.New("request body is larger than the server accepts")
+var OctetStreamRequired = errors.New("files must be uploaded as application/octet-stream")
+var InvalidFileMode = errors.New("mode must be octal permission bits such as 0600")
 var UnexpectedServerError = errors.New("Unexpected Serverside Error")
 
+var NoSuchUser = errors.New("no such user")
+
 func NewNoSuchUserError(u string) error {
-	msg := fmt.Sprintf("no such user \"%s\"", u)
-	return errors.New(msg)
+	return fmt.Errorf("%w \"%s\"", NoSuchUser, u)
 }
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	e "github.com/jdpolicano/govault/internal/server/errors"
+)
+
+// FieldSeparator splits a key such as "db/prod#password" into the path of a
+// structured secret and the field to read from it.
+const FieldSeparator = "#"
+
+// SplitField returns the path and field of key. The field is empty when key
+// names a whole secret.
+func SplitField(key string) (path, field string) {
+	path, field, _ = strings.Cut(key, FieldSeparator)
+	return path, field
+}
+
+// ParseObject checks that data is a json object and returns its fields. Nothing
+// is required of the fields themselves.
+func ParseObject(data []byte) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return nil, e.NotAnObject
+	}
+	return fields, nil
+}
+
+// PatchObject applies patch to fields: each field of patch replaces the field
+// of the same name, or removes it when null.
+func PatchObject(fields, patch map[string]json.RawMessage) {
+	for name, value := range patch {
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			delete(fields, name)
+			continue
+		}
+		fields[name] = value
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/store"
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+// groupKeySize is the size of a group's data key.
+const groupKeySize = 32
+
+// GroupPath is the path a group secret is checked against in token scopes.
+func GroupPath(group, key string) string {
+	return "group:" + group + "/" + key
+}
+
+// EnsureKeyPair gives user an X25519 key pair, saving them to the store, if they
+// have none. The private key is sealed with their vault key.
+func (refs *ServerRefs) EnsureKeyPair(user *store.User, key []byte) error {
+	created, err := ensureKeyPair(user, key)
+	if err != nil || !created {
+		return err
+	}
+	return refs.Store.UpdateUser(*user)
+}
+
+// ensureKeyPair reports whether user was given a new key pair.
+func ensureKeyPair(user *store.User, key []byte) (bool, error) {
+	if user.PrivateKey != nil {
+		return false, nil
+	}
+	private, public, err := vault.GenerateKeyPair()
+	if err != nil {
+		return false, err
+	}
+	defer clear(private)
+	text, nonce, err := vault.EncryptBytes(key, private)
+	if err != nil {
+		return false, err
+	}
+	user.PublicKey, user.PrivateKey = public, &store.CipherText{Nonce: nonce, Text: text}
+	return true, nil
+}
+
+// Group names are between these lengths, counted in bytes.
+const (
+	minGroupNameLen = 1
+	maxGroupNameLen = 64
+)
+
+// ValidateGroupName checks a name for a new group, which follows the rules for
+// usernames but may be shorter.
+func ValidateGroupName(name string) error {
+	if len(name) < minGroupNameLen || len(name) > maxGroupNameLen || !validName(name) {
+		return e.InvalidGroupName
+	}
+	return nil
+}
+
+// NewGroup creates a group with a fresh group key whose only member is owner,
+// as its admin.
+func NewGroup(name string, owner store.User) (store.Group, error) {
+	if err := ValidateGroupName(name); err != nil {
+		return store.Group{}, err
+	}
+	group := store.Group{Name: name, Members: map[string]store.GroupMember{}, Secrets: map[string]store.CipherText{}}
+	groupKey, err := vault.GenerateRandBytes(groupKeySize)
+	if err != nil {
+		return group, err
+	}
+	defer clear(groupKey)
+	return group, AddGroupMember(&group, owner, groupKey, true)
+}
+
+// OpenGroupKey unwraps the group key for user with their vault key.
+func OpenGroupKey(group store.Group, user store.User, key []byte) ([]byte, error) {
+	member, ok := group.Members[user.Name]
+	if !ok {
+		return nil, e.NotGroupMember
+	}
+	if user.PrivateKey == nil {
+		return nil, e.NoKeyPair
+	}
+	private, err := vault.Decrypt(user.PrivateKey.Nonce, key, user.PrivateKey.Text)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(private)
+	return vault.UnwrapWithPrivate(private, member.WrappedKey)
+}
+
+// AddGroupMember wraps groupKey to user's public key and adds them to group.
+func AddGroupMember(group *store.Group, user store.User, groupKey []byte, admin bool) error {
+	if _, ok := group.Members[user.Name]; ok {
+		return e.AlreadyGroupMember
+	}
+	if len(user.PublicKey) == 0 {
+		return e.NoKeyPair
+	}
+	wrapped, err := vault.WrapForRecipient(user.PublicKey, groupKey)
+	if err != nil {
+		return err
+	}
+	group.Members[user.Name] = store.GroupMember{Admin: admin, WrappedKey: wrapped}
+	return nil
+}
+
+// RemoveGroupMember removes name from group and replaces the group key, so the
+// departed member's copy opens nothing written from now on. Every secret is
+// re-encrypted with the new key, which is wrapped to the remaining members'
+// public keys as found by lookup.
+func RemoveGroupMember(group *store.Group, name string, groupKey []byte, lookup func(string) (store.User, bool)) error {
+	member, ok := group.Members[name]
+	if !ok {
+		return e.NotGroupMember
+	}
+	if member.Admin && groupAdmins(*group) == 1 && len(group.Members) > 1 {
+		return e.LastGroupAdmin
+	}
+
+	newKey, err := vault.GenerateRandBytes(groupKeySize)
+	if err != nil {
+		return err
+	}
+	defer clear(newKey)
+	secrets := make(map[string]store.CipherText, len(group.Secrets))
+	for k, v := range group.Secrets {
+		plaintext, err := vault.Decrypt(v.Nonce, groupKey, v.Text)
+		if err != nil {
+			return err
+		}
+		text, nonce, err := vault.EncryptBytes(newKey, plaintext)
+		clear(plaintext)
+		if err != nil {
+			return err
+		}
+		secrets[k] = store.CipherText{Nonce: nonce, Text: text}
+	}
+	members := make(map[string]store.GroupMember, len(group.Members))
+	for user, m := range group.Members {
+		if user == name {
+			continue
+		}
+		record, ok := lookup(user)
+		if !ok || len(record.PublicKey) == 0 {
+			return e.NewNoSuchUserError(user)
+		}
+		if m.WrappedKey, err = vault.WrapForRecipient(record.PublicKey, newKey); err != nil {
+			return err
+		}
+		members[user] = m
+	}
+	group.Members, group.Secrets = members, secrets
+	group.Epoch++
+	return nil
+}
+
+// IsGroupAdmin reports whether user may manage the group's members.
+func IsGroupAdmin(group store.Group, user string) bool {
+	return group.Members[user].Admin
+}
+
+func groupAdmins(group store.Group) int {
+	n := 0
+	for _, m := range group.Members {
+		if m.Admin {
+			n++
+		}
+	}
+	return n
+}
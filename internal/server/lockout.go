@@ -0,0 +1,268 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+// pruneAt is the number of tracked entries above which stale ones are swept on every failure.
+const pruneAt = 4096
+
+// LockoutPolicy controls how failed logins slow down and lock out further attempts.
+type LockoutPolicy struct {
+	UserThreshold int           // failures against one account before it is locked
+	AddrThreshold int           // failures from one client address before it is locked
+	BaseDelay     time.Duration // the first lockout period, doubled for every further failure
+	MaxDelay      time.Duration // the longest a lockout may last
+	Window        time.Duration // failures older than this are forgotten
+}
+
+// attempts tracks the recent failures for a single account or address, and the
+// attempts still being checked.
+type attempts struct {
+	failures    int
+	pending     int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// LockoutStatus is a snapshot of the failures recorded against an account or address.
+type LockoutStatus struct {
+	Kind        string    `json:"kind"` // "user" or "address"
+	Name        string    `json:"name"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until,omitzero"`
+}
+
+// LoginGuard tracks failed logins per account and per client address and applies
+// exponential backoff once either crosses its threshold. Attempts are reserved
+// before the password is checked, so guesses made at once count towards the
+// threshold before any of them has failed.
+type LoginGuard struct {
+	sync.Mutex
+	policy    LockoutPolicy
+	users     map[string]*attempts
+	addrs     map[string]*attempts
+	decoySalt []byte // salt used to run the kdf for unknown users
+}
+
+func NewLoginGuard(policy LockoutPolicy, saltSize int) *LoginGuard {
+	salt, err := vault.GenerateRandBytes(saltSize)
+	if err != nil {
+		// a fixed salt only weakens timing equalization, never authentication.
+		salt = make([]byte, saltSize)
+	}
+	return &LoginGuard{
+		policy:    policy,
+		users:     make(map[string]*attempts),
+		addrs:     make(map[string]*attempts),
+		decoySalt: salt,
+	}
+}
+
+// DecoySalt returns a salt to derive a throwaway key with when a login names an
+// unknown user, so that those requests take as long as real ones.
+func (g *LoginGuard) DecoySalt() []byte {
+	return g.decoySalt
+}
+
+// Check reports how long the caller must wait before user may attempt to log in
+// from addr. A zero duration means the attempt may proceed, and reserves it: the
+// attempt counts towards both thresholds until it is settled by Fail, Succeed or
+// Release, one of which must follow. Once the attempts in flight would be enough
+// to lock the account or address out should they all fail, more must wait.
+func (g *LoginGuard) Check(user, addr string) time.Duration {
+	g.Lock()
+	defer g.Unlock()
+	now := time.Now()
+	wait := g.remaining(g.users, user, g.policy.UserThreshold, now)
+	if w := g.remaining(g.addrs, addr, g.policy.AddrThreshold, now); w > wait {
+		wait = w
+	}
+	if wait > 0 {
+		return wait
+	}
+	if len(g.users)+len(g.addrs) > pruneAt {
+		g.prune(now)
+	}
+	g.entry(g.users, user, now).pending++
+	g.entry(g.addrs, addr, now).pending++
+	return 0
+}
+
+// Fail settles an attempt by user from addr as failed.
+func (g *LoginGuard) Fail(user, addr string) {
+	g.Lock()
+	defer g.Unlock()
+	now := time.Now()
+	g.release(g.users, user)
+	g.release(g.addrs, addr)
+	g.record(g.users, user, g.policy.UserThreshold, now)
+	g.record(g.addrs, addr, g.policy.AddrThreshold, now)
+}
+
+// Succeed settles an attempt by user from addr as successful, clearing the
+// failures recorded against user. Failures from the address are kept, or anyone
+// with a valid account could reset the address's count between guesses at other
+// accounts.
+func (g *LoginGuard) Succeed(user, addr string) {
+	g.Lock()
+	defer g.Unlock()
+	g.release(g.addrs, addr)
+	if a := g.release(g.users, user); a != nil && a.pending > 0 {
+		// other attempts are still in flight, keep counting them.
+		a.failures, a.lockedUntil = 0, time.Time{}
+	} else {
+		delete(g.users, user)
+	}
+}
+
+// Release settles an attempt by user from addr that was neither a right nor a
+// wrong guess, such as one the server was too busy to check.
+func (g *LoginGuard) Release(user, addr string) {
+	g.Lock()
+	defer g.Unlock()
+	g.release(g.users, user)
+	g.release(g.addrs, addr)
+}
+
+// Clear forgets the failures recorded against a single account ("user") or
+// address ("address") and reports whether there were any.
+func (g *LoginGuard) Clear(kind, name string) bool {
+	g.Lock()
+	defer g.Unlock()
+	m := g.users
+	if kind == "address" {
+		m = g.addrs
+	}
+	_, exists := m[name]
+	delete(m, name)
+	return exists
+}
+
+// Snapshot lists every account and address with failures on record.
+func (g *LoginGuard) Snapshot() []LockoutStatus {
+	g.Lock()
+	defer g.Unlock()
+	now := time.Now()
+	g.prune(now)
+	out := make([]LockoutStatus, 0, len(g.users)+len(g.addrs))
+	for name, a := range g.users {
+		if a.failures > 0 {
+			out = append(out, LockoutStatus{"user", name, a.failures, lockedUntil(a, now)})
+		}
+	}
+	for name, a := range g.addrs {
+		if a.failures > 0 {
+			out = append(out, LockoutStatus{"address", name, a.failures, lockedUntil(a, now)})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind > out[j].Kind
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+func (g *LoginGuard) remaining(m map[string]*attempts, name string, threshold int, now time.Time) time.Duration {
+	a, exists := m[name]
+	if !exists {
+		return 0
+	}
+	if g.stale(a, now) {
+		delete(m, name)
+		return 0
+	}
+	g.expire(a, now)
+	if now.Before(a.lockedUntil) {
+		return a.lockedUntil.Sub(now)
+	}
+	// below the threshold as many attempts may be in flight as it has room for,
+	// past it one at a time.
+	if threshold > 0 && a.pending >= max(threshold-a.failures, 1) {
+		return max(g.policy.BaseDelay, time.Second)
+	}
+	return 0
+}
+
+// entry returns the attempts tracked for name, creating them if need be.
+func (g *LoginGuard) entry(m map[string]*attempts, name string, now time.Time) *attempts {
+	a, exists := m[name]
+	if !exists {
+		a = &attempts{}
+		m[name] = a
+	}
+	g.expire(a, now)
+	return a
+}
+
+// expire forgets failures that are neither locking a out nor within the window.
+func (g *LoginGuard) expire(a *attempts, now time.Time) {
+	if now.Sub(a.last) > g.policy.Window && now.After(a.lockedUntil) {
+		a.failures, a.lockedUntil = 0, time.Time{}
+	}
+}
+
+// release gives back an attempt reserved by Check, forgetting name once nothing
+// is left on record for it. It returns what is left, if anything.
+func (g *LoginGuard) release(m map[string]*attempts, name string) *attempts {
+	a, exists := m[name]
+	if !exists {
+		return nil
+	}
+	if a.pending > 0 {
+		a.pending--
+	}
+	if a.pending == 0 && a.failures == 0 {
+		delete(m, name)
+		return nil
+	}
+	return a
+}
+
+func (g *LoginGuard) record(m map[string]*attempts, name string, threshold int, now time.Time) {
+	a := g.entry(m, name, now)
+	a.failures++
+	a.last = now
+	if threshold > 0 && a.failures >= threshold {
+		a.lockedUntil = now.Add(g.backoff(a.failures - threshold))
+	}
+}
+
+// backoff doubles the base delay for every failure past the threshold.
+func (g *LoginGuard) backoff(over int) time.Duration {
+	delay := g.policy.BaseDelay
+	for i := 0; i < over && delay < g.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, g.policy.MaxDelay)
+}
+
+// stale reports whether a is neither locked, within the failure window nor
+// waiting on an attempt in flight.
+func (g *LoginGuard) stale(a *attempts, now time.Time) bool {
+	return a.pending == 0 && now.Sub(a.last) > g.policy.Window && now.After(a.lockedUntil)
+}
+
+// prune forgets stale entries.
+func (g *LoginGuard) prune(now time.Time) {
+	for _, m := range []map[string]*attempts{g.users, g.addrs} {
+		for name, a := range m {
+			if g.stale(a, now) {
+				delete(m, name)
+			}
+		}
+	}
+}
+
+func lockedUntil(a *attempts, now time.Time) time.Time {
+	if now.Before(a.lockedUntil) {
+		return a.lockedUntil
+	}
+	return time.Time{}
+}
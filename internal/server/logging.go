@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// redactedValue replaces anything that must never reach a log.
+const redactedValue = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values are always redacted, wherever they
+// appear in a log line.
+var sensitiveKeys = map[string]bool{
+	"password":      true,
+	"passwd":        true,
+	"value":         true,
+	"secret":        true,
+	"secret_id":     true,
+	"token":         true,
+	"otp":           true,
+	"code":          true,
+	"recovery_code": true,
+	"authorization": true,
+	"key_material":  true,
+}
+
+// Redacted wraps a value that must not be logged. It renders as [REDACTED] even
+// when logged under a key that isn't known to be sensitive.
+type Redacted string
+
+func (Redacted) LogValue() slog.Value {
+	return slog.StringValue(redactedValue)
+}
+
+// LogConfig chooses how the server logs.
+type LogConfig struct {
+	Format string     // "json" or "text"
+	Level  slog.Level // the lowest level written
+}
+
+// NewLogger builds the server logger. Every line carries the request id of the
+// context it was logged with, and sensitive attributes are redacted.
+func NewLogger(w io.Writer, c LogConfig) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: c.Level, ReplaceAttr: redactAttr}
+	var h slog.Handler
+	if strings.EqualFold(c.Format, "text") {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(requestIDHandler{h})
+}
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redactedValue)
+	}
+	if a.Value.Kind() == slog.KindAny {
+		if _, ok := a.Value.Any().([]byte); ok {
+			return slog.String(a.Key, redactedValue)
+		}
+	}
+	return a
+}
+
+// requestIDHandler adds the request id found on the context to every record.
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
+
+// RequestID returns the id of the request ctx belongs to, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(RequestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"unicode/utf8"
+
+	e "github.com/jdpolicano/govault/internal/server/errors"
+)
+
+// Secret metadata is kept within these bounds, in bytes, so it stays small next
+// to the secrets it describes.
+const (
+	maxLabels         = 32
+	maxLabelKeyLen    = 64
+	maxLabelValueLen  = 256
+	maxDescriptionLen = 1024
+)
+
+// ValidateMetadata checks the labels and description a client wants to attach
+// to a secret. Label keys are letters, digits, ".", "_", "-" and "/"; values and
+// the description may be any text.
+func ValidateMetadata(labels map[string]string, description string) error {
+	if len(labels) > maxLabels || len(description) > maxDescriptionLen || !utf8.ValidString(description) {
+		return e.InvalidMetadata
+	}
+	for k, v := range labels {
+		if len(k) == 0 || len(k) > maxLabelKeyLen || len(v) > maxLabelValueLen || !utf8.ValidString(v) {
+			return e.InvalidMetadata
+		}
+		for _, ch := range k {
+			alnum := ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9'
+			if !alnum && ch != '.' && ch != '_' && ch != '-' && ch != '/' {
+				return e.InvalidMetadata
+			}
+		}
+	}
+	return nil
+}
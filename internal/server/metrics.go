@@ -0,0 +1,77 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/metrics"
+)
+
+// Metrics are the instruments the server reports on /metrics.
+type Metrics struct {
+	Registry    *metrics.Registry
+	Requests    *metrics.CounterVec   // requests by route and status code
+	Latency     *metrics.HistogramVec // request latency by route and status code
+	KDF         *metrics.HistogramVec // key derivation time by outcome
+	StoreOps    *metrics.HistogramVec // store call latency by operation
+	StoreErrors *metrics.CounterVec   // failed store calls by operation
+}
+
+// NewMetrics registers the server's metrics. Gauges and the audit sink failure
+// counts are read from refs when scraped.
+func NewMetrics(refs *ServerRefs) *Metrics {
+	reg := metrics.NewRegistry()
+	m := &Metrics{
+		Registry: reg,
+		Requests: reg.Counter("govault_http_requests_total",
+			"HTTP requests handled, by route and status code.", "route", "code"),
+		Latency: reg.Histogram("govault_http_request_duration_seconds",
+			"HTTP request latency, by route and status code.", metrics.DefaultBuckets, "route", "code"),
+		KDF: reg.Histogram("govault_kdf_duration_seconds",
+			"Password key derivation time, or time waited when turned away, by outcome.", metrics.KDFBuckets, "result"),
+		StoreOps: reg.Histogram("govault_store_operation_duration_seconds",
+			"Store operation latency, by operation.", metrics.DefaultBuckets, "op"),
+		StoreErrors: reg.Counter("govault_store_errors_total",
+			"Store operations that returned an error, by operation.", "op"),
+	}
+	reg.GaugeFunc("govault_sessions_active",
+		"Sessions held in memory, including expired ones not yet evicted.",
+		func() float64 { return float64(refs.Sessions.Len()) })
+	reg.GaugeFunc("govault_kdf_running", "Key derivations in progress.",
+		func() float64 { return float64(refs.KDF.Running()) })
+	reg.GaugeFunc("govault_kdf_queued", "Requests waiting for a key derivation slot.",
+		func() float64 { return float64(refs.KDF.Queued()) })
+	reg.CounterFunc("govault_audit_sink_failures_total",
+		"Audit events a sink failed to record, by sink.", []string{"sink"},
+		func() []metrics.Sample {
+			if refs.Audit == nil {
+				return nil
+			}
+			var out []metrics.Sample
+			for _, s := range refs.Audit.Status() {
+				out = append(out, metrics.Sample{Labels: []string{s.Name}, Value: float64(s.Failures)})
+			}
+			return out
+		})
+	return m
+}
+
+// ObserveRequest records a completed request.
+func (m *Metrics) ObserveRequest(route string, status int, took time.Duration) {
+	code := strconv.Itoa(status)
+	m.Requests.Inc(route, code)
+	m.Latency.Observe(took.Seconds(), route, code)
+}
+
+// ObserveKDF records a key derivation outcome.
+func (m *Metrics) ObserveKDF(result string, took time.Duration) {
+	m.KDF.Observe(took.Seconds(), result)
+}
+
+// ObserveStore records a store call, suitable as a store.Observer.
+func (m *Metrics) ObserveStore(op string, took time.Duration, err error) {
+	m.StoreOps.Observe(took.Seconds(), op)
+	if err != nil {
+		m.StoreErrors.Inc(op)
+	}
+}
@@ -2,82 +2,331 @@ package middleware
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/jdpolicano/govault/internal/audit"
 	"github.com/jdpolicano/govault/internal/server"
 	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/vault"
 )
 
 // Middleware defines a function that wraps an http.HandlerFunc.
 type Middleware func(http.HandlerFunc) http.HandlerFunc
 
-// Chain applies several middleware around a final handler.
+// Chain applies several middleware around a final handler. A use of a limited
+// token is spent only once every middleware has let the request through, so
+// requests refused by Authorize and the like cost nothing.
 func Chain(h http.HandlerFunc, m ...Middleware) http.HandlerFunc {
+	h = spendUse(h)
 	for i := len(m) - 1; i >= 0; i-- {
 		h = m[i](h)
 	}
 	return h
 }
 
+// pendingUseKey holds the function spending a use of the request's session,
+// stored by ValidateToken for limited tokens.
+type pendingUseKey struct{}
+
+func spendUse(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if spend, ok := r.Context().Value(pendingUseKey{}).(func() error); ok && spend != nil {
+			if err := spend(); err != nil {
+				server.WriteAuthError(w, err)
+				return
+			}
+			// nested chains mustn't spend it again.
+			r = r.WithContext(context.WithValue(r.Context(), pendingUseKey{}, (func() error)(nil)))
+		}
+		next(w, r)
+	}
+}
+
 // ValidateToken validates the Authorization header and stores the session on the request context.
 func ValidateToken(refs *server.ServerRefs) Middleware {
+	return validateToken(refs, false)
+}
+
+// ValidateEnrollmentToken is ValidateToken that also admits sessions which may only
+// enroll a second factor. It is meant for the two-factor enrollment routes.
+func ValidateEnrollmentToken(refs *server.ServerRefs) Middleware {
+	return validateToken(refs, true)
+}
+
+func validateToken(refs *server.ServerRefs, allowEnrollOnly bool) Middleware {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			// check that the header exists
-			auth := r.Header.Get("Authorization")
-			if len(auth) == 0 {
-				http.Error(w, "missing authorization", http.StatusUnauthorized)
+			sess, err := refs.Auth.Authenticate(r)
+			if err != nil {
+				server.WriteAuthError(w, err)
 				return
 			}
+			if sess.EnrollOnly && !allowEnrollOnly {
+				server.WriteAuthError(w, &server.AuthError{
+					Status: http.StatusForbidden,
+					Code:   "insufficient_scope",
+					Err:    e.EnrollmentRequired,
+				})
+				return
+			}
+			server.NoteAuditSession(r, sess)
+			ctx := context.WithValue(r.Context(), server.SessionKey{}, sess)
+			if sess.Uses > 0 {
+				ctx = context.WithValue(ctx, pendingUseKey{}, func() error { return refs.Auth.Spend(sess) })
+			}
+			next(w, r.WithContext(ctx))
+		}
+	}
+}
 
-			// check that the prefix is correct
-			toke, found := strings.CutPrefix(auth, "Bearer govault-")
-			if !found {
-				http.Error(w, "malformed header", http.StatusUnauthorized)
+// Authorize rejects requests whose session scope or policies do not permit cap on
+// the secret named by the request body. It must run after ValidateToken and
+// ParseJSONBody.
+func Authorize(refs *server.ServerRefs, cap server.Capability) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			sess := r.Context().Value(server.SessionKey{}).(server.Session)
+			body, ok := r.Context().Value(server.BodyKey{}).(server.KeyedRequest)
+			if !ok {
+				http.Error(w, e.InvalidRequestBody.Error(), http.StatusBadRequest)
 				return
 			}
+			if err := refs.AuthorizeKey(sess, cap, body.SecretKey()); err != nil {
+				server.WriteAuthError(w, err)
+				return
+			}
+			next(w, r)
+		}
+	}
+}
 
-			// check if the token has expired...
-			sess, found := refs.Sessions.Get(toke)
-			if sess.Expired() {
-				refs.Sessions.Delete(toke)
-				http.Error(w, "no such session", http.StatusUnauthorized)
+// RequireAdmin rejects requests whose session's policies do not grant admin on the
+// route's path (see server.AdminPath). Scoped tokens and machine identities never
+// carry admin rights. It must run after ValidateToken.
+func RequireAdmin(refs *server.ServerRefs) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			sess := r.Context().Value(server.SessionKey{}).(server.Session)
+			if !isUserSession(sess) || refs.Authorize(sess, server.CapAdmin, server.AdminPath(r.URL.Path)) != nil {
+				server.JSONResponse(w, server.NewResponse(http.StatusForbidden, nil, e.AdminRequired))
 				return
 			}
+			next(w, r)
+		}
+	}
+}
 
-			r = r.WithContext(context.WithValue(r.Context(), server.SessionKey{}, sess))
+// RequireUserSession rejects scoped tokens and machine identities, for routes that
+// manage the account itself. It must run after ValidateToken.
+func RequireUserSession() Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			sess := r.Context().Value(server.SessionKey{}).(server.Session)
+			if !isUserSession(sess) {
+				server.WriteAuthError(w, &server.AuthError{
+					Status: http.StatusForbidden,
+					Code:   "insufficient_scope",
+					Err:    e.InsufficientScope,
+				})
+				return
+			}
 			next(w, r)
 		}
 	}
 }
 
+// isUserSession reports whether sess came from a password login rather than a
+// derived token or machine identity.
+func isUserSession(sess server.Session) bool {
+	return sess.Scope.Unrestricted() && sess.Role == "" && sess.Uses == 0
+}
+
 // ParseJSONBody parses the request body JSON into a value of type T and stores it on the context.
-func ParseJSONBody[T any]() Middleware {
+// Bodies larger than the config's MaxBodySize are refused with a 413 before they are read
+// into memory.
+func ParseJSONBody[T any](refs *server.ServerRefs) Middleware {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			var body T
-			dec := json.NewDecoder(r.Body)
+			dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, refs.Config.MaxBodySize()))
 			if err := dec.Decode(&body); err != nil {
+				if tooLarge := new(http.MaxBytesError); errors.As(err, &tooLarge) {
+					server.JSONResponse(w, server.NewResponse(http.StatusRequestEntityTooLarge, nil, e.RequestTooLarge))
+					return
+				}
 				http.Error(w, e.InvalidRequestBody.Error(), http.StatusBadRequest)
 				return
 			}
+			if keyed, ok := any(body).(server.KeyedRequest); ok {
+				server.NoteAuditKey(r, keyed.SecretKey())
+			}
 			r = r.WithContext(context.WithValue(r.Context(), server.BodyKey{}, body))
 			next(w, r)
 		}
 	}
 }
 
-// Logging logs the request method, path and duration using the provided logger.
-func Logging(l *log.Logger) Middleware {
+// Logging logs the request method, path, status and duration using the provided logger.
+func Logging(l *slog.Logger) Middleware {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next(sw, r)
+			l.InfoContext(r.Context(), "request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", sw.status,
+				"duration", time.Since(start),
+			)
+		}
+	}
+}
+
+// RequireUnsealed turns every request away with a 503 while the vault is sealed,
+// except those for paths in exempt. An exempt path ending in "/" covers
+// everything beneath it.
+func RequireUnsealed(refs *server.ServerRefs, exempt ...string) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if refs.Barrier.Sealed() && !exemptPath(r.URL.Path, exempt) {
+				server.JSONResponse(w, server.NewResponse(http.StatusServiceUnavailable, nil, e.VaultSealed))
+				return
+			}
 			next(w, r)
-			l.Printf("%s %s %v", r.Method, r.URL.Path, time.Since(start))
 		}
 	}
 }
+
+func exemptPath(path string, exempt []string) bool {
+	for _, p := range exempt {
+		if path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Instrument counts every request served by mux and observes its latency, labelled
+// by the route pattern the mux matched so unknown paths can't blow up cardinality.
+func Instrument(refs *server.ServerRefs, mux *http.ServeMux) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next(sw, r)
+			_, route := mux.Handler(r)
+			if route == "" {
+				route = "unmatched"
+			}
+			refs.Metrics.ObserveRequest(route, sw.status, time.Since(start))
+		}
+	}
+}
+
+// RequestID assigns every request an id, taken from a well formed X-Request-ID
+// header or generated, which is echoed on the response and attached to the
+// context so every log line and audit event for the request carries it.
+func RequestID() Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(requestIDHeader)
+			if !validRequestID(id) {
+				b, err := vault.GenerateRandBytes(16)
+				if err != nil {
+					server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+					return
+				}
+				id = hex.EncodeToString(b)
+			}
+			w.Header().Set(requestIDHeader, id)
+			next(w, r.WithContext(context.WithValue(r.Context(), server.RequestIDKey{}, id)))
+		}
+	}
+}
+
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID accepts client supplied ids that are safe to echo and log.
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		ok := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.'
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Audit records operation op to the audit log once the request completes, along
+// with whatever the later middleware and handler learned about the caller. When
+// the audit config is fail-closed a request event is recorded first, and the
+// request is refused if no sink can take it.
+func Audit(refs *server.ServerRefs, op string) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if refs.Audit == nil {
+				next(w, r)
+				return
+			}
+			client := server.RequestAddr(r)
+			if refs.Config.Audit.FailClosed {
+				ev := audit.Event{
+					Operation: op,
+					Phase:     audit.PhaseRequest,
+					RequestID: server.RequestID(r.Context()),
+					Client:    client,
+					Result:    audit.ResultPending,
+				}
+				if _, err := refs.Audit.Record(ev); errors.Is(err, audit.ErrNoSinkRecorded) {
+					refs.Log.ErrorContext(r.Context(), "refusing request, audit unavailable", "operation", op, "err", err)
+					server.JSONResponse(w, server.NewResponse(http.StatusServiceUnavailable, nil, e.AuditUnavailable))
+					return
+				}
+			}
+
+			rec := &server.AuditRecord{}
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next(sw, r.WithContext(context.WithValue(r.Context(), server.AuditKey{}, rec)))
+
+			key := rec.Key
+			if key != "" && refs.Config.Audit.HMAC != nil {
+				key = audit.HMACKey(refs.Config.Audit.HMAC, key)
+			}
+			ev := audit.Event{
+				Operation: op,
+				User:      rec.User,
+				Session:   rec.Session,
+				Key:       key,
+				Target:    rec.Target,
+				RequestID: server.RequestID(r.Context()),
+				Client:    client,
+				Status:    sw.status,
+				Result:    audit.ResultFor(sw.status),
+			}
+			if _, err := refs.Audit.Record(ev); err != nil {
+				refs.Log.ErrorContext(r.Context(), "writing audit event", "operation", op, "err", err)
+			}
+		}
+	}
+}
+
+// statusWriter remembers the status code written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusWriter) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/store"
+)
+
+// The built-in policies. They always exist and cannot be changed or deleted.
+const (
+	DefaultPolicy = "default" // given to every identity with no policies of its own
+	RootPolicy    = "root"    // given to admins
+)
+
+var builtinPolicies = map[string]store.Policy{
+	DefaultPolicy: {Name: DefaultPolicy, Rules: []store.PolicyRule{
+		{Path: "secret/*", Capabilities: []string{"read", "write", "list", "delete"}},
+		{Path: "group/*", Capabilities: []string{"read", "write", "list", "delete"}},
+	}},
+	RootPolicy: {Name: RootPolicy, Rules: []store.PolicyRule{
+		{Path: "*", Capabilities: []string{"read", "write", "list", "delete", "admin"}},
+	}},
+}
+
+var errPolicyDenied = &AuthError{http.StatusForbidden, "insufficient_scope", e.PolicyDenied}
+
+// IsBuiltinPolicy reports whether name is one of the built-in policies.
+func IsBuiltinPolicy(name string) bool {
+	_, ok := builtinPolicies[name]
+	return ok
+}
+
+// ResourcePath is the path policies are checked against for the secret key a
+// request addresses. Personal secrets live under "secret/" and group secrets,
+// addressed as GroupPath builds them, under "group/<group>/".
+func ResourcePath(key string) string {
+	if rest, ok := strings.CutPrefix(key, "group:"); ok {
+		return "group/" + rest
+	}
+	return "secret/" + key
+}
+
+// AdminPath is the path policies are checked against for an admin route, e.g.
+// "sys/seal" for /v1/sys/seal and "sys/admin/lockouts" for /v1/admin/lockouts.
+func AdminPath(urlPath string) string {
+	p := strings.TrimPrefix(urlPath, "/v1")
+	return "sys" + strings.TrimPrefix(p, "/sys")
+}
+
+// ValidatePolicy checks that a policy can be stored: it needs a name that is
+// safe to use as a path and isn't built in, and every rule a path and known
+// capabilities.
+func ValidatePolicy(policy store.Policy) error {
+	if !validPolicyName(policy.Name) || len(policy.Rules) == 0 {
+		return e.InvalidPolicy
+	}
+	if IsBuiltinPolicy(policy.Name) {
+		return e.BuiltinPolicy
+	}
+	for _, rule := range policy.Rules {
+		if rule.Path == "" || len(rule.Capabilities) == 0 {
+			return e.InvalidPolicy
+		}
+		for _, c := range rule.Capabilities {
+			if !slices.Contains(Capabilities, Capability(c)) {
+				return e.InvalidPolicy
+			}
+		}
+	}
+	return nil
+}
+
+func validPolicyName(name string) bool {
+	if len(name) == 0 || len(name) > 64 {
+		return false
+	}
+	for _, c := range name {
+		ok := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// LookupPolicy finds a built-in or stored policy.
+func (refs *ServerRefs) LookupPolicy(name string) (store.Policy, bool) {
+	if policy, ok := builtinPolicies[name]; ok {
+		return policy, true
+	}
+	return refs.Store.GetPolicy(name)
+}
+
+// CheckPolicies returns e.UnknownPolicy if any of names is not defined.
+func (refs *ServerRefs) CheckPolicies(names []string) error {
+	for _, name := range names {
+		if _, ok := refs.LookupPolicy(name); !ok {
+			return fmt.Errorf("%w: %s", e.UnknownPolicy, name)
+		}
+	}
+	return nil
+}
+
+// SessionPolicies returns the names of the policies evaluated for sess. A token
+// limited to certain policies gets only those. Otherwise a machine identity gets
+// its role's policies, and a user their own plus those of every group they
+// belong to, with root added for admins.
+func (refs *ServerRefs) SessionPolicies(sess Session) []string {
+	if len(sess.Scope.Policies) > 0 {
+		return sess.Scope.Policies
+	}
+	if sess.Role != "" {
+		role, _ := refs.Store.GetRole(sess.Role)
+		return orDefault(role.Policies)
+	}
+	user, _ := refs.Store.GetUserInfo(sess.User)
+	names := slices.Clone(orDefault(user.Policies))
+	for _, group := range refs.Store.ListGroups(sess.User) {
+		names = append(names, group.Policies...)
+	}
+	if refs.Config.IsAdmin(sess.User) || user.Admin {
+		names = append(names, RootPolicy)
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// LimitPolicies returns the policies a token or role derived from sess is limited
+// to: names, which must all be policies sess itself is evaluated with, or every
+// one of those when names is empty. The derived identity always carries its
+// policies, so it never falls back on the owner's own, which sess may not have.
+func (refs *ServerRefs) LimitPolicies(sess Session, names []string) ([]string, error) {
+	allowed := refs.SessionPolicies(sess)
+	if len(names) == 0 {
+		return slices.Clone(allowed), nil
+	}
+	if !subsetOf(names, allowed) {
+		return nil, e.ScopeEscalation
+	}
+	return names, nil
+}
+
+func orDefault(names []string) []string {
+	if len(names) == 0 {
+		return []string{DefaultPolicy}
+	}
+	return names
+}
+
+// PolicyMatch is a policy rule that matched the path being checked.
+type PolicyMatch struct {
+	Policy       string   `json:"policy"`
+	Path         string   `json:"path"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// Decision is the outcome of evaluating a session's policies, with enough detail
+// to explain it.
+type Decision struct {
+	Allowed    bool          `json:"allowed"`
+	Capability Capability    `json:"capability"`
+	Path       string        `json:"path"`
+	Policies   []string      `json:"policies"`          // the policies that were evaluated
+	Missing    []string      `json:"missing,omitempty"` // attached policies that are not defined
+	Matches    []PolicyMatch `json:"matches,omitempty"` // rules whose path matched, granting cap or not
+	Reason     string        `json:"reason"`
+}
+
+// Explain evaluates the session's policies for cap on path. Access is granted
+// when any rule of any evaluated policy matches path and grants cap.
+func (refs *ServerRefs) Explain(sess Session, cap Capability, path string) Decision {
+	d := Decision{Capability: cap, Path: path, Policies: refs.SessionPolicies(sess)}
+	var grantedBy string
+	for _, name := range d.Policies {
+		policy, ok := refs.LookupPolicy(name)
+		if !ok {
+			d.Missing = append(d.Missing, name)
+			continue
+		}
+		for _, rule := range policy.Rules {
+			if !MatchPath(rule.Path, path) {
+				continue
+			}
+			d.Matches = append(d.Matches, PolicyMatch{name, rule.Path, rule.Capabilities})
+			if grantedBy == "" && slices.Contains(rule.Capabilities, string(cap)) {
+				grantedBy = fmt.Sprintf("policy %q rule %q", name, rule.Path)
+			}
+		}
+	}
+	switch {
+	case grantedBy != "":
+		d.Allowed = true
+		d.Reason = fmt.Sprintf("%s grants %s", grantedBy, cap)
+	case len(d.Matches) > 0:
+		d.Reason = fmt.Sprintf("rules match %s but none grants %s", path, cap)
+	default:
+		d.Reason = fmt.Sprintf("no rule in policies %s matches %s", strings.Join(d.Policies, ", "), path)
+	}
+	return d
+}
+
+// Authorize checks that the session's policies grant cap on path. The returned
+// error is always an *AuthError.
+func (refs *ServerRefs) Authorize(sess Session, cap Capability, path string) error {
+	if !refs.Explain(sess, cap, path).Allowed {
+		return errPolicyDenied
+	}
+	return nil
+}
+
+// AuthorizeKey checks both the session's scope and its policies for cap on a
+// secret key or pattern. The returned error is always an *AuthError.
+func (refs *ServerRefs) AuthorizeKey(sess Session, cap Capability, key string) error {
+	if err := refs.Auth.Authorize(sess, cap, key); err != nil {
+		return err
+	}
+	return refs.Authorize(sess, cap, ResourcePath(key))
+}
@@ -1,22 +1,73 @@
 package server
 
 import (
-	"log"
+	"log/slog"
 	"os"
+	"time"
 
+	"github.com/jdpolicano/govault/internal/audit"
 	"github.com/jdpolicano/govault/internal/store"
+	"github.com/jdpolicano/govault/internal/vault"
 )
 
 type ServerRefs struct {
+	Barrier  *vault.Barrier // encrypts the store, sealed until an operator unseals it
 	Sessions *SessionMap
+	Auth     *Authenticator
+	Guard    *LoginGuard
+	KDF      *vault.KDFScheduler
+	Audit    *audit.Auditor // nil when auditing is disabled
+	Metrics  *Metrics
 	Store    store.Store
 	Config   *ContextConfig
-	Log      *log.Logger
+	Log      *slog.Logger
+	Started  time.Time // when the server was started, for reporting uptime
+	sealing  sealState // key shares submitted toward unsealing or rekeying
 }
 
 func NewServerRefs(config *ContextConfig) *ServerRefs {
 	sessMap := NewSessionMap()
-	store := store.NewJSONStore(config.VaultPath)
-	logger := log.New(os.Stdout, "server: ", log.Ldate|log.Ltime)
-	return &ServerRefs{sessMap, store, config, logger}
+	logger := NewLogger(os.Stdout, config.Log)
+	refs := &ServerRefs{
+		Barrier:  vault.NewBarrier(),
+		Sessions: sessMap,
+		Auth:     NewAuthenticator(sessMap),
+		Guard:    NewLoginGuard(config.Lockout, config.SaltSize),
+		KDF:      vault.NewKDFScheduler(config.KDF.Concurrency, config.KDF.QueueDepth, config.KDF.Timeout),
+		Config:   config,
+		Log:      logger,
+		Started:  time.Now(),
+	}
+	refs.Metrics = NewMetrics(refs)
+	refs.KDF.SetObserver(refs.Metrics.ObserveKDF)
+	refs.Store = store.NewInstrumented(store.NewEncryptedJSONStore(config.VaultPath, refs.Barrier), refs.Metrics.ObserveStore)
+	return refs
+}
+
+// OpenAudit starts shipping audit events to the sinks in the audit config, if any.
+func (refs *ServerRefs) OpenAudit() error {
+	c := refs.Config.Audit
+	if !c.Enabled() {
+		return nil
+	}
+	var sinks []audit.Sink
+	if c.File != "" {
+		file, err := audit.NewFileSink(c.File, c.FileMaxBytes, c.FileMaxFiles)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, file)
+	}
+	if c.SyslogAddr != "" {
+		sinks = append(sinks, audit.NewSyslogSink(c.SyslogNetwork, c.SyslogAddr, "govault"))
+	}
+	if c.Socket != "" {
+		sinks = append(sinks, audit.NewSocketSink(c.Socket))
+	}
+	auditor, err := audit.NewAuditor(c.ChainKey, sinks...)
+	if err != nil {
+		return err
+	}
+	refs.Audit = auditor
+	return nil
 }
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"time"
+
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/store"
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+// RegistrationMode decides who may create an account.
+type RegistrationMode string
+
+const (
+	RegistrationOpen     RegistrationMode = "open"     // anyone who can reach the server
+	RegistrationInvite   RegistrationMode = "invite"   // only holders of an invite from an admin
+	RegistrationDisabled RegistrationMode = "disabled" // nobody, accounts are only made some other way
+)
+
+// Validate returns e.InvalidRegistrationMode unless m is a known mode.
+func (m RegistrationMode) Validate() error {
+	switch m {
+	case RegistrationOpen, RegistrationInvite, RegistrationDisabled:
+		return nil
+	}
+	return e.InvalidRegistrationMode
+}
+
+// Set implements flag.Value.
+func (m *RegistrationMode) Set(v string) error {
+	if err := RegistrationMode(v).Validate(); err != nil {
+		return err
+	}
+	*m = RegistrationMode(v)
+	return nil
+}
+
+func (m *RegistrationMode) String() string {
+	return string(*m)
+}
+
+// Usernames are between these lengths, counted in bytes.
+const (
+	minUsernameLen = 3
+	maxUsernameLen = 64
+)
+
+// reservedUsernames can't be registered because they would be confusing or, in a
+// store that names directories for users, collide with the store's own files.
+var reservedUsernames = []string{
+	"admin", "administrator", "root", "system", "sys", "govault",
+	"users", "groups", "policies", "manifest.json", "invites.json", "settings.json", "keyring.json", "audit.log", "audit.key",
+}
+
+// ValidateUsername checks a name someone wants to register: lowercase letters,
+// digits, ".", "_" and "-", starting with a letter or digit, of a sensible
+// length and not reserved.
+func (c *ContextConfig) ValidateUsername(name string) error {
+	if len(name) < minUsernameLen || len(name) > maxUsernameLen {
+		return e.InvalidUsername
+	}
+	if !validName(name) {
+		return e.InvalidUsername
+	}
+	if slices.Contains(reservedUsernames, name) || slices.Contains(c.Registration.Reserved, name) {
+		return e.ReservedUsername
+	}
+	return nil
+}
+
+// validName reports whether name is lowercase letters, digits, ".", "_" and "-",
+// starting with a letter or digit, so it can never be read as a path.
+func validName(name string) bool {
+	for i, ch := range name {
+		alnum := ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9'
+		if !alnum && (i == 0 || ch != '.' && ch != '_' && ch != '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// registrationSetting is the store setting holding the mode an admin switched to.
+const registrationSetting = "registration.mode"
+
+// RegistrationMode returns the mode in force, the configured one unless an admin
+// has switched it.
+func (refs *ServerRefs) RegistrationMode() RegistrationMode {
+	v, _ := refs.Store.GetSetting(registrationSetting)
+	if m := RegistrationMode(v); m.Validate() == nil {
+		return m
+	}
+	return refs.Config.Registration.Mode
+}
+
+// SetRegistrationMode switches the mode. The switch is kept in the store, so it
+// outlasts restarts and overrides the configured mode until switched again.
+func (refs *ServerRefs) SetRegistrationMode(m RegistrationMode) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	return refs.Store.SetSetting(registrationSetting, string(m))
+}
+
+// InviteCode is handed to the admin who mints an invite. The code itself is never
+// stored and cannot be recovered afterwards.
+type InviteCode struct {
+	ID      string    `json:"id"`
+	Code    string    `json:"code"`
+	Expires time.Time `json:"expires"`
+}
+
+// NewInvite mints a single use invite that expires after ttl, or the configured
+// invite ttl when ttl is zero.
+func (refs *ServerRefs) NewInvite(admin string, ttl time.Duration) (InviteCode, error) {
+	if ttl <= 0 {
+		ttl = refs.Config.Registration.InviteTTL
+	}
+	id, err := vault.GenerateRandBytes(8)
+	if err != nil {
+		return InviteCode{}, err
+	}
+	code, err := vault.GenerateRandBytes(24)
+	if err != nil {
+		return InviteCode{}, err
+	}
+	ic := InviteCode{
+		ID:      hex.EncodeToString(id),
+		Code:    base64.RawURLEncoding.EncodeToString(code),
+		Expires: time.Now().Add(ttl).Truncate(time.Second),
+	}
+	invite := store.Invite{ID: ic.ID, Hash: hashInvite(ic.Code), CreatedBy: admin, Expires: ic.Expires.Unix()}
+	return ic, refs.Store.AddInvite(invite)
+}
+
+// RedeemInvite uses up the invite for code. Expired invites are removed as they
+// are found and count as invalid.
+func (refs *ServerRefs) RedeemInvite(code string, now time.Time) (store.Invite, error) {
+	invite, ok := refs.Store.TakeInvite(hashInvite(code))
+	if !ok || now.Unix() >= invite.Expires {
+		return store.Invite{}, e.InvalidInvite
+	}
+	return invite, nil
+}
+
+// hashInvite is the form an invite code is stored and looked up in.
+func hashInvite(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -2,14 +2,23 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/vault"
 )
 
 const staticServerError = `{"code":500,"error":"Internal Server Error"}`
 
+// kdfRetryAfter is the number of seconds a client is asked to wait when key
+// derivation is saturated, roughly the cost of a couple of derivations.
+const kdfRetryAfter = 1
+
 type Response struct {
 	Code  int    `json:"code"`
 	Data  any    `json:"data,omitempty"`
@@ -49,6 +58,24 @@ func NewCredentialError() Response {
 	return NewClientError(e.IncorrectCredentials)
 }
 
+// SendTooManyAttempts responds with a 429 telling the client when it may retry.
+func SendTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	secs := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	JSONResponse(w, NewResponse(http.StatusTooManyRequests, nil, e.TooManyAttempts))
+}
+
+// SendKDFError responds to a failed key derivation, telling the client to back
+// off with a 503 when the scheduler was too busy to run it.
+func SendKDFError(w http.ResponseWriter, err error) {
+	if errors.Is(err, vault.ErrKDFSaturated) || errors.Is(err, vault.ErrKDFTimeout) {
+		w.Header().Set("Retry-After", strconv.Itoa(kdfRetryAfter))
+		JSONResponse(w, NewResponse(http.StatusServiceUnavailable, nil, err))
+		return
+	}
+	JSONResponse(w, NewServerError(err))
+}
+
 func NewServerError(reason error) Response {
 	return NewResponse(500, nil, reason)
 }
@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/jdpolicano/govault/internal/server"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+)
+
+// UnlockRequest names an account ("user") or client address ("address") whose
+// failed login attempts should be forgotten.
+type UnlockRequest struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// HTTP handler function for listing accounts and addresses with failed logins on record.
+func LockoutsHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		server.JSONResponse(w, server.NewServerSuccess(refs.Guard.Snapshot()))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "admin.lockouts.list"),
+		middleware.ValidateToken(refs),
+		middleware.RequireAdmin(refs),
+	)
+}
+
+// HTTP handler function for lifting a lockout before it expires.
+func UnlockHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		body := req.Context().Value(server.BodyKey{}).(UnlockRequest)
+		if body.Kind != "user" && body.Kind != "address" {
+			server.JSONResponse(w, server.NewInvalidBodyError())
+			return
+		}
+		if !refs.Guard.Clear(body.Kind, body.Name) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		server.JSONResponse(w, server.NewResponse(http.StatusOK, "OK", nil))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "admin.lockouts.clear"),
+		middleware.ValidateToken(refs),
+		middleware.RequireAdmin(refs),
+		middleware.ParseJSONBody[UnlockRequest](refs),
+	)
+}
@@ -0,0 +1,137 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/server"
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+	"github.com/jdpolicano/govault/internal/store"
+)
+
+// RegistrationRequest switches the registration mode: "open", "invite" or "disabled".
+type RegistrationRequest struct {
+	Mode server.RegistrationMode `json:"mode"`
+}
+
+// InviteRequest mints an invite. TTL is a Go duration string and defaults to the
+// configured invite ttl.
+type InviteRequest struct {
+	TTL string `json:"ttl"`
+}
+
+// InviteInfo is the admin view of an unused invite, without its code.
+type InviteInfo struct {
+	ID        string    `json:"id"`
+	CreatedBy string    `json:"created_by"`
+	Expires   time.Time `json:"expires"`
+}
+
+// HTTP handler function for switching the registration mode. The setting is kept
+// in the store, so it survives restarts and overrides the configured mode.
+func RegistrationHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		body := req.Context().Value(server.BodyKey{}).(RegistrationRequest)
+		err := refs.SetRegistrationMode(body.Mode)
+		if errors.Is(err, e.InvalidRegistrationMode) {
+			server.JSONResponse(w, server.NewClientError(err))
+			return
+		}
+		if err != nil {
+			refs.Log.ErrorContext(req.Context(), "saving registration mode", "err", err)
+			server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+			return
+		}
+		server.JSONResponse(w, server.NewServerSuccess(RegistrationRequest{refs.RegistrationMode()}))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "admin.registration"),
+		middleware.ValidateToken(refs),
+		middleware.RequireAdmin(refs),
+		middleware.ParseJSONBody[RegistrationRequest](refs),
+	)
+}
+
+// HTTP handler function for minting a single use invite. The code is only ever
+// shown in this response.
+func CreateInviteHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(InviteRequest)
+
+		var ttl time.Duration
+		if body.TTL != "" {
+			parsed, err := time.ParseDuration(body.TTL)
+			if err != nil || parsed <= 0 {
+				server.JSONResponse(w, server.NewInvalidBodyError())
+				return
+			}
+			ttl = parsed
+		}
+		invite, err := refs.NewInvite(sess.User, ttl)
+		if err != nil {
+			refs.Log.ErrorContext(req.Context(), "creating invite", "err", err)
+			server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+			return
+		}
+		server.JSONResponse(w, server.NewServerSuccess(invite))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "admin.invites.create"),
+		middleware.ValidateToken(refs),
+		middleware.RequireAdmin(refs),
+		middleware.ParseJSONBody[InviteRequest](refs),
+	)
+}
+
+// HTTP handler function for listing unused invites.
+func InvitesHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		invites := refs.Store.ListInvites()
+		infos := make([]InviteInfo, 0, len(invites))
+		for _, invite := range invites {
+			infos = append(infos, InviteInfo{invite.ID, invite.CreatedBy, time.Unix(invite.Expires, 0)})
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Expires.Before(infos[j].Expires) })
+		server.JSONResponse(w, server.NewServerSuccess(infos))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "admin.invites.list"),
+		middleware.ValidateToken(refs),
+		middleware.RequireAdmin(refs),
+	)
+}
+
+// HTTP handler function for withdrawing an unused invite.
+func RevokeInviteHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		body := req.Context().Value(server.BodyKey{}).(InviteInfo)
+		err := refs.Store.DeleteInvite(body.ID)
+		switch {
+		case errors.As(err, new(store.NoSuchInviteError)):
+			server.JSONResponse(w, server.NewResponse(http.StatusNotFound, nil, err))
+		case err != nil:
+			refs.Log.ErrorContext(req.Context(), "revoking invite", "err", err)
+			server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+		default:
+			server.JSONResponse(w, server.NewResponse(http.StatusOK, "OK", nil))
+		}
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "admin.invites.revoke"),
+		middleware.ValidateToken(refs),
+		middleware.RequireAdmin(refs),
+		middleware.ParseJSONBody[InviteInfo](refs),
+	)
+}
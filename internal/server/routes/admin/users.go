@@ -0,0 +1,164 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/jdpolicano/govault/internal/server"
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+)
+
+// UserRequest names the account an admin operation acts on.
+type UserRequest struct {
+	User string `json:"user"`
+}
+
+// AdminRequest promotes a user to administrator or demotes them.
+type AdminRequest struct {
+	User  string `json:"user"`
+	Admin bool   `json:"admin"`
+}
+
+// UserInfo is the admin view of an account, without any key material.
+type UserInfo struct {
+	Name     string   `json:"name"`
+	Admin    bool     `json:"admin,omitempty"`
+	Disabled bool     `json:"disabled,omitempty"`
+	TOTP     bool     `json:"totp,omitempty"` // whether a second factor is enabled
+	Policies []string `json:"policies,omitempty"`
+}
+
+// HTTP handler function for listing every account.
+func UsersHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		users := refs.Store.ListUsers()
+		infos := make([]UserInfo, 0, len(users))
+		for _, u := range users {
+			infos = append(infos, UserInfo{
+				Name:     u.Name,
+				Admin:    refs.IsAdmin(u.Name),
+				Disabled: u.Disabled,
+				TOTP:     server.HasSecondFactor(u),
+				Policies: u.Policies,
+			})
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+		server.JSONResponse(w, server.NewServerSuccess(infos))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "admin.users.list"),
+		middleware.ValidateToken(refs),
+		middleware.RequireAdmin(refs),
+	)
+}
+
+// HTTP handler function for stopping a user from logging in, ending their sessions.
+func DisableUserHandler(refs *server.ServerRefs) http.HandlerFunc {
+	return userAction(refs, "admin.users.disable", func(sess server.Session, body UserRequest) (any, error) {
+		if body.User == sess.User {
+			return nil, e.SelfAdminAction
+		}
+		return "OK", refs.DisableUser(body.User, true)
+	})
+}
+
+// HTTP handler function for letting a disabled user log in again.
+func EnableUserHandler(refs *server.ServerRefs) http.HandlerFunc {
+	return userAction(refs, "admin.users.enable", func(sess server.Session, body UserRequest) (any, error) {
+		return "OK", refs.DisableUser(body.User, false)
+	})
+}
+
+// HTTP handler function for revoking every session of a user. The response is
+// the number of sessions revoked.
+func LogoutUserHandler(refs *server.ServerRefs) http.HandlerFunc {
+	return userAction(refs, "admin.users.logout", func(sess server.Session, body UserRequest) (any, error) {
+		if !refs.Store.HasUser(body.User) {
+			return nil, e.NewNoSuchUserError(body.User)
+		}
+		return refs.Logout(body.User), nil
+	})
+}
+
+// HTTP handler function for deleting a user along with their secrets.
+func DeleteUserHandler(refs *server.ServerRefs) http.HandlerFunc {
+	return userAction(refs, "admin.users.delete", func(sess server.Session, body UserRequest) (any, error) {
+		if body.User == sess.User {
+			return nil, e.SelfAdminAction
+		}
+		return "OK", refs.DeleteUser(body.User)
+	})
+}
+
+// HTTP handler function for promoting or demoting an administrator. Admins named
+// in config stay admins whatever is set here.
+func SetAdminHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(AdminRequest)
+		server.NoteAuditTarget(req, body.User)
+		if body.User == sess.User && !body.Admin {
+			routeUserError(refs, w, req, e.SelfAdminAction)
+			return
+		}
+		user, exists := refs.Store.GetUserInfo(body.User)
+		if !exists {
+			routeUserError(refs, w, req, e.NewNoSuchUserError(body.User))
+			return
+		}
+		user.Admin = body.Admin
+		if err := refs.Store.UpdateUser(user); err != nil {
+			routeUserError(refs, w, req, err)
+			return
+		}
+		server.JSONResponse(w, server.NewResponse(http.StatusOK, "OK", nil))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "admin.users.admin"),
+		middleware.ValidateToken(refs),
+		middleware.RequireAdmin(refs),
+		middleware.ParseJSONBody[AdminRequest](refs),
+	)
+}
+
+// userAction builds an admin route that acts on the user named in the body,
+// recording them as the target in the audit log.
+func userAction(refs *server.ServerRefs, op string, act func(server.Session, UserRequest) (any, error)) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(UserRequest)
+		server.NoteAuditTarget(req, body.User)
+		data, err := act(sess, body)
+		if err != nil {
+			routeUserError(refs, w, req, err)
+			return
+		}
+		server.JSONResponse(w, server.NewServerSuccess(data))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, op),
+		middleware.ValidateToken(refs),
+		middleware.RequireAdmin(refs),
+		middleware.ParseJSONBody[UserRequest](refs),
+	)
+}
+
+func routeUserError(refs *server.ServerRefs, w http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, e.SelfAdminAction):
+		server.JSONResponse(w, server.NewClientError(err))
+	case errors.Is(err, e.NoSuchUser):
+		server.JSONResponse(w, server.NewResponse(http.StatusNotFound, nil, err))
+	default:
+		refs.Log.ErrorContext(req.Context(), "user operation", "err", err)
+		server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+	}
+}
@@ -0,0 +1,241 @@
+package approle
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/server"
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+	"github.com/jdpolicano/govault/internal/store"
+)
+
+// CreateRequest describes a new machine identity. TTL is a Go duration string
+// for sessions the role logs in to and defaults to the server's session ttl.
+type CreateRequest struct {
+	Paths    []string `json:"paths"`
+	ReadOnly bool     `json:"read_only"`
+	CIDRs    []string `json:"cidrs"`
+	TTL      string   `json:"ttl"`
+	Policies []string `json:"policies"` // limits the role to some of the caller's policies, all of them when empty
+}
+
+// RoleRequest names an existing role owned by the caller.
+type RoleRequest struct {
+	RoleID string `json:"role_id"`
+}
+
+// LoginRequest exchanges role credentials for a session.
+type LoginRequest struct {
+	RoleID   string `json:"role_id"`
+	SecretID string `json:"secret_id"`
+}
+
+// RoleInfo is the public view of a role, without its secret material.
+type RoleInfo struct {
+	RoleID   string   `json:"role_id"`
+	Paths    []string `json:"paths,omitempty"`
+	ReadOnly bool     `json:"read_only,omitempty"`
+	CIDRs    []string `json:"cidrs,omitempty"`
+	TTL      string   `json:"ttl"`
+	Policies []string `json:"policies,omitempty"`
+}
+
+// HTTP handler function for issuing a new role id and secret id to the caller.
+// Roles are managed from password logins only, so a role or a scoped token can't
+// issue itself a role without its network binding or with a longer ttl.
+func CreateHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(CreateRequest)
+
+		ttl := refs.Config.DefaultTTL
+		if body.TTL != "" {
+			parsed, err := time.ParseDuration(body.TTL)
+			if err != nil || parsed <= 0 {
+				server.JSONResponse(w, server.NewInvalidBodyError())
+				return
+			}
+			ttl = parsed
+		}
+
+		policies, err := refs.LimitPolicies(sess, body.Policies)
+		var role store.Role
+		var creds server.RoleCredentials
+		if err == nil {
+			scope := server.Scope{Paths: body.Paths, ReadOnly: body.ReadOnly, Policies: policies}
+			role, creds, err = server.NewRole(sess, scope, body.CIDRs, ttl)
+		}
+		if err != nil {
+			routeRoleError(w, err)
+			return
+		}
+		if err := refs.Store.SetRole(role); err != nil {
+			refs.Log.ErrorContext(req.Context(), "saving role", "user", sess.User, "err", err)
+			server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+			return
+		}
+		server.JSONResponse(w, server.NewServerSuccess(creds))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "approle.create"),
+		middleware.ValidateToken(refs),
+		middleware.RequireUserSession(),
+		middleware.ParseJSONBody[CreateRequest](refs),
+	)
+}
+
+// HTTP handler function for replacing a role's secret id.
+func RotateHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(RoleRequest)
+
+		role, exists := refs.Store.GetRole(body.RoleID)
+		if !exists || role.Owner != sess.User {
+			routeRoleError(w, store.NewNoSuchRoleError(body.RoleID))
+			return
+		}
+		if _, err := sess.Scope.Narrow(server.RoleScope(role)); err != nil {
+			routeRoleError(w, err)
+			return
+		}
+
+		role, creds, err := server.RotateRoleSecret(sess, role)
+		if err != nil {
+			routeRoleError(w, err)
+			return
+		}
+		if err := refs.Store.SetRole(role); err != nil {
+			refs.Log.ErrorContext(req.Context(), "rotating role", "user", sess.User, "role", role.ID, "err", err)
+			server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+			return
+		}
+		server.JSONResponse(w, server.NewServerSuccess(creds))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "approle.rotate"),
+		middleware.ValidateToken(refs),
+		middleware.RequireUserSession(),
+		middleware.ParseJSONBody[RoleRequest](refs),
+	)
+}
+
+// HTTP handler function for deleting a role and ending its sessions.
+func RevokeHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(RoleRequest)
+
+		if err := refs.Store.DeleteRole(sess.User, body.RoleID); err != nil {
+			routeRoleError(w, err)
+			return
+		}
+		refs.Sessions.Revoke(func(s server.Session) bool {
+			return s.Role == body.RoleID
+		})
+		server.JSONResponse(w, server.NewResponse(http.StatusOK, "OK", nil))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "approle.revoke"),
+		middleware.ValidateToken(refs),
+		middleware.RequireUserSession(),
+		middleware.ParseJSONBody[RoleRequest](refs),
+	)
+}
+
+// HTTP handler function for listing the caller's roles.
+func ListHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		roles := refs.Store.ListRoles(sess.User)
+		infos := make([]RoleInfo, 0, len(roles))
+		for _, r := range roles {
+			infos = append(infos, RoleInfo{
+				RoleID:   r.ID,
+				Paths:    r.Paths,
+				ReadOnly: r.ReadOnly,
+				CIDRs:    r.CIDRs,
+				TTL:      (time.Duration(r.TTL) * time.Second).String(),
+				Policies: r.Policies,
+			})
+		}
+		server.JSONResponse(w, server.NewServerSuccess(infos))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "approle.list"),
+		middleware.ValidateToken(refs),
+	)
+}
+
+// HTTP handler function for exchanging a role id and secret id for a scoped session.
+func LoginHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		body := req.Context().Value(server.BodyKey{}).(LoginRequest)
+		account, addr := "role:"+body.RoleID, server.RequestAddr(req)
+
+		if wait := refs.Guard.Check(account, addr); wait > 0 {
+			server.SendTooManyAttempts(w, wait)
+			return
+		}
+
+		role, exists := refs.Store.GetRole(body.RoleID)
+		if !exists {
+			refs.Guard.Fail(account, addr)
+			server.JSONResponse(w, server.NewClientError(e.IncorrectRoleCredentials))
+			return
+		}
+
+		key, err := server.OpenRole(role, body.SecretID, req.RemoteAddr)
+		if err != nil {
+			refs.Guard.Fail(account, addr)
+			routeRoleError(w, err)
+			return
+		}
+		refs.Guard.Succeed(account, addr)
+		server.NoteAuditUser(req, role.Owner)
+		if owner, _ := refs.Store.GetUserInfo(role.Owner); owner.Disabled {
+			server.JSONResponse(w, server.NewResponse(http.StatusForbidden, nil, e.AccountDisabled))
+			return
+		}
+
+		sess := server.NewSession(role.Owner, key, time.Duration(role.TTL)*time.Second)
+		sess.Scope = server.RoleScope(role)
+		sess.Role = role.ID
+		token, err := refs.Sessions.CreateSession(sess)
+		if err != nil {
+			server.JSONResponse(w, server.NewServerError(err))
+			return
+		}
+		server.SendToken(w, token)
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "approle.login"),
+		middleware.ParseJSONBody[LoginRequest](refs),
+	)
+}
+
+// routeRoleError handles the different errors issuing and using roles can produce.
+func routeRoleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, e.ScopeEscalation), errors.Is(err, e.AddressNotAllowed):
+		server.JSONResponse(w, server.NewResponse(http.StatusForbidden, nil, err))
+	case errors.Is(err, e.InvalidCIDR), errors.Is(err, e.IncorrectRoleCredentials):
+		server.JSONResponse(w, server.NewClientError(err))
+	case errors.As(err, new(store.NoSuchRoleError)):
+		server.JSONResponse(w, server.NewResponse(http.StatusNotFound, nil, err))
+	default:
+		server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+	}
+}
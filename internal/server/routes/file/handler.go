@@ -0,0 +1,181 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/jdpolicano/govault/internal/server"
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+	"github.com/jdpolicano/govault/internal/store"
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+// ModeHeader carries the permissions of a downloaded file, in octal.
+const ModeHeader = "X-Govault-File-Mode"
+
+// FileRequest names the secret a file is uploaded to or downloaded from, and
+// the permissions of an uploaded file. It is read from the query string, as in
+// /file/put?key=tls/server.key&mode=0600, since the body is the file itself.
+type FileRequest struct {
+	Key  string
+	Mode fs.FileMode
+}
+
+func (r FileRequest) SecretKey() string {
+	return r.Key
+}
+
+// HTTP handler function for storing the application/octet-stream body of the
+// request as a binary secret. The body is encrypted as it arrives and streamed
+// into the store, so files may be as large as MaxFileSize without being held in
+// memory.
+func UploadHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(FileRequest)
+		if media, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); media != "application/octet-stream" {
+			server.JSONResponse(w, server.NewResponse(http.StatusUnsupportedMediaType, nil, e.OctetStreamRequired))
+			return
+		}
+		if !store.ValidKey(body.Key) {
+			server.JSONResponse(w, server.NewClientError(e.InvalidSecretPath))
+			return
+		}
+		sealed, pw := io.Pipe()
+		read := make(chan error, 1)
+		go func() {
+			read <- sealBody(pw, sess.Key, http.MaxBytesReader(w, req.Body, refs.Config.MaxFileSize))
+		}()
+		meta := store.Metadata{UpdatedBy: sess.ID, Type: store.TypeBinary, Mode: body.Mode}
+		err := refs.Store.SetStream(sess.User, body.Key, sealed, meta)
+		// unblock the body being sealed if the store gave up before reading it all.
+		sealed.Close()
+		if readErr := <-read; readErr != nil && !errors.Is(readErr, io.ErrClosedPipe) {
+			if errors.As(readErr, new(*http.MaxBytesError)) {
+				server.JSONResponse(w, server.NewResponse(http.StatusRequestEntityTooLarge, nil, e.SecretTooLarge))
+				return
+			}
+			server.JSONResponse(w, server.NewInvalidBodyError())
+			return
+		}
+		if err != nil {
+			refs.Log.ErrorContext(req.Context(), "storing file", "user", sess.User, "err", err)
+			server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+			return
+		}
+		server.JSONResponse(w, server.NewResponse(http.StatusOK, "OK", nil))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "file.put"),
+		middleware.ValidateToken(refs),
+		parseQuery(),
+		middleware.Authorize(refs, server.CapWrite),
+	)
+}
+
+// HTTP handler function for downloading a secret as application/octet-stream,
+// with the permissions it was uploaded with in the ModeHeader. Streamed files
+// are decrypted as they are sent.
+func DownloadHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(FileRequest)
+		cipher, exists := refs.Store.Get(sess.User, body.Key)
+		if !exists {
+			server.JSONResponse(w, server.NewResponse(http.StatusNotFound, nil, e.NoSuchSecret))
+			return
+		}
+		var plain io.Reader
+		if cipher.Blob == "" {
+			value, err := vault.Decrypt(cipher.Nonce, sess.Key, cipher.Text)
+			if err != nil {
+				refs.Log.ErrorContext(req.Context(), "decrypting file", "user", sess.User, "err", err)
+				server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+				return
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+			plain = bytes.NewReader(value)
+		} else {
+			stream, err := refs.OpenSecretStream(sess, body.Key)
+			if err != nil {
+				refs.Log.ErrorContext(req.Context(), "opening file", "user", sess.User, "err", err)
+				server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+				return
+			}
+			defer stream.Close()
+			// the first chunk is opened before anything is sent, so a file that
+			// is corrupt from the start still gets an error response.
+			buffered := bufio.NewReaderSize(stream, vault.StreamChunkSize)
+			if _, err := buffered.Peek(1); err != nil && err != io.EOF {
+				refs.Log.ErrorContext(req.Context(), "decrypting file", "user", sess.User, "err", err)
+				server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+				return
+			}
+			plain = buffered
+		}
+		if meta, _ := refs.Store.GetMetadata(sess.User, body.Key); meta.Mode != 0 {
+			w.Header().Set(ModeHeader, fmt.Sprintf("%04o", meta.Mode.Perm()))
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if _, err := io.Copy(w, plain); err != nil {
+			// the status has been sent, so the client is only told by the
+			// response being cut short.
+			refs.Log.ErrorContext(req.Context(), "streaming file", "user", sess.User, "err", err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "file.get"),
+		middleware.ValidateToken(refs),
+		parseQuery(),
+		middleware.Authorize(refs, server.CapRead),
+	)
+}
+
+// sealBody encrypts body with key onto pw, closing pw with the error that ended
+// the copy, and returns that error.
+func sealBody(pw *io.PipeWriter, key []byte, body io.Reader) error {
+	stream, err := vault.NewStreamWriter(key, pw)
+	if err == nil {
+		if _, err = io.Copy(stream, body); err == nil {
+			err = stream.Close()
+		}
+	}
+	pw.CloseWithError(err)
+	return err
+}
+
+// parseQuery reads a FileRequest from the query string and stores it on the
+// context the way middleware.ParseJSONBody stores a json body.
+func parseQuery() middleware.Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			body := FileRequest{Key: query.Get("key")}
+			if v := query.Get("mode"); v != "" {
+				mode, err := strconv.ParseUint(v, 8, 32)
+				if err != nil || fs.FileMode(mode) != fs.FileMode(mode).Perm() {
+					server.JSONResponse(w, server.NewClientError(e.InvalidFileMode))
+					return
+				}
+				body.Mode = fs.FileMode(mode)
+			}
+			server.NoteAuditKey(r, body.Key)
+			r = r.WithContext(context.WithValue(r.Context(), server.BodyKey{}, body))
+			next(w, r)
+		}
+	}
+}
@@ -1,16 +1,42 @@
 package get
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/jdpolicano/govault/internal/server"
 	e "github.com/jdpolicano/govault/internal/server/errors"
 	"github.com/jdpolicano/govault/internal/server/middleware"
-	"github.com/jdpolicano/govault/internal/vault"
+	"github.com/jdpolicano/govault/internal/store"
 )
 
+// GetRequest reads a secret, or the field named by Field of a structured secret.
+// A key such as "db/prod#password" is shorthand for the field, unless a secret is
+// stored under the whole key, as keys holding "#" could be before it picked a
+// field. With Metadata the response is a SecretInfo rather than just the value.
 type GetRequest struct {
-	Key string `json:"key"`
+	Key      string `json:"key"`
+	Field    string `json:"field,omitempty"`
+	Metadata bool   `json:"metadata,omitempty"`
+}
+
+// SecretInfo is a secret's value along with its metadata. The value is text,
+// json for a structured secret or a field of one, or base64 for a binary one.
+type SecretInfo struct {
+	Value    any            `json:"value"`
+	Metadata store.Metadata `json:"metadata"`
+}
+
+// SecretKey is the secret's path, since fields are read with the access granted
+// to the whole secret.
+func (r GetRequest) SecretKey() string {
+	if r.Field != "" {
+		return r.Key
+	}
+	path, _ := server.SplitField(r.Key)
+	return path
 }
 
 func Handler(refs *server.ServerRefs) http.HandlerFunc {
@@ -18,25 +44,69 @@ func Handler(refs *server.ServerRefs) http.HandlerFunc {
 		sess := req.Context().Value(server.SessionKey{}).(server.Session)
 		body := req.Context().Value(server.BodyKey{}).(GetRequest)
 
-		cipher, exists := refs.Store.Get(sess.User, body.Key)
+		path, field := body.Key, body.Field
+		cipher, exists := refs.Store.Get(sess.User, path)
+		if field == "" && strings.Contains(path, server.FieldSeparator) {
+			if exists {
+				// the secret's own key, which was only authorized up to the "#".
+				if err := refs.AuthorizeKey(sess, server.CapRead, path); err != nil {
+					server.WriteAuthError(w, err)
+					return
+				}
+			} else {
+				path, field = server.SplitField(body.Key)
+				cipher, exists = refs.Store.Get(sess.User, path)
+			}
+		}
 		if !exists {
 			http.Error(w, "not found", http.StatusNotFound)
 			return
 		}
 
-		plain, err := vault.Decrypt(cipher.Nonce, sess.Key, cipher.Text)
+		plain, err := refs.ReadSecret(sess, path, cipher)
+		if errors.Is(err, e.SecretTooLarge) {
+			// the secret is fine, it just has to be streamed.
+			server.JSONResponse(w, server.NewResponse(http.StatusUnprocessableEntity, nil, e.UseFileRoute))
+			return
+		}
 		if err != nil {
-			refs.Log.Printf("err decrypting key %s", err)
+			refs.Log.ErrorContext(req.Context(), "decrypting secret", "user", sess.User, "err", err)
 			http.Error(w, e.UnexpectedServerError.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		server.JSONResponse(w, server.NewResponse(http.StatusOK, string(plain), nil))
+		meta, _ := refs.Store.GetMetadata(sess.User, path)
+		var value any = string(plain)
+		switch meta.Type {
+		case store.TypeObject:
+			value = json.RawMessage(plain)
+		case store.TypeBinary:
+			value = plain // base64 in json, see the file routes for the raw bytes or larger files
+		}
+		if field != "" {
+			fields, err := server.ParseObject(plain)
+			if meta.Type != store.TypeObject || err != nil {
+				server.JSONResponse(w, server.NewClientError(e.NotAnObject))
+				return
+			}
+			if value, exists = fields[field]; !exists {
+				server.JSONResponse(w, server.NewResponse(http.StatusNotFound, nil, e.NoSuchField))
+				return
+			}
+		}
+
+		if body.Metadata {
+			server.JSONResponse(w, server.NewServerSuccess(SecretInfo{value, meta}))
+			return
+		}
+		server.JSONResponse(w, server.NewResponse(http.StatusOK, value, nil))
 	}
 
 	return middleware.Chain(handle,
 		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "get"),
 		middleware.ValidateToken(refs),
-		middleware.ParseJSONBody[GetRequest](),
+		middleware.ParseJSONBody[GetRequest](refs),
+		middleware.Authorize(refs, server.CapRead),
 	)
 }
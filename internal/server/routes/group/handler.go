@@ -0,0 +1,332 @@
+package group
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/jdpolicano/govault/internal/server"
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+	"github.com/jdpolicano/govault/internal/store"
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+// CreateRequest names a new group.
+type CreateRequest struct {
+	Group string `json:"group"`
+}
+
+// MemberRequest adds a user to or removes a user from a group.
+type MemberRequest struct {
+	Group string `json:"group"`
+	User  string `json:"user"`
+	Admin bool   `json:"admin"` // whether an added member may manage members
+}
+
+type GetRequest struct {
+	Group string `json:"group"`
+	Key   string `json:"key"`
+}
+
+func (r GetRequest) SecretKey() string {
+	return server.GroupPath(r.Group, r.Key)
+}
+
+type SetRequest struct {
+	Group string `json:"group"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func (r SetRequest) SecretKey() string {
+	return server.GroupPath(r.Group, r.Key)
+}
+
+// GroupInfo is the public view of a group, without any key material.
+type GroupInfo struct {
+	Name     string       `json:"name"`
+	Epoch    int          `json:"epoch"`
+	Members  []MemberInfo `json:"members"`
+	Policies []string     `json:"policies,omitempty"` // granted to every member
+}
+
+type MemberInfo struct {
+	User  string `json:"user"`
+	Admin bool   `json:"admin,omitempty"`
+}
+
+// HTTP handler function for creating a group with the caller as its admin.
+func CreateHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(CreateRequest)
+		if body.Group == "" {
+			server.JSONResponse(w, server.NewClientError(e.MissingGroup))
+			return
+		}
+
+		user, _ := refs.Store.GetUserInfo(sess.User)
+		if err := refs.EnsureKeyPair(&user, sess.Key); err != nil {
+			refs.Log.ErrorContext(req.Context(), "creating key pair", "user", sess.User, "err", err)
+			server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+			return
+		}
+		group, err := server.NewGroup(body.Group, user)
+		if err == nil {
+			err = refs.Store.AddGroup(group)
+		}
+		if err != nil {
+			routeGroupError(refs, w, req, err)
+			return
+		}
+		server.JSONResponse(w, server.NewServerSuccess(groupInfo(group)))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "group.create"),
+		middleware.ValidateToken(refs),
+		middleware.RequireUserSession(),
+		middleware.ParseJSONBody[CreateRequest](refs),
+	)
+}
+
+// HTTP handler function for listing the groups the caller belongs to.
+func ListHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		groups := refs.Store.ListGroups(sess.User)
+		infos := make([]GroupInfo, 0, len(groups))
+		for _, group := range groups {
+			infos = append(infos, groupInfo(group))
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+		server.JSONResponse(w, server.NewServerSuccess(infos))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "group.list"),
+		middleware.ValidateToken(refs),
+		middleware.RequireUserSession(),
+	)
+}
+
+// HTTP handler function for adding a member. The group key is wrapped to the
+// new member's public key, so they must have logged in since groups existed.
+func AddMemberHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(MemberRequest)
+
+		group, caller, ok := adminGroup(refs, w, req, sess, body.Group)
+		if !ok {
+			return
+		}
+		member, exists := refs.Store.GetUserInfo(body.User)
+		if !exists {
+			server.JSONResponse(w, server.NewNoSuchUserError(body.User))
+			return
+		}
+		groupKey, err := server.OpenGroupKey(group, caller, sess.Key)
+		if err != nil {
+			routeGroupError(refs, w, req, err)
+			return
+		}
+		defer clear(groupKey)
+		err = server.AddGroupMember(&group, member, groupKey, body.Admin)
+		if err == nil {
+			err = refs.Store.UpdateGroup(group)
+		}
+		if err != nil {
+			routeGroupError(refs, w, req, err)
+			return
+		}
+		server.JSONResponse(w, server.NewServerSuccess(groupInfo(group)))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "group.members.add"),
+		middleware.ValidateToken(refs),
+		middleware.RequireUserSession(),
+		middleware.ParseJSONBody[MemberRequest](refs),
+	)
+}
+
+// HTTP handler function for removing a member, or leaving a group when the
+// caller names themselves. The group key is replaced and every secret
+// re-encrypted so the departed member's copy of the key opens nothing.
+func RemoveMemberHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(MemberRequest)
+
+		var group store.Group
+		var caller store.User
+		var ok bool
+		if body.User == sess.User {
+			group, caller, ok = memberGroup(refs, w, req, sess, body.Group)
+		} else {
+			group, caller, ok = adminGroup(refs, w, req, sess, body.Group)
+		}
+		if !ok {
+			return
+		}
+		groupKey, err := server.OpenGroupKey(group, caller, sess.Key)
+		if err != nil {
+			routeGroupError(refs, w, req, err)
+			return
+		}
+		defer clear(groupKey)
+		err = server.RemoveGroupMember(&group, body.User, groupKey, refs.Store.GetUserInfo)
+		if err == nil {
+			err = refs.Store.UpdateGroup(group)
+		}
+		if err != nil {
+			routeGroupError(refs, w, req, err)
+			return
+		}
+		server.JSONResponse(w, server.NewServerSuccess(groupInfo(group)))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "group.members.remove"),
+		middleware.ValidateToken(refs),
+		middleware.RequireUserSession(),
+		middleware.ParseJSONBody[MemberRequest](refs),
+	)
+}
+
+// HTTP handler function for reading a group secret.
+func GetHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(GetRequest)
+
+		group, caller, ok := memberGroup(refs, w, req, sess, body.Group)
+		if !ok {
+			return
+		}
+		cipher, exists := group.Secrets[body.Key]
+		if !exists {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		groupKey, err := server.OpenGroupKey(group, caller, sess.Key)
+		if err != nil {
+			routeGroupError(refs, w, req, err)
+			return
+		}
+		defer clear(groupKey)
+		plain, err := vault.Decrypt(cipher.Nonce, groupKey, cipher.Text)
+		if err != nil {
+			routeGroupError(refs, w, req, err)
+			return
+		}
+		server.JSONResponse(w, server.NewResponse(http.StatusOK, string(plain), nil))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "group.get"),
+		middleware.ValidateToken(refs),
+		middleware.ParseJSONBody[GetRequest](refs),
+		middleware.Authorize(refs, server.CapRead),
+	)
+}
+
+// HTTP handler function for writing a group secret.
+func SetHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(SetRequest)
+
+		group, caller, ok := memberGroup(refs, w, req, sess, body.Group)
+		if !ok {
+			return
+		}
+		groupKey, err := server.OpenGroupKey(group, caller, sess.Key)
+		if err != nil {
+			routeGroupError(refs, w, req, err)
+			return
+		}
+		defer clear(groupKey)
+		text, nonce, err := vault.EncryptBytes(groupKey, []byte(body.Value))
+		if err == nil {
+			// refused if the key was replaced since the group was read, so nothing
+			// is ever written under a key a removed member still holds.
+			err = refs.Store.SetGroupSecret(group.Name, group.Epoch, body.Key, store.CipherText{Nonce: nonce, Text: text})
+		}
+		if err != nil {
+			routeGroupError(refs, w, req, err)
+			return
+		}
+		server.JSONResponse(w, server.NewResponse(http.StatusOK, "OK", nil))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "group.set"),
+		middleware.ValidateToken(refs),
+		middleware.ParseJSONBody[SetRequest](refs),
+		middleware.Authorize(refs, server.CapWrite),
+	)
+}
+
+// memberGroup loads the named group and the caller's user record, responding
+// with an error when the caller is not a member.
+func memberGroup(refs *server.ServerRefs, w http.ResponseWriter, req *http.Request, sess server.Session, name string) (store.Group, store.User, bool) {
+	group, exists := refs.Store.GetGroup(name)
+	if !exists {
+		routeGroupError(refs, w, req, store.NewNoSuchGroupError(name))
+		return group, store.User{}, false
+	}
+	if _, member := group.Members[sess.User]; !member {
+		// outsiders are told the same as for a group that doesn't exist.
+		routeGroupError(refs, w, req, store.NewNoSuchGroupError(name))
+		return group, store.User{}, false
+	}
+	user, _ := refs.Store.GetUserInfo(sess.User)
+	return group, user, true
+}
+
+// adminGroup is memberGroup for operations only a group admin may perform.
+func adminGroup(refs *server.ServerRefs, w http.ResponseWriter, req *http.Request, sess server.Session, name string) (store.Group, store.User, bool) {
+	group, user, ok := memberGroup(refs, w, req, sess, name)
+	if ok && !server.IsGroupAdmin(group, sess.User) {
+		routeGroupError(refs, w, req, e.GroupAdminRequired)
+		return group, user, false
+	}
+	return group, user, ok
+}
+
+func groupInfo(group store.Group) GroupInfo {
+	info := GroupInfo{Name: group.Name, Epoch: group.Epoch, Members: make([]MemberInfo, 0, len(group.Members)), Policies: group.Policies}
+	for name, m := range group.Members {
+		info.Members = append(info.Members, MemberInfo{User: name, Admin: m.Admin})
+	}
+	sort.Slice(info.Members, func(i, j int) bool { return info.Members[i].User < info.Members[j].User })
+	return info
+}
+
+func routeGroupError(refs *server.ServerRefs, w http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, e.GroupAdminRequired):
+		server.JSONResponse(w, server.NewResponse(http.StatusForbidden, nil, err))
+	case errors.Is(err, e.NoKeyPair), errors.Is(err, e.AlreadyGroupMember), errors.Is(err, e.NotGroupMember),
+		errors.Is(err, e.LastGroupAdmin), errors.Is(err, e.InvalidGroupName):
+		server.JSONResponse(w, server.NewClientError(err))
+	case errors.As(err, new(store.GroupAlreadyExistsError)):
+		server.JSONResponse(w, server.NewClientError(err))
+	case errors.As(err, new(store.NoSuchGroupError)):
+		server.JSONResponse(w, server.NewResponse(http.StatusNotFound, nil, err))
+	case errors.Is(err, store.ErrGroupChanged):
+		server.JSONResponse(w, server.NewResponse(http.StatusConflict, nil, e.GroupChanged))
+	default:
+		refs.Log.ErrorContext(req.Context(), "group operation", "err", err)
+		server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+	}
+}
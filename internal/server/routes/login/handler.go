@@ -1,12 +1,14 @@
 package login
 
 import (
-	"bytes"
+	"crypto/subtle"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/jdpolicano/govault/internal/server"
+	e "github.com/jdpolicano/govault/internal/server/errors"
 	"github.com/jdpolicano/govault/internal/server/middleware"
-	"github.com/jdpolicano/govault/internal/vault"
 )
 
 // HTTP handler function for logging in and getting a new token.
@@ -16,41 +18,93 @@ func Handler(refs *server.ServerRefs) http.HandlerFunc {
 	handle := func(w http.ResponseWriter, req *http.Request) {
 		body := req.Context().Value(server.BodyKey{}).(server.AuthCredentials)
 		username, password := body.Username, body.Password
+		addr := server.RequestAddr(req)
+		server.NoteAuditUser(req, username)
+
+		// refuse to do any work for an account or address that is locked out. Past
+		// this point the attempt is reserved and every way out must settle it.
+		if wait := refs.Guard.Check(username, addr); wait > 0 {
+			server.SendTooManyAttempts(w, wait)
+			return
+		}
+
 		// now that we have the user and password, lets check if we have a user by this name.
+		// unknown users still pay for a key derivation so they can't be told apart by timing.
 		record, exists := refs.Store.GetUserInfo(username)
+		salt := record.Salt
 		if !exists {
-			server.JSONResponse(w, server.NewNoSuchUserError(username))
-			return
+			salt = refs.Guard.DecoySalt()
 		}
 
 		// recompute the keys from the user's password and the stored salt
-		key, err := vault.NewKeyWithSalt(password, record.Salt)
+		key, err := refs.KDF.NewKeyWithSalt(req.Context(), password, salt)
 		if err != nil {
-			server.JSONResponse(w, server.NewServerError(err))
+			refs.Guard.Release(username, addr)
+			server.SendKDFError(w, err)
 			return
 		}
 
 		// if they are not the same the password is wrong...
-		if !bytes.Equal(key.Login, record.Login) {
+		if !exists || subtle.ConstantTimeCompare(key.Login, record.Login) != 1 {
+			refs.Guard.Fail(username, addr)
 			server.JSONResponse(w, server.NewCredentialError())
 			return
 		}
 
+		// only the right password learns that an account is disabled.
+		if record.Disabled {
+			refs.Guard.Release(username, addr)
+			server.JSONResponse(w, server.NewResponse(http.StatusForbidden, nil, e.AccountDisabled))
+			return
+		}
+
+		// accounts with a second factor also need a current totp or recovery code.
+		// the accepted code is burnt before the session is handed out.
+		if err := refs.BurnSecondFactor(username, key.AES, body.OTP, time.Now()); err != nil {
+			routeSecondFactorError(refs, w, req, err, username, addr)
+			return
+		}
+		// accounts from before groups existed get the key pair group keys are wrapped to.
+		if err := refs.EnsureKeyPair(&record, key.AES); err != nil {
+			refs.Log.ErrorContext(req.Context(), "creating key pair", "user", username, "err", err)
+		}
+		refs.Guard.Succeed(username, addr)
+
 		// if they are the same, create a new session with the aes key in memory and return
 		// a token to the user for future requests.
-		token, err := refs.Sessions.CreateUserSession(username, key.AES, refs.Config.DefaultTTL)
+		sess := server.NewSession(username, key.AES, refs.Config.DefaultTTL)
+		sess.EnrollOnly = server.NeedsEnrollment(refs.Config.TOTP, record)
+		token, err := refs.Sessions.CreateSession(sess)
 		if err != nil {
-			refs.Log.Printf("error creating session for user \"%s\" %s", username, err)
+			refs.Log.ErrorContext(req.Context(), "creating session", "user", username, "err", err)
 			server.JSONResponse(w, server.NewServerError(err))
 			return
 		}
 		server.SendToken(w, token)
-		refs.Log.Println("response sent")
 	}
 
 	return middleware.Chain(handle,
 		middleware.Logging(refs.Log),
-		middleware.ParseJSONBody[server.AuthCredentials](),
+		middleware.Audit(refs, "login"),
+		middleware.ParseJSONBody[server.AuthCredentials](refs),
 	)
 
 }
+
+// routeSecondFactorError responds to a rejected second factor, settling the
+// attempt. A missing code is a prompt rather than a failed guess so it does not
+// count towards a lockout.
+func routeSecondFactorError(refs *server.ServerRefs, w http.ResponseWriter, req *http.Request, err error, username, addr string) {
+	switch {
+	case errors.Is(err, e.OTPRequired):
+		refs.Guard.Release(username, addr)
+		server.JSONResponse(w, server.NewResponse(http.StatusUnauthorized, nil, err))
+	case errors.Is(err, e.IncorrectOTP):
+		refs.Guard.Fail(username, addr)
+		server.JSONResponse(w, server.NewClientError(err))
+	default:
+		refs.Guard.Release(username, addr)
+		refs.Log.ErrorContext(req.Context(), "checking second factor", "user", username, "err", err)
+		server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+	}
+}
@@ -0,0 +1,220 @@
+package policy
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+
+	"github.com/jdpolicano/govault/internal/server"
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+	"github.com/jdpolicano/govault/internal/store"
+)
+
+// NameRequest names a policy.
+type NameRequest struct {
+	Name string `json:"name"`
+}
+
+// AttachRequest replaces the policies attached to a "user", "group" or "role".
+// An empty list puts a user or role back on the default policy.
+type AttachRequest struct {
+	Kind     string   `json:"kind"`
+	Name     string   `json:"name"`
+	Policies []string `json:"policies"`
+}
+
+// ExplainRequest asks whether the caller, or as an admin another user, may use
+// a capability on a path such as "secret/prod/db".
+type ExplainRequest struct {
+	User       string            `json:"user"`
+	Capability server.Capability `json:"capability"`
+	Path       string            `json:"path"`
+}
+
+// PolicyInfo is a policy in a listing, marked when it is built in.
+type PolicyInfo struct {
+	store.Policy
+	Builtin bool `json:"builtin,omitempty"`
+}
+
+// HTTP handler function for listing every policy, built in ones included.
+func ListHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		var infos []PolicyInfo
+		for _, name := range []string{server.DefaultPolicy, server.RootPolicy} {
+			policy, _ := refs.LookupPolicy(name)
+			infos = append(infos, PolicyInfo{policy, true})
+		}
+		stored := refs.Store.ListPolicies()
+		sort.Slice(stored, func(i, j int) bool { return stored[i].Name < stored[j].Name })
+		for _, policy := range stored {
+			infos = append(infos, PolicyInfo{Policy: policy})
+		}
+		server.JSONResponse(w, server.NewServerSuccess(infos))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "policy.list"),
+		middleware.ValidateToken(refs),
+		middleware.RequireAdmin(refs),
+	)
+}
+
+// HTTP handler function for adding or replacing a policy.
+func WriteHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		body := req.Context().Value(server.BodyKey{}).(store.Policy)
+		err := server.ValidatePolicy(body)
+		if err == nil {
+			err = refs.Store.SetPolicy(body)
+		}
+		if err != nil {
+			routePolicyError(refs, w, req, err)
+			return
+		}
+		server.JSONResponse(w, server.NewResponse(http.StatusOK, "OK", nil))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "policy.write"),
+		middleware.ValidateToken(refs),
+		middleware.RequireAdmin(refs),
+		middleware.ParseJSONBody[store.Policy](refs),
+	)
+}
+
+// HTTP handler function for deleting a policy. Identities it is attached to
+// simply stop being granted anything by it.
+func DeleteHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		body := req.Context().Value(server.BodyKey{}).(NameRequest)
+		if server.IsBuiltinPolicy(body.Name) {
+			routePolicyError(refs, w, req, e.BuiltinPolicy)
+			return
+		}
+		if err := refs.Store.DeletePolicy(body.Name); err != nil {
+			routePolicyError(refs, w, req, err)
+			return
+		}
+		server.JSONResponse(w, server.NewResponse(http.StatusOK, "OK", nil))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "policy.delete"),
+		middleware.ValidateToken(refs),
+		middleware.RequireAdmin(refs),
+		middleware.ParseJSONBody[NameRequest](refs),
+	)
+}
+
+// HTTP handler function for attaching policies to a user, group or role.
+func AttachHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		body := req.Context().Value(server.BodyKey{}).(AttachRequest)
+		if err := refs.CheckPolicies(body.Policies); err != nil {
+			routePolicyError(refs, w, req, err)
+			return
+		}
+		policies := slices.Compact(slices.Sorted(slices.Values(body.Policies)))
+
+		var err error
+		switch body.Kind {
+		case "user":
+			user, exists := refs.Store.GetUserInfo(body.Name)
+			if !exists {
+				server.JSONResponse(w, server.NewNoSuchUserError(body.Name))
+				return
+			}
+			user.Policies = policies
+			err = refs.Store.UpdateUser(user)
+		case "group":
+			group, exists := refs.Store.GetGroup(body.Name)
+			if !exists {
+				err = store.NewNoSuchGroupError(body.Name)
+				break
+			}
+			group.Policies = policies
+			err = refs.Store.UpdateGroup(group)
+		case "role":
+			role, exists := refs.Store.GetRole(body.Name)
+			if !exists {
+				err = store.NewNoSuchRoleError(body.Name)
+				break
+			}
+			role.Policies = policies
+			err = refs.Store.SetRole(role)
+		default:
+			server.JSONResponse(w, server.NewInvalidBodyError())
+			return
+		}
+		if err != nil {
+			routePolicyError(refs, w, req, err)
+			return
+		}
+		server.JSONResponse(w, server.NewResponse(http.StatusOK, "OK", nil))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "policy.attach"),
+		middleware.ValidateToken(refs),
+		middleware.RequireAdmin(refs),
+		middleware.ParseJSONBody[AttachRequest](refs),
+	)
+}
+
+// HTTP handler function for a dry run of a policy check, explaining which rules
+// grant or fail to grant the capability. Anyone may explain their own access;
+// explaining another user's needs admin on this route.
+func ExplainHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(ExplainRequest)
+		if !slices.Contains(server.Capabilities, body.Capability) || body.Path == "" {
+			server.JSONResponse(w, server.NewInvalidBodyError())
+			return
+		}
+
+		subject := sess
+		if body.User != "" && body.User != sess.User {
+			if !sess.Scope.Unrestricted() || sess.Role != "" ||
+				refs.Authorize(sess, server.CapAdmin, server.AdminPath(req.URL.Path)) != nil {
+				server.JSONResponse(w, server.NewResponse(http.StatusForbidden, nil, e.AdminRequired))
+				return
+			}
+			if !refs.Store.HasUser(body.User) {
+				server.JSONResponse(w, server.NewNoSuchUserError(body.User))
+				return
+			}
+			subject = server.Session{User: body.User}
+		}
+		server.JSONResponse(w, server.NewServerSuccess(refs.Explain(subject, body.Capability, body.Path)))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "policy.explain"),
+		middleware.ValidateToken(refs),
+		middleware.ParseJSONBody[ExplainRequest](refs),
+	)
+}
+
+func routePolicyError(refs *server.ServerRefs, w http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, e.InvalidPolicy), errors.Is(err, e.BuiltinPolicy), errors.Is(err, e.UnknownPolicy):
+		server.JSONResponse(w, server.NewClientError(err))
+	case errors.As(err, new(store.NoSuchPolicyError)), errors.As(err, new(store.NoSuchGroupError)),
+		errors.As(err, new(store.NoSuchRoleError)):
+		server.JSONResponse(w, server.NewResponse(http.StatusNotFound, nil, err))
+	case errors.Is(err, store.ErrGroupChanged):
+		server.JSONResponse(w, server.NewResponse(http.StatusConflict, nil, e.GroupChanged))
+	default:
+		refs.Log.ErrorContext(req.Context(), "policy operation", "err", err)
+		server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+	}
+}
@@ -2,11 +2,12 @@ package register
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/jdpolicano/govault/internal/server"
+	e "github.com/jdpolicano/govault/internal/server/errors"
 	"github.com/jdpolicano/govault/internal/server/middleware"
 	"github.com/jdpolicano/govault/internal/store"
-	"github.com/jdpolicano/govault/internal/vault"
 )
 
 // HTTP handler function for creating a new user and session.
@@ -15,47 +16,89 @@ func Handler(refs *server.ServerRefs) http.HandlerFunc {
 	handle := func(w http.ResponseWriter, req *http.Request) {
 		body := req.Context().Value(server.BodyKey{}).(server.AuthCredentials)
 		username, password := body.Username, body.Password
+		server.NoteAuditUser(req, username)
+
+		mode := refs.RegistrationMode()
+		switch {
+		case mode == server.RegistrationDisabled:
+			server.JSONResponse(w, server.NewResponse(http.StatusForbidden, nil, e.RegistrationClosed))
+			return
+		case mode == server.RegistrationInvite && body.Invite == "":
+			server.JSONResponse(w, server.NewResponse(http.StatusForbidden, nil, e.InviteRequired))
+			return
+		}
+		if err := refs.Config.ValidateUsername(username); err != nil {
+			server.JSONResponse(w, server.NewClientError(err))
+			return
+		}
 
 		// check if this user already exists in the store
 		if refs.Store.HasUser(username) {
-			refs.Log.Printf("error creating user \"%s\" already exists", username)
+			refs.Log.InfoContext(req.Context(), "user already exists", "user", username)
 			server.JSONResponse(w, server.NewServerError(store.UserAlreadyExistsError{}))
 			return
 		}
 
+		// the invite is used up before any work is done so it can't be raced, and
+		// handed back if the account isn't created after all.
+		restore := func() {}
+		if mode == server.RegistrationInvite {
+			invite, err := refs.RedeemInvite(body.Invite, time.Now())
+			if err != nil {
+				server.JSONResponse(w, server.NewResponse(http.StatusForbidden, nil, err))
+				return
+			}
+			restore = func() {
+				if err := refs.Store.AddInvite(invite); err != nil {
+					refs.Log.ErrorContext(req.Context(), "restoring invite", "invite", invite.ID, "err", err)
+				}
+			}
+			refs.Log.InfoContext(req.Context(), "redeemed invite", "user", username, "invite", invite.ID, "created_by", invite.CreatedBy)
+		}
+
 		// if not, then generate keys for this password and a new random salt for it.
-		key, err := vault.NewKey(password, refs.Config.SaltSize)
+		key, err := refs.KDF.NewKey(req.Context(), password, refs.Config.SaltSize)
 		if err != nil {
-			refs.Log.Printf("error creating user keys %s %v", username, err)
-			server.JSONResponse(w, server.NewServerError(err))
+			restore()
+			refs.Log.ErrorContext(req.Context(), "deriving user keys", "user", username, "err", err)
+			server.SendKDFError(w, err)
 			return
 		}
-		refs.Log.Printf("successfully derived salt for user \"%s\"", username)
+		refs.Log.DebugContext(req.Context(), "derived user keys", "user", username)
 
 		// add the user to the store with the login key (for later authentication, NOT for encrypting/decrypting secrets)
 		// and the salt that was used to derive that key
 		if err = refs.Store.AddUser(username, key.Login, key.Salt); err != nil {
-			refs.Log.Printf("error adding user \"%s\" %v", username, err)
+			restore()
+			refs.Log.ErrorContext(req.Context(), "adding user", "user", username, "err", err)
 			routeStoreError(w, err)
 			return
 		}
-		refs.Log.Printf("successfully added user \"%s\"", username)
+		refs.Log.InfoContext(req.Context(), "registered user", "user", username)
+
+		// give the user the key pair group keys are wrapped to. login retries if this fails.
+		user, _ := refs.Store.GetUserInfo(username)
+		if err := refs.EnsureKeyPair(&user, key.AES); err != nil {
+			refs.Log.ErrorContext(req.Context(), "creating key pair", "user", username, "err", err)
+		}
 
 		// issue a token to the user at this point so they won't need to call the login route separately.
-		token, err := refs.Sessions.CreateUserSession(username, key.AES, refs.Config.DefaultTTL)
+		sess := server.NewSession(username, key.AES, refs.Config.DefaultTTL)
+		sess.EnrollOnly = refs.Config.TOTP == server.TOTPRequired
+		token, err := refs.Sessions.CreateSession(sess)
 		if err != nil {
-			refs.Log.Printf("error creating session for user \"%s\" %s", username, err)
+			refs.Log.ErrorContext(req.Context(), "creating session", "user", username, "err", err)
 			server.JSONResponse(w, server.NewServerError(err))
 			return
 		}
 
 		server.SendToken(w, token)
-		refs.Log.Println("response sent")
 	}
 
 	return middleware.Chain(handle,
 		middleware.Logging(refs.Log),
-		middleware.ParseJSONBody[server.AuthCredentials](),
+		middleware.Audit(refs, "register"),
+		middleware.ParseJSONBody[server.AuthCredentials](refs),
 	)
 }
 
@@ -0,0 +1,212 @@
+package secrets
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/jdpolicano/govault/internal/server"
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+	"github.com/jdpolicano/govault/internal/store"
+)
+
+// Listings return this many entries unless the request asks for fewer, and never
+// more than maxLimit.
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// ListRequest asks for a page of the entries directly under Prefix, which is
+// empty for the top of the vault or ends in "/". Cursor is the Next of the
+// previous page. Labels leaves out secrets without every one of them, and
+// directories holding none that have them.
+type ListRequest struct {
+	Prefix string            `json:"prefix"`
+	Cursor string            `json:"cursor"`
+	Limit  int               `json:"limit"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+func (r ListRequest) SecretKey() string {
+	return server.SecretPattern(r.Prefix)
+}
+
+// DeleteRequest deletes the secret at Key or, when Recursive, every secret under
+// the directory Key. Deleting a directory needs Confirm to repeat its path.
+type DeleteRequest struct {
+	Key       string `json:"key"`
+	Recursive bool   `json:"recursive"`
+	Confirm   string `json:"confirm"`
+}
+
+func (r DeleteRequest) SecretKey() string {
+	return server.SecretPattern(r.Key)
+}
+
+// MetadataRequest replaces the labels and description of the secret at Key.
+type MetadataRequest struct {
+	Key         string            `json:"key"`
+	Labels      map[string]string `json:"labels"`
+	Description string            `json:"description"`
+}
+
+func (r MetadataRequest) SecretKey() string {
+	return r.Key
+}
+
+// MoveRequest renames the secret at From to To, or moves every secret under the
+// directory From into the directory To. Nothing is overwritten.
+type MoveRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (r MoveRequest) SecretKey() string {
+	return server.SecretPattern(r.From)
+}
+
+// HTTP handler function for listing the secrets and directories under a prefix,
+// a page at a time.
+func ListHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(ListRequest)
+		if body.Limit < 0 {
+			routeSecretError(refs, w, req, e.InvalidRequestBody)
+			return
+		}
+		limit := body.Limit
+		if limit == 0 {
+			limit = defaultLimit
+		}
+		page, err := refs.Store.List(sess.User, body.Prefix, body.Cursor, min(limit, maxLimit), body.Labels)
+		if err != nil {
+			routeSecretError(refs, w, req, err)
+			return
+		}
+		server.JSONResponse(w, server.NewServerSuccess(page))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "list"),
+		middleware.ValidateToken(refs),
+		middleware.ParseJSONBody[ListRequest](refs),
+		middleware.Authorize(refs, server.CapList),
+	)
+}
+
+// HTTP handler function for deleting a secret or a directory of secrets. The
+// response is the number of secrets deleted. A secret stored under a key from
+// before keys had to be valid can still be deleted by naming it exactly.
+func DeleteHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(DeleteRequest)
+
+		var deleted int
+		var err error
+		switch {
+		case !body.Recursive:
+			if _, exists := refs.Store.Get(sess.User, body.Key); !exists && !store.ValidKey(body.Key) {
+				err = store.ErrInvalidPath
+				break
+			}
+			deleted, err = 1, refs.Store.Delete(sess.User, body.Key)
+		case body.Key == "" || !store.IsPrefix(body.Key):
+			err = store.ErrInvalidPath
+		case body.Confirm != body.Key:
+			err = e.ConfirmationRequired
+		default:
+			deleted, err = refs.Store.DeleteTree(sess.User, body.Key)
+		}
+		if err != nil {
+			routeSecretError(refs, w, req, err)
+			return
+		}
+		server.JSONResponse(w, server.NewServerSuccess(deleted))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "delete"),
+		middleware.ValidateToken(refs),
+		middleware.ParseJSONBody[DeleteRequest](refs),
+		middleware.Authorize(refs, server.CapDelete),
+	)
+}
+
+// HTTP handler function for renaming a secret or moving a directory of secrets.
+// Moving needs delete and read where the secrets are and write where they go.
+// The response is the number of secrets moved.
+func MoveHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(MoveRequest)
+		err := refs.AuthorizeKey(sess, server.CapRead, server.SecretPattern(body.From))
+		if err == nil {
+			err = refs.AuthorizeKey(sess, server.CapWrite, server.SecretPattern(body.To))
+		}
+		if err != nil {
+			server.WriteAuthError(w, err)
+			return
+		}
+		moved, err := refs.Store.Move(sess.User, body.From, body.To)
+		if err != nil {
+			routeSecretError(refs, w, req, err)
+			return
+		}
+		server.JSONResponse(w, server.NewServerSuccess(moved))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "move"),
+		middleware.ValidateToken(refs),
+		middleware.ParseJSONBody[MoveRequest](refs),
+		middleware.Authorize(refs, server.CapDelete),
+	)
+}
+
+// HTTP handler function for labelling and describing a secret without changing
+// its value.
+func MetadataHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(MetadataRequest)
+		err := server.ValidateMetadata(body.Labels, body.Description)
+		if err == nil {
+			err = refs.Store.SetMetadata(sess.User, body.Key, store.Metadata{Labels: body.Labels, Description: body.Description})
+		}
+		if err != nil {
+			routeSecretError(refs, w, req, err)
+			return
+		}
+		server.JSONResponse(w, server.NewResponse(http.StatusOK, "OK", nil))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "metadata"),
+		middleware.ValidateToken(refs),
+		middleware.ParseJSONBody[MetadataRequest](refs),
+		middleware.Authorize(refs, server.CapWrite),
+	)
+}
+
+func routeSecretError(refs *server.ServerRefs, w http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrInvalidPath):
+		server.JSONResponse(w, server.NewClientError(e.InvalidSecretPath))
+	case errors.Is(err, e.ConfirmationRequired), errors.Is(err, e.InvalidRequestBody), errors.Is(err, e.InvalidMetadata):
+		server.JSONResponse(w, server.NewClientError(err))
+	case errors.As(err, new(store.NoSuchSecretError)):
+		server.JSONResponse(w, server.NewResponse(http.StatusNotFound, nil, e.NoSuchSecret))
+	case errors.As(err, new(store.SecretExistsError)):
+		server.JSONResponse(w, server.NewResponse(http.StatusConflict, nil, e.SecretExists))
+	default:
+		refs.Log.ErrorContext(req.Context(), "secret operation", "err", err)
+		server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+	}
+}
@@ -1,6 +1,8 @@
 package set
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/jdpolicano/govault/internal/server"
@@ -10,9 +12,19 @@ import (
 	"github.com/jdpolicano/govault/internal/vault"
 )
 
+// SetRequest writes a secret, either the text Value or Data, a json object of
+// named fields. Labels, when given, replace the secret's labels, and a non empty
+// Description replaces its description.
 type SetRequest struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	Key         string            `json:"key"`
+	Value       string            `json:"value"`
+	Data        json.RawMessage   `json:"data,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Description string            `json:"description,omitempty"`
+}
+
+func (r SetRequest) SecretKey() string {
+	return r.Key
 }
 
 // HTTP handler function for logging in and getting a new token.
@@ -21,16 +33,41 @@ func Handler(refs *server.ServerRefs) http.HandlerFunc {
 	handle := func(w http.ResponseWriter, req *http.Request) {
 		sess := req.Context().Value(server.SessionKey{}).(server.Session)
 		body := req.Context().Value(server.BodyKey{}).(SetRequest)
+		if !store.ValidKey(body.Key) {
+			server.JSONResponse(w, server.NewClientError(e.InvalidSecretPath))
+			return
+		}
+		if err := server.ValidateMetadata(body.Labels, body.Description); err != nil {
+			server.JSONResponse(w, server.NewClientError(err))
+			return
+		}
+
+		plain, kind := []byte(body.Value), store.TypeString
+		if len(body.Data) > 0 {
+			fields, err := server.ParseObject(body.Data)
+			if err != nil || body.Value != "" {
+				server.JSONResponse(w, server.NewClientError(e.NotAnObject))
+				return
+			}
+			plain, _ = json.Marshal(fields)
+			kind = store.TypeObject
+		}
+
+		if err := refs.Config.CheckSecretSize(int64(len(plain))); err != nil {
+			server.JSONResponse(w, server.NewResponse(http.StatusRequestEntityTooLarge, nil, err))
+			return
+		}
 
-		cipher, nonce, err := vault.Encrypt(sess.Key, body.Value)
+		cipher, nonce, err := vault.EncryptBytes(sess.Key, plain)
 		if err != nil {
-			refs.Log.Printf("err encrypting key %s", err)
+			refs.Log.ErrorContext(req.Context(), "encrypting secret", "user", sess.User, "err", err)
 			http.Error(w, e.UnexpectedServerError.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		if err := setKey(refs.Store, sess.User, body.Key, cipher, nonce); err != nil {
-			refs.Log.Printf("err setting key %s", err)
+		meta := store.Metadata{UpdatedBy: sess.ID, Labels: body.Labels, Description: body.Description, Type: kind}
+		if err := setKey(refs.Store, sess.User, body.Key, cipher, nonce, meta); err != nil {
+			refs.Log.ErrorContext(req.Context(), "storing secret", "user", sess.User, "err", err)
 			http.Error(w, e.UnexpectedServerError.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -40,11 +77,99 @@ func Handler(refs *server.ServerRefs) http.HandlerFunc {
 
 	return middleware.Chain(handle,
 		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "set"),
+		middleware.ValidateToken(refs),
+		middleware.ParseJSONBody[SetRequest](refs),
+		middleware.Authorize(refs, server.CapWrite),
+	)
+}
+
+// PatchRequest updates some fields of a structured secret. Each field replaces
+// the one of the same name, or removes it when null. Patching a secret that
+// doesn't exist creates it.
+type PatchRequest struct {
+	Key    string                     `json:"key"`
+	Fields map[string]json.RawMessage `json:"fields"`
+}
+
+func (r PatchRequest) SecretKey() string {
+	return r.Key
+}
+
+// HTTP handler function for changing some fields of a structured secret while
+// leaving the others as they are.
+func PatchHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(PatchRequest)
+		if !store.ValidKey(body.Key) {
+			routePatchError(refs, w, req, store.ErrInvalidPath)
+			return
+		}
+
+		fields := make(map[string]json.RawMessage)
+		old, exists := refs.Store.Get(sess.User, body.Key)
+		if exists {
+			if meta, _ := refs.Store.GetMetadata(sess.User, body.Key); meta.Type != store.TypeObject {
+				routePatchError(refs, w, req, e.NotAnObject)
+				return
+			}
+			plain, err := vault.Decrypt(old.Nonce, sess.Key, old.Text)
+			if err == nil {
+				fields, err = server.ParseObject(plain)
+			}
+			if err != nil {
+				routePatchError(refs, w, req, err)
+				return
+			}
+		}
+		server.PatchObject(fields, body.Fields)
+		plain, err := json.Marshal(fields)
+		if err == nil {
+			err = refs.Config.CheckSecretSize(int64(len(plain)))
+		}
+		if err != nil {
+			routePatchError(refs, w, req, err)
+			return
+		}
+
+		cipher, nonce, err := vault.EncryptBytes(sess.Key, plain)
+		if err == nil {
+			meta := store.Metadata{UpdatedBy: sess.ID, Type: store.TypeObject}
+			err = refs.Store.Replace(sess.User, body.Key, old, store.CipherText{Nonce: nonce, Text: cipher}, meta)
+		}
+		if err != nil {
+			routePatchError(refs, w, req, err)
+			return
+		}
+		server.JSONResponse(w, server.NewResponse(http.StatusOK, "OK", nil))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "patch"),
 		middleware.ValidateToken(refs),
-		middleware.ParseJSONBody[SetRequest](),
+		middleware.ParseJSONBody[PatchRequest](refs),
+		middleware.Authorize(refs, server.CapWrite),
 	)
 }
 
-func setKey(s store.Store, user, key string, cipher, nonce []byte) error {
-	return s.Set(user, key, store.CipherText{Nonce: nonce, Text: cipher})
+func routePatchError(refs *server.ServerRefs, w http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrInvalidPath):
+		server.JSONResponse(w, server.NewClientError(e.InvalidSecretPath))
+	case errors.Is(err, e.NotAnObject):
+		server.JSONResponse(w, server.NewClientError(err))
+	case errors.Is(err, e.SecretTooLarge):
+		server.JSONResponse(w, server.NewResponse(http.StatusRequestEntityTooLarge, nil, err))
+	case errors.Is(err, store.ErrSecretChanged):
+		server.JSONResponse(w, server.NewResponse(http.StatusConflict, nil, e.SecretChanged))
+	default:
+		refs.Log.ErrorContext(req.Context(), "patching secret", "err", err)
+		server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+	}
+}
+
+func setKey(s store.Store, user, key string, cipher, nonce []byte, meta store.Metadata) error {
+	return s.Set(user, key, store.CipherText{Nonce: nonce, Text: cipher}, meta)
 }
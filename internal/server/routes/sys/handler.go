@@ -0,0 +1,200 @@
+package sys
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/jdpolicano/govault/internal/server"
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+// UnsealRequest carries one key share, base64 encoded in json.
+type UnsealRequest struct {
+	Key []byte `json:"key"`
+}
+
+// RekeyInitRequest asks for a new unseal key split into Shares key shares.
+type RekeyInitRequest struct {
+	Shares    int `json:"shares"`
+	Threshold int `json:"threshold"`
+}
+
+// RekeyUpdateRequest carries one current key share toward the rekey with Nonce.
+type RekeyUpdateRequest struct {
+	Nonce string `json:"nonce"`
+	Key   []byte `json:"key"`
+}
+
+// RekeyResponse reports a rekey's progress, with the new key shares once it completes.
+type RekeyResponse struct {
+	server.RekeyStatus
+	Complete bool     `json:"complete"`
+	Keys     [][]byte `json:"keys,omitempty"`
+}
+
+// ReadyResponse lists the outcome of every readiness check.
+type ReadyResponse struct {
+	Ready  bool                `json:"ready"`
+	Checks []server.ReadyCheck `json:"checks"`
+}
+
+// HTTP handler function reporting that the process is up. It does no work so
+// that a liveness probe never fails because of a dependency, and skips request
+// logging since load balancers call it every few seconds.
+func HealthHandler(refs *server.ServerRefs) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		server.JSONResponse(w, server.NewResponse(http.StatusOK, "OK", nil))
+	}
+}
+
+// HTTP handler function reporting whether the server can take traffic, with a
+// 503 when any readiness check fails.
+func ReadyHandler(refs *server.ServerRefs) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		checks, ready := refs.Readiness()
+		code := http.StatusOK
+		if !ready {
+			code = http.StatusServiceUnavailable
+		}
+		server.JSONResponse(w, server.NewResponse(code, ReadyResponse{ready, checks}, nil))
+	}
+}
+
+// HTTP handler function exposing the server's metrics to scrapers presenting the
+// configured metrics token. The metrics name audit sinks and routes, so they are
+// not served at all when no token is configured.
+func MetricsHandler(refs *server.ServerRefs) http.HandlerFunc {
+	expose := refs.Metrics.Registry.Handler()
+	return func(w http.ResponseWriter, req *http.Request) {
+		want := refs.Config.MetricsToken
+		if want == "" {
+			server.JSONResponse(w, server.NewResponse(http.StatusNotFound, nil, e.MetricsDisabled))
+			return
+		}
+		scheme, token, _ := strings.Cut(req.Header.Get("Authorization"), " ")
+		if !strings.EqualFold(scheme, "Bearer") || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(want)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="govault-metrics"`)
+			server.JSONResponse(w, server.NewResponse(http.StatusUnauthorized, nil, e.IncorrectMetricsToken))
+			return
+		}
+		expose(w, req)
+	}
+}
+
+// HTTP handler function describing the running server.
+func StatusHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		server.JSONResponse(w, server.NewServerSuccess(refs.Status()))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "sys.status"),
+		middleware.ValidateToken(refs),
+	)
+}
+
+// HTTP handler function reporting whether the vault is initialized and sealed.
+func SealStatusHandler(refs *server.ServerRefs) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		server.JSONResponse(w, server.NewServerSuccess(refs.SealStatus()))
+	}
+}
+
+// HTTP handler function for submitting a key share toward unsealing the vault.
+func UnsealHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		body := req.Context().Value(server.BodyKey{}).(UnsealRequest)
+		status, err := refs.Unseal(body.Key)
+		if err != nil {
+			routeSealError(w, err)
+			return
+		}
+		server.JSONResponse(w, server.NewServerSuccess(status))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "sys.unseal"),
+		middleware.ParseJSONBody[UnsealRequest](refs),
+	)
+}
+
+// HTTP handler function for sealing the vault in an emergency. Every session is
+// revoked, including the caller's.
+func SealHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		refs.Seal()
+		server.JSONResponse(w, server.NewServerSuccess(refs.SealStatus()))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "sys.seal"),
+		middleware.ValidateToken(refs),
+		middleware.RequireAdmin(refs),
+	)
+}
+
+// HTTP handler function for starting a rekey, which replaces the key shares.
+func RekeyInitHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		body := req.Context().Value(server.BodyKey{}).(RekeyInitRequest)
+		status, err := refs.BeginRekey(body.Shares, body.Threshold)
+		if err != nil {
+			routeSealError(w, err)
+			return
+		}
+		server.JSONResponse(w, server.NewServerSuccess(RekeyResponse{RekeyStatus: status}))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "sys.rekey.init"),
+		middleware.ValidateToken(refs),
+		middleware.RequireAdmin(refs),
+		middleware.ParseJSONBody[RekeyInitRequest](refs),
+	)
+}
+
+// HTTP handler function for submitting a current key share toward a rekey. Like
+// unsealing it needs no token, holding a key share is the authorization.
+func RekeyUpdateHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		body := req.Context().Value(server.BodyKey{}).(RekeyUpdateRequest)
+		status, keys, err := refs.SubmitRekeyShare(body.Nonce, body.Key)
+		if err != nil {
+			routeSealError(w, err)
+			return
+		}
+		res := RekeyResponse{RekeyStatus: status, Complete: keys != nil, Keys: keys}
+		server.JSONResponse(w, server.NewServerSuccess(res))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "sys.rekey.update"),
+		middleware.ParseJSONBody[RekeyUpdateRequest](refs),
+	)
+}
+
+func routeSealError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, vault.ErrBadUnsealKey), errors.Is(err, vault.ErrInvalidShare),
+		errors.Is(err, vault.ErrDuplicateShare), errors.Is(err, vault.ErrInvalidShares),
+		errors.Is(err, e.MissingUnsealKey), errors.Is(err, e.RekeyNonceMismatch):
+		server.JSONResponse(w, server.NewClientError(err))
+	case errors.Is(err, e.NoRekeyInProgress):
+		server.JSONResponse(w, server.NewResponse(http.StatusConflict, nil, err))
+	case errors.Is(err, vault.ErrSealed):
+		server.JSONResponse(w, server.NewResponse(http.StatusServiceUnavailable, nil, e.VaultSealed))
+	case errors.Is(err, vault.ErrNotInitialized):
+		server.JSONResponse(w, server.NewResponse(http.StatusConflict, nil, err))
+	default:
+		server.JSONResponse(w, server.NewServerError(err))
+	}
+}
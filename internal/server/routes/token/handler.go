@@ -0,0 +1,70 @@
+package token
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/server"
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+)
+
+// TokenRequest describes a derived token. Paths, ReadOnly and Policies narrow what
+// the new token may do, with no policies meaning all of the caller's, TTL is a Go
+// duration string and Uses limits how many requests it may make (zero for unlimited).
+type TokenRequest struct {
+	Paths    []string `json:"paths"`
+	ReadOnly bool     `json:"read_only"`
+	Policies []string `json:"policies"`
+	TTL      string   `json:"ttl"`
+	Uses     int      `json:"uses"`
+}
+
+// HTTP handler function for minting a token restricted to a subset of the
+// caller's own access.
+func Handler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(TokenRequest)
+
+		var ttl time.Duration
+		if body.TTL != "" {
+			parsed, err := time.ParseDuration(body.TTL)
+			if err != nil || parsed <= 0 {
+				server.JSONResponse(w, server.NewClientError(e.InvalidRequestBody))
+				return
+			}
+			ttl = parsed
+		}
+
+		policies, err := refs.LimitPolicies(sess, body.Policies)
+		var token string
+		if err == nil {
+			scope := server.Scope{Paths: body.Paths, ReadOnly: body.ReadOnly, Policies: policies}
+			token, err = refs.Sessions.CreateScopedSession(sess, scope, ttl, body.Uses)
+		}
+		if err != nil {
+			refs.Log.InfoContext(req.Context(), "refusing scoped session", "user", sess.User, "err", err)
+			routeSessionError(w, err)
+			return
+		}
+		server.SendToken(w, token)
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "token.create"),
+		middleware.ValidateToken(refs),
+		middleware.ParseJSONBody[TokenRequest](refs),
+	)
+}
+
+// routeSessionError maps scope escalation to a forbidden response.
+func routeSessionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, e.ScopeEscalation) {
+		server.JSONResponse(w, server.NewResponse(http.StatusForbidden, nil, err))
+		return
+	}
+	server.JSONResponse(w, server.NewServerError(err))
+}
@@ -0,0 +1,130 @@
+package totp
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/server"
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+	"github.com/jdpolicano/govault/internal/store"
+)
+
+// CodeRequest carries a totp code, or for disabling, a recovery code.
+type CodeRequest struct {
+	Code string `json:"code"`
+}
+
+// RecoveryCodes is returned once when an enrollment is confirmed.
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// HTTP handler function for starting a totp enrollment. The seed is returned as an
+// otpauth:// uri and as base32 text, and stays inactive until confirmed.
+func EnrollHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		if refs.Config.TOTP == server.TOTPDisabled {
+			server.JSONResponse(w, server.NewResponse(http.StatusForbidden, nil, e.TOTPUnavailable))
+			return
+		}
+
+		user, exists := refs.Store.GetUserInfo(sess.User)
+		if !exists {
+			server.JSONResponse(w, server.NewNoSuchUserError(sess.User))
+			return
+		}
+		old := user.TOTP
+		enrollment, err := server.BeginTOTPEnrollment(&user, sess.Key, refs.Config.Issuer)
+		if err != nil {
+			routeTOTPError(refs, w, req, err)
+			return
+		}
+		if err := refs.Store.SwapTOTP(user.Name, old, user.TOTP); err != nil {
+			routeTOTPError(refs, w, req, err)
+			return
+		}
+		server.JSONResponse(w, server.NewServerSuccess(enrollment))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "totp.enroll"),
+		middleware.ValidateEnrollmentToken(refs),
+		middleware.RequireUserSession(),
+	)
+}
+
+// HTTP handler function for confirming an enrollment with a first code, which
+// enables the second factor and returns single use recovery codes.
+func ConfirmHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(CodeRequest)
+
+		user, exists := refs.Store.GetUserInfo(sess.User)
+		if !exists {
+			server.JSONResponse(w, server.NewNoSuchUserError(sess.User))
+			return
+		}
+		old := user.TOTP
+		codes, err := server.ConfirmTOTPEnrollment(&user, sess.Key, body.Code, time.Now())
+		if err != nil {
+			routeTOTPError(refs, w, req, err)
+			return
+		}
+		if err := refs.Store.SwapTOTP(user.Name, old, user.TOTP); err != nil {
+			routeTOTPError(refs, w, req, err)
+			return
+		}
+		server.JSONResponse(w, server.NewServerSuccess(RecoveryCodes{codes}))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "totp.confirm"),
+		middleware.ValidateEnrollmentToken(refs),
+		middleware.RequireUserSession(),
+		middleware.ParseJSONBody[CodeRequest](refs),
+	)
+}
+
+// HTTP handler function for removing a second factor, which requires a current
+// totp or recovery code.
+func DisableHandler(refs *server.ServerRefs) http.HandlerFunc {
+	handle := func(w http.ResponseWriter, req *http.Request) {
+		sess := req.Context().Value(server.SessionKey{}).(server.Session)
+		body := req.Context().Value(server.BodyKey{}).(CodeRequest)
+
+		if err := refs.DisableSecondFactor(sess.User, sess.Key, body.Code, time.Now()); err != nil {
+			routeTOTPError(refs, w, req, err)
+			return
+		}
+		server.JSONResponse(w, server.NewResponse(http.StatusOK, "OK", nil))
+	}
+
+	return middleware.Chain(handle,
+		middleware.Logging(refs.Log),
+		middleware.Audit(refs, "totp.disable"),
+		middleware.ValidateToken(refs),
+		middleware.RequireUserSession(),
+		middleware.ParseJSONBody[CodeRequest](refs),
+	)
+}
+
+// routeTOTPError handles the errors enrolling and checking second factors can produce.
+func routeTOTPError(refs *server.ServerRefs, w http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, e.TOTPAlreadyEnrolled), errors.Is(err, e.TOTPNotPending), errors.Is(err, store.ErrTOTPChanged):
+		server.JSONResponse(w, server.NewResponse(http.StatusConflict, nil, err))
+	case errors.Is(err, e.NoSuchUser):
+		server.JSONResponse(w, server.NewClientError(err))
+	case errors.Is(err, e.IncorrectOTP), errors.Is(err, e.OTPRequired):
+		server.JSONResponse(w, server.NewClientError(err))
+	default:
+		refs.Log.ErrorContext(req.Context(), "managing second factor", "err", err)
+		server.JSONResponse(w, server.NewServerError(e.UnexpectedServerError))
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"slices"
+	"strings"
+
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/store"
+)
+
+// Capability names an operation a session may perform on a secret.
+type Capability string
+
+const (
+	CapRead   Capability = "read"
+	CapWrite  Capability = "write"
+	CapList   Capability = "list"
+	CapDelete Capability = "delete"
+	CapAdmin  Capability = "admin"
+)
+
+// Capabilities lists every capability a policy may grant.
+var Capabilities = []Capability{CapRead, CapWrite, CapList, CapDelete, CapAdmin}
+
+// Scope restricts what a session may do. The zero Scope is unrestricted, which is
+// what a password login receives.
+type Scope struct {
+	Paths    []string `json:"paths,omitempty"`     // key patterns such as "ci/*"; empty allows every key
+	ReadOnly bool     `json:"read_only,omitempty"` // deny every capability other than read
+	Policies []string `json:"policies,omitempty"`  // the only policies evaluated for the session; empty uses the identity's own
+}
+
+// Unrestricted reports whether the scope places no limits on the session.
+func (s Scope) Unrestricted() bool {
+	return len(s.Paths) == 0 && !s.ReadOnly && len(s.Policies) == 0
+}
+
+// Allows reports whether the scope permits cap on key.
+func (s Scope) Allows(cap Capability, key string) bool {
+	if s.ReadOnly && cap != CapRead {
+		return false
+	}
+	if len(s.Paths) == 0 {
+		return true
+	}
+	for _, p := range s.Paths {
+		if MatchPath(p, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Narrow returns child if it grants no more than s does, or an error otherwise.
+// A child that names no policies inherits those s is limited to.
+func (s Scope) Narrow(child Scope) (Scope, error) {
+	if s.ReadOnly && !child.ReadOnly {
+		return Scope{}, e.ScopeEscalation
+	}
+	if len(s.Policies) > 0 {
+		if len(child.Policies) == 0 {
+			child.Policies = s.Policies
+		} else if !subsetOf(child.Policies, s.Policies) {
+			return Scope{}, e.ScopeEscalation
+		}
+	}
+	if len(s.Paths) == 0 {
+		return child, nil
+	}
+	if len(child.Paths) == 0 {
+		return Scope{}, e.ScopeEscalation
+	}
+	for _, c := range child.Paths {
+		covered := false
+		for _, p := range s.Paths {
+			if coversPath(p, c) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return Scope{}, e.ScopeEscalation
+		}
+	}
+	return child, nil
+}
+
+// MatchPath reports whether key matches pattern. A pattern ending in "*" matches
+// every key with the preceding prefix, otherwise the match must be exact.
+func MatchPath(pattern, key string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(key, prefix)
+	}
+	return pattern == key
+}
+
+// SecretPattern is the key pattern that scopes and policies are checked against
+// for a secret path: the key itself, or for a directory every key under it.
+func SecretPattern(path string) string {
+	if store.IsPrefix(path) {
+		return path + "*"
+	}
+	return path
+}
+
+// coversPath reports whether every key matched by child is also matched by parent.
+func coversPath(parent, child string) bool {
+	prefix, wild := strings.CutSuffix(parent, "*")
+	if !wild {
+		return parent == child
+	}
+	return strings.HasPrefix(strings.TrimSuffix(child, "*"), prefix)
+}
+
+// subsetOf reports whether every name in names is also in of.
+func subsetOf(names, of []string) bool {
+	for _, n := range names {
+		if !slices.Contains(of, n) {
+			return false
+		}
+	}
+	return true
+}
+
+// KeyedRequest is implemented by request bodies that address a single secret so
+// that scope checks can be applied before the route runs.
+type KeyedRequest interface {
+	SecretKey() string
+}
@@ -0,0 +1,312 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/store"
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+// SealStatus is what anyone may learn about the seal without a token.
+type SealStatus struct {
+	Initialized bool `json:"initialized"`
+	Sealed      bool `json:"sealed"`
+	Shares      int  `json:"shares,omitempty"`    // key shares the unseal key was split into
+	Threshold   int  `json:"threshold,omitempty"` // key shares needed to unseal
+	Progress    int  `json:"progress"`            // key shares submitted so far
+}
+
+// RekeyStatus describes a rekey in progress.
+type RekeyStatus struct {
+	Nonce     string `json:"nonce"`
+	Shares    int    `json:"shares"`    // key shares in the new set
+	Threshold int    `json:"threshold"` // key shares of the new set needed to unseal
+	Required  int    `json:"required"`  // current key shares needed to authorize the rekey
+	Progress  int    `json:"progress"`  // current key shares submitted so far
+}
+
+// sealState holds the key shares submitted toward unsealing or rekeying, and
+// serializes every change to the seal.
+type sealState struct {
+	sync.Mutex
+	unseal [][]byte     // shares submitted toward unsealing
+	rekey  *RekeyStatus // the rekey in progress, if any
+	shares [][]byte     // current shares submitted toward the rekey
+}
+
+// reset forgets every submitted share.
+func (s *sealState) reset() {
+	for _, share := range append(s.unseal, s.shares...) {
+		clear(share)
+	}
+	s.unseal, s.rekey, s.shares = nil, nil, nil
+}
+
+// KeyringPath is where the wrapped barrier key is kept.
+func (refs *ServerRefs) KeyringPath() string {
+	return filepath.Join(refs.Config.VaultPath, vault.KeyringFile)
+}
+
+// InitVault creates the keyring of the vault at config's vault path, as
+// vault.InitKeyring does. A vault path left by a store from before records were
+// encrypted has its plaintext records encrypted under the new barrier key first,
+// and kept as they were if the keyring cannot be written. This is the only time
+// plaintext records are accepted: once a keyring exists, anything unencrypted
+// under the vault path fails to load. When the plaintext records cannot be
+// removed afterwards the key shares are returned along with the error, since the
+// keyring has already been written.
+func InitVault(config *ContextConfig, shares, threshold int, provider vault.KeyProvider) ([][]byte, error) {
+	var commit func() error
+	rollback := func() {}
+	keys, err := vault.InitKeyringFunc(filepath.Join(config.VaultPath, vault.KeyringFile), shares, threshold, provider, func(key []byte) error {
+		barrier := vault.NewBarrier()
+		if err := barrier.Unseal(bytes.Clone(key)); err != nil {
+			return err
+		}
+		defer barrier.Seal()
+		var err error
+		commit, rollback, err = store.NewEncryptedJSONStore(config.VaultPath, barrier).EncryptPlaintext()
+		return err
+	})
+	if err != nil {
+		rollback()
+		return nil, err
+	}
+	if err := commit(); err != nil {
+		return keys, fmt.Errorf("removing plaintext records: %w", err)
+	}
+	return keys, nil
+}
+
+// SealStatus reports whether the vault has a keyring, whether it is sealed, and
+// how far along unsealing is.
+func (refs *ServerRefs) SealStatus() SealStatus {
+	refs.sealing.Lock()
+	defer refs.sealing.Unlock()
+	return refs.sealStatus()
+}
+
+func (refs *ServerRefs) sealStatus() SealStatus {
+	status := SealStatus{Sealed: refs.Barrier.Sealed(), Progress: len(refs.sealing.unseal)}
+	ring, err := vault.ReadKeyring(refs.KeyringPath())
+	status.Initialized = !errors.Is(err, vault.ErrNotInitialized)
+	if err == nil {
+		status.Shares, status.Threshold = ring.Shares, ring.Threshold
+	}
+	return status
+}
+
+// Unseal submits one key share. Once the threshold is met the unseal key is
+// recombined, the barrier key unwrapped and the store loaded; if that fails every
+// submitted share is discarded and unsealing starts over. Submitting a share to an
+// unsealed vault does nothing.
+func (refs *ServerRefs) Unseal(share []byte) (SealStatus, error) {
+	refs.sealing.Lock()
+	defer refs.sealing.Unlock()
+	if !refs.Barrier.Sealed() {
+		return refs.sealStatus(), nil
+	}
+	ring, err := vault.ReadKeyring(refs.KeyringPath())
+	if err != nil {
+		return refs.sealStatus(), err
+	}
+	submitted, err := addShare(refs.sealing.unseal, share, ring.Shares)
+	if err != nil {
+		return refs.sealStatus(), err
+	}
+	refs.sealing.unseal = submitted
+	if len(submitted) < ring.Threshold {
+		return refs.sealStatus(), nil
+	}
+
+	key, err := vault.OpenKeyring(refs.KeyringPath(), submitted)
+	refs.sealing.reset()
+	if err != nil {
+		return refs.sealStatus(), err
+	}
+	refs.enrollProvider(ring, key)
+	err = refs.open(key, "key shares")
+	return refs.sealStatus(), err
+}
+
+// AutoUnseal unseals the vault with the configured key provider. It does nothing
+// when no provider is configured or the vault is already unsealed, and fails with
+// vault.ErrNoProviderKey until the provider has been enrolled by unsealing with
+// key shares once.
+func (refs *ServerRefs) AutoUnseal() error {
+	provider, err := NewKeyProvider(refs.Config.Seal)
+	if err != nil || provider == nil {
+		return err
+	}
+	refs.sealing.Lock()
+	defer refs.sealing.Unlock()
+	if !refs.Barrier.Sealed() {
+		return nil
+	}
+	key, err := vault.OpenKeyringWithProvider(refs.KeyringPath(), provider)
+	if err != nil {
+		return err
+	}
+	return refs.open(key, provider.Name())
+}
+
+// open hands the barrier its key and loads the store, sealing again if the store
+// cannot be loaded.
+func (refs *ServerRefs) open(key []byte, via string) error {
+	if err := refs.Barrier.Unseal(key); err != nil {
+		return err
+	}
+	if err := refs.Store.Load(); err != nil {
+		refs.Barrier.Seal()
+		refs.Store.Unload()
+		return err
+	}
+	refs.Log.Info("vault unsealed", "via", via)
+	return nil
+}
+
+// enrollProvider wraps the barrier key with the configured key provider when the
+// keyring has nothing from it yet, so later boots can unseal without key shares.
+// A failure is logged rather than returned since the vault can still be unsealed.
+func (refs *ServerRefs) enrollProvider(ring vault.Keyring, key []byte) {
+	provider, err := NewKeyProvider(refs.Config.Seal)
+	if err == nil && (provider == nil || ring.Provider == provider.Name()) {
+		return
+	}
+	if err == nil {
+		err = vault.EnrollProvider(refs.KeyringPath(), key, provider)
+	}
+	if err != nil {
+		refs.Log.Error("enrolling key provider", "err", err)
+		return
+	}
+	refs.Log.Info("enrolled key provider for auto-unseal", "provider", provider.Name())
+}
+
+// NewKeyProvider builds the key provider chosen by c, or nil when none is.
+func NewKeyProvider(c SealConfig) (vault.KeyProvider, error) {
+	switch c.Provider {
+	case "":
+		return nil, nil
+	case "file":
+		if c.KeyFile == "" {
+			return nil, errors.New("the file key provider needs a key file")
+		}
+		return vault.NewFileKeyProvider(c.KeyFile), nil
+	case "transit":
+		if c.Transit.Address == "" || c.Transit.Key == "" {
+			return nil, errors.New("the transit key provider needs an address and key")
+		}
+		token := c.Transit.Token
+		if token == "" {
+			token = os.Getenv("GOVAULT_TRANSIT_TOKEN")
+		}
+		return vault.NewTransitKeyProvider(c.Transit.Address, c.Transit.Key, token), nil
+	default:
+		return nil, fmt.Errorf("unknown key provider %q", c.Provider)
+	}
+}
+
+// Seal wipes the barrier key, drops the store from memory and revokes every
+// session, so nothing can be read until the vault is unsealed again. Any unseal
+// or rekey in progress is abandoned.
+func (refs *ServerRefs) Seal() {
+	refs.sealing.Lock()
+	defer refs.sealing.Unlock()
+	refs.sealing.reset()
+	refs.Barrier.Seal()
+	refs.Store.Unload()
+	n := refs.Sessions.Revoke(func(Session) bool { return true })
+	refs.Log.Warn("vault sealed", "sessions_revoked", n)
+}
+
+// BeginRekey starts replacing the unseal key with one split into shares key
+// shares, threshold of which will be needed to unseal. It abandons any rekey
+// already in progress. The rekey only happens once the current threshold of key
+// shares have been submitted with SubmitRekeyShare.
+func (refs *ServerRefs) BeginRekey(shares, threshold int) (RekeyStatus, error) {
+	refs.sealing.Lock()
+	defer refs.sealing.Unlock()
+	if refs.Barrier.Sealed() {
+		return RekeyStatus{}, vault.ErrSealed
+	}
+	if shares < 1 || shares > 255 || threshold < 1 || threshold > shares {
+		return RekeyStatus{}, vault.ErrInvalidShares
+	}
+	ring, err := vault.ReadKeyring(refs.KeyringPath())
+	if err != nil {
+		return RekeyStatus{}, err
+	}
+	nonce, err := vault.GenerateRandBytes(16)
+	if err != nil {
+		return RekeyStatus{}, err
+	}
+	refs.sealing.reset()
+	refs.sealing.rekey = &RekeyStatus{
+		Nonce:     hex.EncodeToString(nonce),
+		Shares:    shares,
+		Threshold: threshold,
+		Required:  ring.Threshold,
+	}
+	return *refs.sealing.rekey, nil
+}
+
+// SubmitRekeyShare submits one current key share toward the rekey identified by
+// nonce. Once the threshold is met the new key shares are returned, and are the
+// only copy there will ever be.
+func (refs *ServerRefs) SubmitRekeyShare(nonce string, share []byte) (RekeyStatus, [][]byte, error) {
+	refs.sealing.Lock()
+	defer refs.sealing.Unlock()
+	rekey := refs.sealing.rekey
+	if rekey == nil {
+		return RekeyStatus{}, nil, e.NoRekeyInProgress
+	}
+	if nonce != rekey.Nonce {
+		return *rekey, nil, e.RekeyNonceMismatch
+	}
+	ring, err := vault.ReadKeyring(refs.KeyringPath())
+	if err != nil {
+		return *rekey, nil, err
+	}
+	submitted, err := addShare(refs.sealing.shares, share, ring.Shares)
+	if err != nil {
+		return *rekey, nil, err
+	}
+	refs.sealing.shares = submitted
+	rekey.Progress = len(submitted)
+	if len(submitted) < rekey.Required {
+		return *rekey, nil, nil
+	}
+
+	status := *rekey
+	shares, err := vault.RekeyKeyring(refs.KeyringPath(), submitted, rekey.Shares, rekey.Threshold)
+	refs.sealing.reset()
+	if err != nil {
+		return status, nil, err
+	}
+	refs.Log.Warn("vault rekeyed", "shares", status.Shares, "threshold", status.Threshold)
+	return status, shares, nil
+}
+
+// addShare appends a copy of share to submitted, rejecting a share with the same
+// x coordinate as one already submitted when the key is split.
+func addShare(submitted [][]byte, share []byte, shares int) ([][]byte, error) {
+	if len(share) == 0 {
+		return submitted, e.MissingUnsealKey
+	}
+	if shares > 1 {
+		for _, s := range submitted {
+			if vault.ShareX(s) == vault.ShareX(share) {
+				return submitted, vault.ErrDuplicateShare
+			}
+		}
+	}
+	return append(submitted, append([]byte(nil), share...)), nil
+}
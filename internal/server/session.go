@@ -1,65 +1,224 @@
 package server
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"sync"
 	"time"
 
+	e "github.com/jdpolicano/govault/internal/server/errors"
 	"github.com/jdpolicano/govault/internal/vault"
 )
 
 type Session struct {
-	User string
-	Key  []byte
-	TTL  int64
+	ID    string // the hex hash of the session's token, safe to log
+	User  string
+	Key   []byte
+	TTL   int64
+	Scope Scope  // what the session may touch, unrestricted for password logins
+	Uses  int    // remaining uses for a limited token, counting the request being served, zero means unlimited
+	Role  string // the machine identity that logged in, empty for users
+
+	// EnrollOnly marks a session that may do nothing but enroll a second factor,
+	// issued when policy requires one and the user has none yet.
+	EnrollOnly bool
 }
 
+// NewSession creates a session for user that expires after ttl. A ttl that is
+// zero or negative yields a session that is already expired.
 func NewSession(user string, key []byte, ttl time.Duration) Session {
 	eol := time.Now().Add(ttl).Unix()
-	return Session{user, key, eol}
+	return Session{User: user, Key: key, TTL: eol}
+}
+
+// Remaining returns how long the session has left to live.
+func (s Session) Remaining() time.Duration {
+	return time.Until(time.Unix(s.TTL, 0))
 }
 
+// Expired reports whether the session is past its end of life. The zero Session
+// is always expired.
 func (s Session) Expired() bool {
+	if s.TTL <= 0 {
+		return true
+	}
 	expiry := time.Unix(s.TTL, 0)
-	return time.Now().After(expiry)
+	return !time.Now().Before(expiry)
+}
+
+// sessionDigest is the fixed size lookup key for a session token. Sessions are
+// indexed by the hash of their token rather than the token itself so that a map
+// lookup never compares attacker supplied bytes against a live token.
+type sessionDigest [sha256.Size]byte
+
+func digestToken(token string) sessionDigest {
+	return sha256.Sum256([]byte(token))
 }
 
 type SessionMap struct {
 	sync.RWMutex
-	sessions map[string]Session // a map from a session key to
+	sessions map[sessionDigest]Session // a map from a hashed session token to its session
 }
 
 func NewSessionMap() *SessionMap {
-	return &SessionMap{sessions: make(map[string]Session, 1024)}
+	return &SessionMap{sessions: make(map[sessionDigest]Session, 1024)}
 }
 
 func (s *SessionMap) Get(key string) (Session, bool) {
+	d := digestToken(key)
 	s.RLock()
 	defer s.RUnlock()
-	sess, exists := s.sessions[key]
+	sess, exists := s.sessions[d]
 	return sess, exists
 }
 
 func (s *SessionMap) Set(key string, sess Session) {
+	d := digestToken(key)
+	sess.ID = hex.EncodeToString(d[:])
 	s.Lock()
 	defer s.Unlock()
-	s.sessions[key] = sess
+	s.sessions[d] = sess
 }
 
 func (s *SessionMap) Delete(key string) {
+	d := digestToken(key)
 	s.Lock()
 	defer s.Unlock()
-	delete(s.sessions, key)
+	delete(s.sessions, d)
+}
+
+// Len reports how many sessions are held, including expired ones not yet evicted.
+func (s *SessionMap) Len() int {
+	s.RLock()
+	defer s.RUnlock()
+	return len(s.sessions)
+}
+
+// SessionStats breaks down the sessions held in memory.
+type SessionStats struct {
+	Total   int `json:"total"`
+	Expired int `json:"expired"` // expired but not yet evicted
+	Scoped  int `json:"scoped"`  // child tokens minted from another session
+	Role    int `json:"role"`    // sessions opened by an approle login
+}
+
+// Stats counts the sessions held by kind.
+func (s *SessionMap) Stats() SessionStats {
+	s.RLock()
+	defer s.RUnlock()
+	stats := SessionStats{Total: len(s.sessions)}
+	for _, sess := range s.sessions {
+		switch {
+		case sess.Expired():
+			stats.Expired++
+		case sess.Role != "":
+			stats.Role++
+		case !sess.Scope.Unrestricted() || sess.Uses > 0:
+			stats.Scoped++
+		}
+	}
+	return stats
+}
+
+// Use fetches the session for key and spends one of its uses if it is limited.
+// The session is returned as it was before the use was spent.
+func (s *SessionMap) Use(key string) (Session, bool) {
+	d := digestToken(key)
+	s.Lock()
+	defer s.Unlock()
+	return s.spend(d)
+}
+
+// Spend spends one use of sess, a session fetched earlier with Get, reporting
+// false if it has since been removed or its uses have run out. Requests spend a
+// use only once they have been authorized, so refused requests cost nothing.
+func (s *SessionMap) Spend(sess Session) bool {
+	id, err := hex.DecodeString(sess.ID)
+	if err != nil || len(id) != sha256.Size {
+		return false
+	}
+	s.Lock()
+	defer s.Unlock()
+	_, ok := s.spend(sessionDigest(id))
+	return ok
+}
+
+// spend spends a use of the session under d if it is limited. A session is
+// removed once its last use has been spent.
+func (s *SessionMap) spend(d sessionDigest) (Session, bool) {
+	sess, exists := s.sessions[d]
+	if !exists || sess.Uses == 0 || sess.Expired() {
+		return sess, exists
+	}
+	if sess.Uses == 1 {
+		delete(s.sessions, d)
+	} else {
+		spent := sess
+		spent.Uses--
+		s.sessions[d] = spent
+	}
+	return sess, true
+}
+
+// Revoke removes every session for which match returns true and reports how many were removed.
+func (s *SessionMap) Revoke(match func(Session) bool) int {
+	s.Lock()
+	defer s.Unlock()
+	n := 0
+	for d, sess := range s.sessions {
+		if match(sess) {
+			delete(s.sessions, d)
+			n++
+		}
+	}
+	return n
 }
 
 func (s *SessionMap) CreateUserSession(username string, key []byte, ttl time.Duration) (string, error) {
+	return s.CreateSession(NewSession(username, key, ttl))
+}
+
+// CreateSession stores sess under a newly generated token and returns the token,
+// carrying TokenPrefix as every token handed out does.
+func (s *SessionMap) CreateSession(sess Session) (string, error) {
 	sessId, err := GenerateSessionID()
 	if err != nil {
 		return "", err
 	}
-	sess := NewSession(username, key, ttl)
-	s.Set(sessId, sess)
-	return sessId, nil
+	token := TokenPrefix + sessId
+	s.Set(token, sess)
+	return token, nil
+}
+
+// CreateScopedSession mints a token derived from parent. The scope must not grant
+// more than the parent's scope and the lifetime is capped at the parent's. A
+// child of a role session is a session of the same role, and a child of a
+// limited token must be limited too, to no more uses than the parent has left
+// after the request minting it.
+func (s *SessionMap) CreateScopedSession(parent Session, scope Scope, ttl time.Duration, uses int) (string, error) {
+	scope, err := parent.Scope.Narrow(scope)
+	if err != nil {
+		return "", err
+	}
+	if remaining := parent.Remaining(); ttl <= 0 || ttl > remaining {
+		ttl = remaining
+	}
+	uses = max(uses, 0)
+	if parent.Uses > 0 {
+		left := parent.Uses - 1
+		if uses == 0 || left == 0 {
+			return "", fmt.Errorf("%w: a limited token can only mint tokens with fewer uses", e.ScopeEscalation)
+		}
+		uses = min(uses, left)
+	}
+	sess := NewSession(parent.User, parent.Key, ttl)
+	sess.Scope = scope
+	sess.Uses = uses
+	sess.Role = parent.Role
+	sess.EnrollOnly = parent.EnrollOnly
+	return s.CreateSession(sess)
 }
 
 // GenerateSessionID generates a cryptographically secure, random session ID.
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"time"
+
+	"github.com/jdpolicano/govault/internal/audit"
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+// Version is the server version, set at build time with
+// -ldflags "-X github.com/jdpolicano/govault/internal/server.Version=...".
+var Version = "dev"
+
+// ReadyCheck is the outcome of one readiness check.
+type ReadyCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Status describes the running server.
+type Status struct {
+	Version  string             `json:"version"`
+	Started  time.Time          `json:"started"`
+	Uptime   int64              `json:"uptime_seconds"`
+	Store    string             `json:"store"`
+	Seal     SealStatus         `json:"seal"`
+	Sessions SessionStats       `json:"sessions"`
+	Audit    []audit.SinkStatus `json:"audit,omitempty"`
+}
+
+// Readiness runs every readiness check and reports whether all of them passed.
+// The server is ready once it is unsealed with the store loaded and writable and,
+// when auditing is enabled, at least one audit sink is recording events.
+func (refs *ServerRefs) Readiness() ([]ReadyCheck, bool) {
+	var sealErr error
+	if refs.Barrier.Sealed() {
+		sealErr = vault.ErrSealed
+	}
+	checks := []ReadyCheck{readyCheck("seal", sealErr), readyCheck("store", refs.Store.Ready())}
+	if refs.Audit != nil {
+		checks = append(checks, readyCheck("audit", refs.Audit.Healthy()))
+	}
+	ready := true
+	for _, c := range checks {
+		ready = ready && c.OK
+	}
+	return checks, ready
+}
+
+func readyCheck(name string, err error) ReadyCheck {
+	if err != nil {
+		return ReadyCheck{Name: name, Error: err.Error()}
+	}
+	return ReadyCheck{Name: name, OK: true}
+}
+
+// Status reports the version, uptime, store backend and sessions of the server.
+func (refs *ServerRefs) Status() Status {
+	st := Status{
+		Version:  Version,
+		Started:  refs.Started,
+		Uptime:   int64(time.Since(refs.Started).Seconds()),
+		Store:    refs.Store.Backend(),
+		Seal:     refs.SealStatus(),
+		Sessions: refs.Sessions.Stats(),
+	}
+	if refs.Audit != nil {
+		st.Audit = refs.Audit.Status()
+	}
+	return st
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"io"
+
+	"github.com/jdpolicano/govault/internal/store"
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+type secretStream struct {
+	io.Reader
+	io.Closer
+}
+
+// OpenSecretStream returns a reader of a secret the file routes streamed into
+// the store, decrypted with the session's key as it is read. Reads fail with
+// vault.ErrStreamCorrupt if the stored stream was tampered with.
+func (refs *ServerRefs) OpenSecretStream(sess Session, key string) (io.ReadCloser, error) {
+	blob, err := refs.Store.OpenStream(sess.User, key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := vault.NewStreamReader(sess.Key, blob)
+	if err != nil {
+		blob.Close()
+		return nil, err
+	}
+	return secretStream{plain, blob}, nil
+}
+
+// ReadSecret returns the plaintext of value, the secret stored under key. A
+// streamed secret is read into memory only if it holds no more than
+// MaxSecretSize bytes, and fails with e.SecretTooLarge otherwise.
+func (refs *ServerRefs) ReadSecret(sess Session, key string, value store.CipherText) ([]byte, error) {
+	if value.Blob == "" {
+		return vault.Decrypt(value.Nonce, sess.Key, value.Text)
+	}
+	stream, err := refs.OpenSecretStream(sess, key)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	plain, err := io.ReadAll(io.LimitReader(stream, refs.Config.MaxSecretSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if err := refs.Config.CheckSecretSize(int64(len(plain))); err != nil {
+		return nil, err
+	}
+	return plain, nil
+}
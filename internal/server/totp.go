@@ -0,0 +1,170 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"slices"
+	"time"
+
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/store"
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+// TOTPPolicy decides whether users must enroll a second factor.
+type TOTPPolicy string
+
+const (
+	TOTPDisabled TOTPPolicy = "disabled" // no new enrollments, existing ones are still enforced
+	TOTPOptional TOTPPolicy = "optional" // users choose whether to enroll
+	TOTPRequired TOTPPolicy = "required" // users without a second factor can only enroll one
+)
+
+// recoveryCodeCount is how many recovery codes a confirmed enrollment hands out.
+const recoveryCodeCount = 10
+
+// TOTPEnrollment is returned when a user starts enrolling a second factor.
+type TOTPEnrollment struct {
+	URI    string `json:"uri"`    // the otpauth:// uri to load or render as a QR code
+	Secret string `json:"secret"` // the base32 seed for manual entry
+}
+
+// HasSecondFactor reports whether the user has a confirmed TOTP enrollment.
+func HasSecondFactor(user store.User) bool {
+	return user.TOTP != nil && user.TOTP.Enabled
+}
+
+// NeedsEnrollment reports whether policy forces user to enroll before doing anything else.
+func NeedsEnrollment(policy TOTPPolicy, user store.User) bool {
+	return policy == TOTPRequired && !HasSecondFactor(user)
+}
+
+// BeginTOTPEnrollment creates a new unconfirmed seed for user, sealed with key.
+// Any previous unconfirmed enrollment is replaced.
+func BeginTOTPEnrollment(user *store.User, key []byte, issuer string) (TOTPEnrollment, error) {
+	if HasSecondFactor(*user) {
+		return TOTPEnrollment{}, e.TOTPAlreadyEnrolled
+	}
+	seed, err := vault.GenerateTOTPSecret()
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	cipher, nonce, err := vault.EncryptBytes(key, seed)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	user.TOTP = &store.TOTP{Seed: store.CipherText{Nonce: nonce, Text: cipher}}
+	return TOTPEnrollment{
+		URI:    vault.TOTPURI(issuer, user.Name, seed),
+		Secret: vault.EncodeTOTPSecret(seed),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment enables a pending enrollment once the user proves they
+// can generate codes, and returns the recovery codes to show them exactly once.
+func ConfirmTOTPEnrollment(user *store.User, key []byte, code string, now time.Time) ([]string, error) {
+	if user.TOTP == nil || user.TOTP.Enabled {
+		return nil, e.TOTPNotPending
+	}
+	next := user.TOTP.Clone()
+	if err := checkTOTPCode(next, key, code, now); err != nil {
+		return nil, err
+	}
+	codes, err := vault.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	next.RecoveryCodes = make([][]byte, len(codes))
+	for i, c := range codes {
+		next.RecoveryCodes[i] = vault.HashRecoveryCode(user.Salt, c)
+	}
+	next.Enabled = true
+	user.TOTP = next
+	return codes, nil
+}
+
+// CheckSecondFactor verifies code, either a current TOTP code or an unused recovery
+// code, for a user whose password has already been checked. On success user.TOTP
+// is replaced with a copy that has the code burnt; the enrollment it held before
+// is left as it was, to be swapped out of the store with Store.SwapTOTP.
+func CheckSecondFactor(user *store.User, key []byte, code string, now time.Time) error {
+	if !HasSecondFactor(*user) {
+		return nil
+	}
+	if code == "" {
+		return e.OTPRequired
+	}
+	next := user.TOTP.Clone()
+	if err := checkTOTPCode(next, key, code, now); err == nil {
+		user.TOTP = next
+		return nil
+	}
+	hash := vault.HashRecoveryCode(user.Salt, code)
+	for i, stored := range next.RecoveryCodes {
+		if subtle.ConstantTimeCompare(hash, stored) == 1 {
+			next.RecoveryCodes = slices.Delete(next.RecoveryCodes, i, i+1)
+			user.TOTP = next
+			return nil
+		}
+	}
+	return e.IncorrectOTP
+}
+
+// swapRetries bounds how often a second factor check is retried after losing a
+// race with another change to the same enrollment.
+const swapRetries = 3
+
+// BurnSecondFactor checks code against the stored second factor of user, as
+// CheckSecondFactor does, and burns it in the store in the same step, so that
+// concurrent logins can't both accept one code.
+func (refs *ServerRefs) BurnSecondFactor(user string, key []byte, code string, now time.Time) error {
+	return refs.swapSecondFactor(user, key, code, now, false)
+}
+
+// DisableSecondFactor removes the second factor of user once code checks out.
+func (refs *ServerRefs) DisableSecondFactor(user string, key []byte, code string, now time.Time) error {
+	return refs.swapSecondFactor(user, key, code, now, true)
+}
+
+func (refs *ServerRefs) swapSecondFactor(name string, key []byte, code string, now time.Time, remove bool) error {
+	var err error
+	for range swapRetries {
+		user, exists := refs.Store.GetUserInfo(name)
+		if !exists {
+			return e.NewNoSuchUserError(name)
+		}
+		if !HasSecondFactor(user) {
+			if remove {
+				return e.TOTPNotPending
+			}
+			return nil
+		}
+		old := user.TOTP
+		if err := CheckSecondFactor(&user, key, code, now); err != nil {
+			return err
+		}
+		if remove {
+			user.TOTP = nil
+		}
+		// losing the race means the enrollment changed, perhaps by this very
+		// code being burnt, so it is checked again against the new state.
+		if err = refs.Store.SwapTOTP(name, old, user.TOTP); !errors.Is(err, store.ErrTOTPChanged) {
+			return err
+		}
+	}
+	return err
+}
+
+// checkTOTPCode validates code against the sealed seed and records its time step.
+func checkTOTPCode(t *store.TOTP, key []byte, code string, now time.Time) error {
+	seed, err := vault.Decrypt(t.Seed.Nonce, key, t.Seed.Text)
+	if err != nil {
+		return err
+	}
+	step, ok := vault.ValidateTOTP(seed, code, now)
+	if !ok || step <= t.LastStep {
+		return e.IncorrectOTP
+	}
+	t.LastStep = step
+	return nil
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"maps"
+	"slices"
+
+	e "github.com/jdpolicano/govault/internal/server/errors"
+)
+
+// IsAdmin reports whether user is an administrator, either named in config or
+// promoted through the admin api.
+func (refs *ServerRefs) IsAdmin(user string) bool {
+	if refs.Config.IsAdmin(user) {
+		return true
+	}
+	record, _ := refs.Store.GetUserInfo(user)
+	return record.Admin
+}
+
+// Logout revokes every session of user, their roles' included, and reports how
+// many were revoked.
+func (refs *ServerRefs) Logout(user string) int {
+	return refs.Sessions.Revoke(func(s Session) bool { return s.User == user })
+}
+
+// DisableUser stops user from logging in and ends their sessions, or lets them
+// log in again when disabled is false.
+func (refs *ServerRefs) DisableUser(user string, disabled bool) error {
+	record, exists := refs.Store.GetUserInfo(user)
+	if !exists {
+		return e.NewNoSuchUserError(user)
+	}
+	record.Disabled = disabled
+	if err := refs.Store.UpdateUser(record); err != nil {
+		return err
+	}
+	if disabled {
+		refs.Logout(user)
+	}
+	return nil
+}
+
+// DeleteUser removes user with their secrets and roles, ending their sessions and
+// dropping them from every group. Their copy of each group key was wrapped to a
+// private key that is deleted with them, so the group keys are left in place. A
+// group they leave without an admin has its first remaining member promoted.
+func (refs *ServerRefs) DeleteUser(user string) error {
+	if !refs.Store.HasUser(user) {
+		return e.NewNoSuchUserError(user)
+	}
+	refs.Logout(user)
+	for _, group := range refs.Store.ListGroups(user) {
+		delete(group.Members, user)
+		if len(group.Members) > 0 && groupAdmins(group) == 0 {
+			names := slices.Sorted(maps.Keys(group.Members))
+			m := group.Members[names[0]]
+			m.Admin = true
+			group.Members[names[0]] = m
+		}
+		if err := refs.Store.UpdateGroup(group); err != nil {
+			return err
+		}
+	}
+	return refs.Store.DeleteUser(user)
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Values written with SetStream are kept as blobs beside the user's record, in
+// users/<id>/blobs/<blob>, and the record only names the blob. Blob names are
+// random so they reveal nothing of the key they are stored under. A blob is
+// written in full under a temporary name before the record refers to it, and
+// blobs no record refers to, such as those left behind by a crash, are removed
+// as the store is loaded.
+const (
+	blobsDir   = "blobs"
+	blobTmpExt = ".tmp"
+)
+
+// ErrNotStream is returned by OpenStream for a secret held in its record rather
+// than in a blob.
+var ErrNotStream = errors.New("secret is not stored as a stream")
+
+type blobReader struct {
+	io.Reader
+	io.Closer
+}
+
+// blobPath is where the blob named id of a user is kept.
+func (js *JSONStore) blobPath(user, id string) (string, error) {
+	path, err := js.getUserPath(user)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), blobsDir, id), nil
+}
+
+// SetStream is Set for a value read from r, which is copied to a blob without
+// holding the store's lock or the value in memory.
+func (js *JSONStore) SetStream(name, key string, r io.Reader, meta Metadata) error {
+	id := strings.ToLower(rand.Text())
+	js.RLock()
+	_, exists := js.data[name]
+	path, err := js.blobPath(name, id)
+	js.RUnlock()
+	if !exists {
+		return fmt.Errorf("err user %s does not exist", name)
+	}
+	if err != nil {
+		return err
+	}
+	if err := js.writeBlob(path+blobTmpExt, r); err != nil {
+		os.Remove(path + blobTmpExt)
+		return err
+	}
+
+	js.Lock()
+	defer js.Unlock()
+	record, exists := js.data[name]
+	if !exists {
+		os.Remove(path + blobTmpExt)
+		return fmt.Errorf("err user %s does not exist", name)
+	}
+	if err := os.Rename(path+blobTmpExt, path); err != nil {
+		os.Remove(path + blobTmpExt)
+		return err
+	}
+	if err := js.put(record, key, CipherText{Blob: id}, meta); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// OpenStream reads the value of a secret stored with SetStream. A blob that is
+// replaced or deleted while it is being read can still be read to the end.
+func (js *JSONStore) OpenStream(name, key string) (io.ReadCloser, error) {
+	js.RLock()
+	defer js.RUnlock()
+	record, exists := js.data[name]
+	if !exists {
+		return nil, fmt.Errorf("err user %s does not exist", name)
+	}
+	value, exists := record.Secrets[key]
+	if !exists {
+		return nil, NewNoSuchSecretError(key)
+	}
+	if value.Blob == "" {
+		return nil, ErrNotStream
+	}
+	path, err := js.blobPath(name, value.Blob)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil || js.cipher == nil {
+		return f, err
+	}
+	plain, err := js.cipher.DecryptStream(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("err decrypting %s: %w", path, err)
+	}
+	return blobReader{plain, f}, nil
+}
+
+// writeBlob copies r to a new blob at path, encrypted when the store has a cipher.
+func (js *JSONStore) writeBlob(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	var dst io.Writer = f
+	var stream io.WriteCloser
+	if js.cipher != nil {
+		if stream, err = js.cipher.EncryptStream(f); err != nil {
+			f.Close()
+			return err
+		}
+		dst = stream
+	}
+	_, err = io.Copy(dst, r)
+	if err == nil && stream != nil {
+		err = stream.Close()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// removeBlobs removes the blobs of values no longer in a record. Failures are
+// left for the sweep on the next load.
+func (js *JSONStore) removeBlobs(user string, values ...CipherText) {
+	for _, value := range values {
+		if value.Blob == "" {
+			continue
+		}
+		if path, err := js.blobPath(user, value.Blob); err == nil {
+			os.Remove(path)
+		}
+	}
+}
+
+// sweepBlobs removes the blobs of a user that their record doesn't refer to.
+func (js *JSONStore) sweepBlobs(record JSONRecord) error {
+	dir, err := js.blobPath(record.User.Name, "")
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	kept := make(map[string]bool)
+	for _, value := range record.Secrets {
+		if value.Blob != "" {
+			kept[value.Blob] = true
+		}
+	}
+	for _, entry := range entries {
+		if !kept[entry.Name()] {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+	return nil
+}
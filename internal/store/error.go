@@ -1,6 +1,15 @@
 package store
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrNotLoaded = errors.New("store has not been loaded")
+
+// ErrUnknownLayout is returned by Load for a vault path laid out by a newer
+// store, or with encryption when the store has none or the other way around.
+var ErrUnknownLayout = errors.New("vault path has a layout this store can't read")
 
 type UserAlreadyExistsError struct {
 	name string
@@ -13,3 +22,103 @@ func NewAlreadyExistsError(name string) UserAlreadyExistsError {
 func (e UserAlreadyExistsError) Error() string {
 	return fmt.Sprintf("err user %s already exists", e.name)
 }
+
+type NoSuchRoleError struct {
+	id string
+}
+
+func NewNoSuchRoleError(id string) NoSuchRoleError {
+	return NoSuchRoleError{id}
+}
+
+func (e NoSuchRoleError) Error() string {
+	return fmt.Sprintf("err role %s does not exist", e.id)
+}
+
+type GroupAlreadyExistsError struct {
+	name string
+}
+
+func NewGroupAlreadyExistsError(name string) GroupAlreadyExistsError {
+	return GroupAlreadyExistsError{name}
+}
+
+func (e GroupAlreadyExistsError) Error() string {
+	return fmt.Sprintf("err group %s already exists", e.name)
+}
+
+type NoSuchGroupError struct {
+	name string
+}
+
+func NewNoSuchGroupError(name string) NoSuchGroupError {
+	return NoSuchGroupError{name}
+}
+
+func (e NoSuchGroupError) Error() string {
+	return fmt.Sprintf("err group %s does not exist", e.name)
+}
+
+type NoSuchPolicyError struct {
+	name string
+}
+
+func NewNoSuchPolicyError(name string) NoSuchPolicyError {
+	return NoSuchPolicyError{name}
+}
+
+func (e NoSuchPolicyError) Error() string {
+	return fmt.Sprintf("err policy %s does not exist", e.name)
+}
+
+type NoSuchInviteError struct {
+	id string
+}
+
+func NewNoSuchInviteError(id string) NoSuchInviteError {
+	return NoSuchInviteError{id}
+}
+
+func (e NoSuchInviteError) Error() string {
+	return fmt.Sprintf("err invite %s does not exist", e.id)
+}
+
+// ErrInvalidPath is returned for a secret key or prefix that isn't a path, such as
+// one with empty segments.
+var ErrInvalidPath = errors.New("invalid secret path")
+
+type NoSuchSecretError struct {
+	key string
+}
+
+func NewNoSuchSecretError(key string) NoSuchSecretError {
+	return NoSuchSecretError{key}
+}
+
+func (e NoSuchSecretError) Error() string {
+	return fmt.Sprintf("err secret %s does not exist", e.key)
+}
+
+type SecretExistsError struct {
+	key string
+}
+
+func NewSecretExistsError(key string) SecretExistsError {
+	return SecretExistsError{key}
+}
+
+func (e SecretExistsError) Error() string {
+	return fmt.Sprintf("err secret %s already exists", e.key)
+}
+
+// ErrSecretChanged is returned when a secret was written between being read and
+// replaced.
+var ErrSecretChanged = errors.New("secret was changed concurrently, retry")
+
+// ErrTOTPChanged is returned when a user's second factor was changed between
+// being read and being written back, such as by a concurrent login burning a code.
+var ErrTOTPChanged = errors.New("second factor was changed concurrently, retry")
+
+// ErrGroupChanged is returned when a group was modified between being read and
+// written back, or its key replaced while a secret was being written.
+var ErrGroupChanged = errors.New("group was changed concurrently, retry")
@@ -0,0 +1,235 @@
+package store
+
+import (
+	"io"
+	"time"
+)
+
+// Observer is told how long each store operation took and whether it failed.
+type Observer func(op string, took time.Duration, err error)
+
+// Instrumented wraps a Store and reports every call to an Observer.
+type Instrumented struct {
+	inner   Store
+	observe Observer
+}
+
+func NewInstrumented(inner Store, observe Observer) *Instrumented {
+	return &Instrumented{inner, observe}
+}
+
+// Unwrap returns the store being instrumented.
+func (s *Instrumented) Unwrap() Store {
+	return s.inner
+}
+
+func (s *Instrumented) track(op string, start time.Time, err error) {
+	s.observe(op, time.Since(start), err)
+}
+
+func (s *Instrumented) GetUserInfo(name string) (User, bool) {
+	defer s.track("get_user", time.Now(), nil)
+	return s.inner.GetUserInfo(name)
+}
+
+func (s *Instrumented) AddUser(name string, login, salt []byte) (err error) {
+	defer func(start time.Time) { s.track("add_user", start, err) }(time.Now())
+	return s.inner.AddUser(name, login, salt)
+}
+
+func (s *Instrumented) UpdateUser(user User) (err error) {
+	defer func(start time.Time) { s.track("update_user", start, err) }(time.Now())
+	return s.inner.UpdateUser(user)
+}
+
+func (s *Instrumented) SwapTOTP(name string, old, next *TOTP) (err error) {
+	defer func(start time.Time) { s.track("swap_totp", start, err) }(time.Now())
+	return s.inner.SwapTOTP(name, old, next)
+}
+
+func (s *Instrumented) HasUser(name string) bool {
+	defer s.track("has_user", time.Now(), nil)
+	return s.inner.HasUser(name)
+}
+
+func (s *Instrumented) DeleteUser(name string) (err error) {
+	defer func(start time.Time) { s.track("delete_user", start, err) }(time.Now())
+	return s.inner.DeleteUser(name)
+}
+
+func (s *Instrumented) ListUsers() []User {
+	defer s.track("list_users", time.Now(), nil)
+	return s.inner.ListUsers()
+}
+
+func (s *Instrumented) Get(name, key string) (CipherText, bool) {
+	defer s.track("get", time.Now(), nil)
+	return s.inner.Get(name, key)
+}
+
+func (s *Instrumented) Set(name, key string, value CipherText, meta Metadata) (err error) {
+	defer func(start time.Time) { s.track("set", start, err) }(time.Now())
+	return s.inner.Set(name, key, value, meta)
+}
+
+func (s *Instrumented) Replace(name, key string, old, value CipherText, meta Metadata) (err error) {
+	defer func(start time.Time) { s.track("replace", start, err) }(time.Now())
+	return s.inner.Replace(name, key, old, value, meta)
+}
+
+func (s *Instrumented) SetStream(name, key string, r io.Reader, meta Metadata) (err error) {
+	defer func(start time.Time) { s.track("set_stream", start, err) }(time.Now())
+	return s.inner.SetStream(name, key, r, meta)
+}
+
+func (s *Instrumented) OpenStream(name, key string) (rc io.ReadCloser, err error) {
+	defer func(start time.Time) { s.track("open_stream", start, err) }(time.Now())
+	return s.inner.OpenStream(name, key)
+}
+
+func (s *Instrumented) GetMetadata(name, key string) (Metadata, bool) {
+	defer s.track("get_metadata", time.Now(), nil)
+	return s.inner.GetMetadata(name, key)
+}
+
+func (s *Instrumented) SetMetadata(name, key string, meta Metadata) (err error) {
+	defer func(start time.Time) { s.track("set_metadata", start, err) }(time.Now())
+	return s.inner.SetMetadata(name, key, meta)
+}
+
+func (s *Instrumented) List(name, prefix, cursor string, limit int, labels map[string]string) (page ListPage, err error) {
+	defer func(start time.Time) { s.track("list", start, err) }(time.Now())
+	return s.inner.List(name, prefix, cursor, limit, labels)
+}
+
+func (s *Instrumented) Delete(name, key string) (err error) {
+	defer func(start time.Time) { s.track("delete", start, err) }(time.Now())
+	return s.inner.Delete(name, key)
+}
+
+func (s *Instrumented) DeleteTree(name, prefix string) (n int, err error) {
+	defer func(start time.Time) { s.track("delete_tree", start, err) }(time.Now())
+	return s.inner.DeleteTree(name, prefix)
+}
+
+func (s *Instrumented) Move(name, from, to string) (n int, err error) {
+	defer func(start time.Time) { s.track("move", start, err) }(time.Now())
+	return s.inner.Move(name, from, to)
+}
+
+func (s *Instrumented) SetRole(role Role) (err error) {
+	defer func(start time.Time) { s.track("set_role", start, err) }(time.Now())
+	return s.inner.SetRole(role)
+}
+
+func (s *Instrumented) GetRole(id string) (Role, bool) {
+	defer s.track("get_role", time.Now(), nil)
+	return s.inner.GetRole(id)
+}
+
+func (s *Instrumented) DeleteRole(owner, id string) (err error) {
+	defer func(start time.Time) { s.track("delete_role", start, err) }(time.Now())
+	return s.inner.DeleteRole(owner, id)
+}
+
+func (s *Instrumented) ListRoles(owner string) []Role {
+	defer s.track("list_roles", time.Now(), nil)
+	return s.inner.ListRoles(owner)
+}
+
+func (s *Instrumented) AddGroup(group Group) (err error) {
+	defer func(start time.Time) { s.track("add_group", start, err) }(time.Now())
+	return s.inner.AddGroup(group)
+}
+
+func (s *Instrumented) UpdateGroup(group Group) (err error) {
+	defer func(start time.Time) { s.track("update_group", start, err) }(time.Now())
+	return s.inner.UpdateGroup(group)
+}
+
+func (s *Instrumented) GetGroup(name string) (Group, bool) {
+	defer s.track("get_group", time.Now(), nil)
+	return s.inner.GetGroup(name)
+}
+
+func (s *Instrumented) ListGroups(member string) []Group {
+	defer s.track("list_groups", time.Now(), nil)
+	return s.inner.ListGroups(member)
+}
+
+func (s *Instrumented) GetGroupSecret(group, key string) (CipherText, bool) {
+	defer s.track("get_group_secret", time.Now(), nil)
+	return s.inner.GetGroupSecret(group, key)
+}
+
+func (s *Instrumented) SetGroupSecret(group string, epoch int, key string, value CipherText) (err error) {
+	defer func(start time.Time) { s.track("set_group_secret", start, err) }(time.Now())
+	return s.inner.SetGroupSecret(group, epoch, key, value)
+}
+
+func (s *Instrumented) AddInvite(invite Invite) (err error) {
+	defer func(start time.Time) { s.track("add_invite", start, err) }(time.Now())
+	return s.inner.AddInvite(invite)
+}
+
+func (s *Instrumented) TakeInvite(hash string) (Invite, bool) {
+	defer s.track("take_invite", time.Now(), nil)
+	return s.inner.TakeInvite(hash)
+}
+
+func (s *Instrumented) DeleteInvite(id string) (err error) {
+	defer func(start time.Time) { s.track("delete_invite", start, err) }(time.Now())
+	return s.inner.DeleteInvite(id)
+}
+
+func (s *Instrumented) ListInvites() []Invite {
+	defer s.track("list_invites", time.Now(), nil)
+	return s.inner.ListInvites()
+}
+
+func (s *Instrumented) GetSetting(name string) (string, bool) {
+	defer s.track("get_setting", time.Now(), nil)
+	return s.inner.GetSetting(name)
+}
+
+func (s *Instrumented) SetSetting(name, value string) (err error) {
+	defer func(start time.Time) { s.track("set_setting", start, err) }(time.Now())
+	return s.inner.SetSetting(name, value)
+}
+
+func (s *Instrumented) SetPolicy(policy Policy) (err error) {
+	defer func(start time.Time) { s.track("set_policy", start, err) }(time.Now())
+	return s.inner.SetPolicy(policy)
+}
+
+func (s *Instrumented) GetPolicy(name string) (Policy, bool) {
+	defer s.track("get_policy", time.Now(), nil)
+	return s.inner.GetPolicy(name)
+}
+
+func (s *Instrumented) DeletePolicy(name string) (err error) {
+	defer func(start time.Time) { s.track("delete_policy", start, err) }(time.Now())
+	return s.inner.DeletePolicy(name)
+}
+
+func (s *Instrumented) ListPolicies() []Policy {
+	defer s.track("list_policies", time.Now(), nil)
+	return s.inner.ListPolicies()
+}
+
+func (s *Instrumented) Load() (err error) {
+	defer func(start time.Time) { s.track("load", start, err) }(time.Now())
+	return s.inner.Load()
+}
+
+func (s *Instrumented) Unload() {
+	s.inner.Unload()
+}
+
+func (s *Instrumented) Ready() error {
+	return s.inner.Ready()
+}
+
+func (s *Instrumented) Backend() string {
+	return s.inner.Backend()
+}
@@ -3,36 +3,90 @@ package store
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 )
 
 type JSONRecord struct {
 	User    User                  `json:"user"`
 	Secrets map[string]CipherText `json:"secrets"`
+	Roles   map[string]Role       `json:"roles,omitempty"`
+
+	Metadata map[string]Metadata `json:"metadata,omitempty"` // by secret key
 }
 
 func NewJSONRecord(user User) JSONRecord {
-	return JSONRecord{user, make(map[string]CipherText, 256)}
+	return JSONRecord{User: user, Secrets: make(map[string]CipherText, 256), Metadata: make(map[string]Metadata)}
+}
+
+// restore puts back the secrets and metadata of record as they were before a
+// change that couldn't be written to disk.
+func (record JSONRecord) restore(secrets map[string]CipherText, meta map[string]Metadata) {
+	clear(record.Secrets)
+	maps.Copy(record.Secrets, secrets)
+	clear(record.Metadata)
+	maps.Copy(record.Metadata, meta)
 }
 
+// invitesFile holds every unused invite.
+const invitesFile = "invites.json"
+
+// settingsFile holds the server settings changed while it runs.
+const settingsFile = "settings.json"
+
 // in memory and file backed json store.
 type JSONStore struct {
 	sync.RWMutex
 	vaultPath string                // the path to the store's location
 	data      map[string]JSONRecord // the in memory store, backed by a json file
+	roles     map[string]string     // an index from role id to the owning user
+	groups    map[string]Group      // shared vaults by name
+	policies  map[string]Policy     // access policies by name
+	invites   map[string]Invite     // unused invites by code hash
+	settings  map[string]string     // server settings by name
+	loaded    bool                  // whether Load has read in the records on disk
+	cipher    Cipher                // encrypts records on their way to disk, nil to write them in the clear
+}
+
+// Cipher encrypts whole records before they are written and decrypts them as
+// they are loaded. Index maps a user name to the opaque identifier its record is
+// stored under, so the layout on disk does not reveal who has an account.
+// EncryptStream and DecryptStream do the same for blobs, which are too large to
+// hold in memory.
+type Cipher interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+	Index(name string) (string, error)
+	EncryptStream(dst io.Writer) (io.WriteCloser, error)
+	DecryptStream(src io.Reader) (io.Reader, error)
 }
 
-// todo: since we have the vault path, we should setup the store based on whatever was there before!
 // todo: we should have some kind eviction policy since we can't assume we'll hold all of these secrets in memory
 func NewJSONStore(path string) *JSONStore {
 	return &JSONStore{
 		vaultPath: path,
 		data:      make(map[string]JSONRecord, 1024),
+		roles:     make(map[string]string),
+		groups:    make(map[string]Group),
+		policies:  make(map[string]Policy),
+		invites:   make(map[string]Invite),
+		settings:  make(map[string]string),
 	}
 }
 
+// NewEncryptedJSONStore is a json store whose records are encrypted with cipher on disk.
+func NewEncryptedJSONStore(path string, cipher Cipher) *JSONStore {
+	js := NewJSONStore(path)
+	js.cipher = cipher
+	return js
+}
+
 func (js *JSONStore) AddUser(name string, login, salt []byte) error {
 	js.Lock()
 	defer js.Unlock()
@@ -40,15 +94,66 @@ func (js *JSONStore) AddUser(name string, login, salt []byte) error {
 	if exists {
 		return NewAlreadyExistsError(name)
 	}
-	record = NewJSONRecord(User{name, login, salt})
-	userP := js.getUserPath(record.User.Name)
-	if e := recordOnDisk(userP, record); e != nil {
+	record = NewJSONRecord(NewUser(name, login, salt))
+	if e := js.recordOnDisk(record); e != nil {
 		return e
 	}
 	js.data[name] = record
 	return nil
 }
 
+// UpdateUser replaces a user's info, keeping the stored second factor: it only
+// changes through SwapTOTP, so an update made from a stale read can't bring back
+// a code that has since been burnt.
+func (js *JSONStore) UpdateUser(user User) error {
+	js.Lock()
+	defer js.Unlock()
+	record, exists := js.data[user.Name]
+	if !exists {
+		return fmt.Errorf("err user %s does not exist", user.Name)
+	}
+	user = cloneUser(user)
+	user.TOTP = record.User.TOTP
+	record.User = user
+	if e := js.recordOnDisk(record); e != nil {
+		return e
+	}
+	js.data[user.Name] = record
+	return nil
+}
+
+// SwapTOTP replaces the second factor of a user with next, failing with
+// ErrTOTPChanged unless it is still old. A nil next removes it.
+func (js *JSONStore) SwapTOTP(name string, old, next *TOTP) error {
+	js.Lock()
+	defer js.Unlock()
+	record, exists := js.data[name]
+	if !exists {
+		return fmt.Errorf("err user %s does not exist", name)
+	}
+	if !record.User.TOTP.Equal(old) {
+		return ErrTOTPChanged
+	}
+	record.User.TOTP = next.Clone()
+	if e := js.recordOnDisk(record); e != nil {
+		return e
+	}
+	js.data[name] = record
+	return nil
+}
+
+// cloneUser copies the parts of a user held by reference, so callers can't
+// modify the stored one.
+func cloneUser(user User) User {
+	user.TOTP = user.TOTP.Clone()
+	user.Policies = slices.Clone(user.Policies)
+	if user.PrivateKey != nil {
+		key := *user.PrivateKey
+		user.PrivateKey = &key
+	}
+	return user
+}
+
 func (js *JSONStore) HasUser(name string) bool {
 	js.RLock()
 	defer js.RUnlock()
@@ -59,6 +164,37 @@ func (js *JSONStore) HasUser(name string) bool {
 	return true
 }
 
+func (js *JSONStore) DeleteUser(name string) error {
+	js.Lock()
+	defer js.Unlock()
+	record, exists := js.data[name]
+	if !exists {
+		return fmt.Errorf("err user %s does not exist", name)
+	}
+	path, err := js.getUserPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+	for id := range record.Roles {
+		delete(js.roles, id)
+	}
+	delete(js.data, name)
+	return nil
+}
+
+func (js *JSONStore) ListUsers() []User {
+	js.RLock()
+	defer js.RUnlock()
+	users := make([]User, 0, len(js.data))
+	for _, record := range js.data {
+		users = append(users, cloneUser(record.User))
+	}
+	return users
+}
+
 func (js *JSONStore) GetUserInfo(name string) (User, bool) {
 	js.RLock()
 	defer js.RUnlock()
@@ -67,7 +203,7 @@ func (js *JSONStore) GetUserInfo(name string) (User, bool) {
 	if !exists {
 		return none, false
 	}
-	return record.User, true
+	return cloneUser(record.User), true
 }
 
 func (js *JSONStore) Get(name, key string) (CipherText, bool) {
@@ -85,7 +221,23 @@ func (js *JSONStore) Get(name, key string) (CipherText, bool) {
 	return ciphertext, true
 }
 
-func (js *JSONStore) Set(name, key string, value CipherText) error {
+// Set stores value under key. When the value changes the store stamps the
+// metadata with the time and meta's UpdatedBy, Type and Mode. Meta's labels
+// and description replace the current ones unless they are nil and empty.
+func (js *JSONStore) Set(name, key string, value CipherText, meta Metadata) error {
+	js.Lock()
+	defer js.Unlock()
+
+	record, userExists := js.data[name]
+	if !userExists {
+		return fmt.Errorf("err user %s does not exist", name)
+	}
+	return js.put(record, key, value, meta)
+}
+
+// Replace is Set for a value read earlier, failing with ErrSecretChanged unless
+// key still holds old. A zero old means key must not hold anything yet.
+func (js *JSONStore) Replace(name, key string, old, value CipherText, meta Metadata) error {
 	js.Lock()
 	defer js.Unlock()
 
@@ -93,30 +245,712 @@ func (js *JSONStore) Set(name, key string, value CipherText) error {
 	if !userExists {
 		return fmt.Errorf("err user %s does not exist", name)
 	}
+	if current := record.Secrets[key]; !current.Equal(old) {
+		return ErrSecretChanged
+	}
+	return js.put(record, key, value, meta)
+}
 
+func (js *JSONStore) put(record JSONRecord, key string, value CipherText, meta Metadata) error {
 	original, cipherExists := record.Secrets[key]
-	if cipherExists && original.Equal(value) {
+	unchanged := cipherExists && original.Equal(value)
+	if unchanged && meta.Labels == nil && meta.Description == "" {
 		return nil
 	}
 
+	before, hadMeta := record.Metadata[key]
+	after := before
+	if !unchanged {
+		now := time.Now().UTC()
+		if !cipherExists {
+			after.Created = now
+		}
+		after.Updated, after.UpdatedBy, after.Type, after.Mode = now, meta.UpdatedBy, meta.Type, meta.Mode
+	}
+	if meta.Labels != nil {
+		after.Labels = maps.Clone(meta.Labels)
+	}
+	if meta.Description != "" {
+		after.Description = meta.Description
+	}
+
 	record.Secrets[key] = value
-	userP := js.getUserPath(record.User.Name)
-	if e := recordOnDisk(userP, record); e != nil {
-		record.Secrets[key] = original
+	record.Metadata[key] = after
+	if e := js.recordOnDisk(record); e != nil {
+		if cipherExists {
+			record.Secrets[key] = original
+		} else {
+			delete(record.Secrets, key)
+		}
+		if hadMeta {
+			record.Metadata[key] = before
+		} else {
+			delete(record.Metadata, key)
+		}
+		return e
+	}
+	if cipherExists && original.Blob != value.Blob {
+		js.removeBlobs(record.User.Name, original)
+	}
+	return nil
+}
+
+func (js *JSONStore) GetMetadata(name, key string) (Metadata, bool) {
+	js.RLock()
+	defer js.RUnlock()
+	record, exists := js.data[name]
+	if !exists {
+		return Metadata{}, false
+	}
+	if _, exists := record.Secrets[key]; !exists {
+		return Metadata{}, false
+	}
+	return record.Metadata[key], true
+}
+
+func (js *JSONStore) SetMetadata(name, key string, meta Metadata) error {
+	js.Lock()
+	defer js.Unlock()
+	record, exists := js.data[name]
+	if !exists {
+		return fmt.Errorf("err user %s does not exist", name)
+	}
+	if _, exists := record.Secrets[key]; !exists {
+		return NewNoSuchSecretError(key)
+	}
+	before, hadMeta := record.Metadata[key]
+	after := before
+	after.Labels, after.Description = maps.Clone(meta.Labels), meta.Description
+	record.Metadata[key] = after
+	if err := js.recordOnDisk(record); err != nil {
+		if hadMeta {
+			record.Metadata[key] = before
+		} else {
+			delete(record.Metadata, key)
+		}
+		return err
+	}
+	return nil
+}
+
+func (js *JSONStore) List(name, prefix, cursor string, limit int, labels map[string]string) (ListPage, error) {
+	js.RLock()
+	defer js.RUnlock()
+	record, exists := js.data[name]
+	if !exists {
+		return ListPage{}, fmt.Errorf("err user %s does not exist", name)
+	}
+	keys := make([]string, 0, len(record.Secrets))
+	for key := range record.Secrets {
+		if record.Metadata[key].HasLabels(labels) {
+			keys = append(keys, key)
+		}
+	}
+	page, err := ListKeys(keys, prefix, cursor, limit)
+	if err != nil {
+		return page, err
+	}
+	for _, entry := range page.Entries {
+		meta, exists := record.Metadata[prefix+entry]
+		if !exists {
+			continue
+		}
+		if page.Metadata == nil {
+			page.Metadata = make(map[string]Metadata)
+		}
+		page.Metadata[entry] = meta
+	}
+	return page, nil
+}
+
+func (js *JSONStore) Delete(name, key string) error {
+	js.Lock()
+	defer js.Unlock()
+	record, exists := js.data[name]
+	if !exists {
+		return fmt.Errorf("err user %s does not exist", name)
+	}
+	if _, exists := record.Secrets[key]; !exists {
+		return NewNoSuchSecretError(key)
+	}
+	secrets, meta := maps.Clone(record.Secrets), maps.Clone(record.Metadata)
+	delete(record.Secrets, key)
+	delete(record.Metadata, key)
+	if err := js.recordOnDisk(record); err != nil {
+		record.restore(secrets, meta)
+		return err
+	}
+	js.removeBlobs(name, secrets[key])
+	return nil
+}
+
+func (js *JSONStore) DeleteTree(name, prefix string) (int, error) {
+	js.Lock()
+	defer js.Unlock()
+	if prefix == "" || !ValidPrefix(prefix) {
+		return 0, ErrInvalidPath
+	}
+	record, exists := js.data[name]
+	if !exists {
+		return 0, fmt.Errorf("err user %s does not exist", name)
+	}
+	secrets, meta := maps.Clone(record.Secrets), maps.Clone(record.Metadata)
+	var removed []CipherText
+	for key, value := range secrets {
+		if strings.HasPrefix(key, prefix) {
+			delete(record.Secrets, key)
+			delete(record.Metadata, key)
+			removed = append(removed, value)
+		}
+	}
+	if len(removed) == 0 {
+		return 0, nil
+	}
+	if err := js.recordOnDisk(record); err != nil {
+		record.restore(secrets, meta)
+		return 0, err
+	}
+	js.removeBlobs(name, removed...)
+	return len(removed), nil
+}
+
+func (js *JSONStore) Move(name, from, to string) (int, error) {
+	js.Lock()
+	defer js.Unlock()
+	record, exists := js.data[name]
+	if !exists {
+		return 0, fmt.Errorf("err user %s does not exist", name)
+	}
+	renames, err := Renames(slices.Collect(maps.Keys(record.Secrets)), from, to)
+	if err != nil {
+		return 0, err
+	}
+	for _, dest := range renames {
+		if _, taken := record.Secrets[dest]; taken {
+			return 0, NewSecretExistsError(dest)
+		}
+	}
+	secrets, meta := maps.Clone(record.Secrets), maps.Clone(record.Metadata)
+	for src := range renames {
+		delete(record.Secrets, src)
+		delete(record.Metadata, src)
+	}
+	for src, dest := range renames {
+		record.Secrets[dest] = secrets[src]
+		if m, exists := meta[src]; exists {
+			record.Metadata[dest] = m
+		}
+	}
+	if err := js.recordOnDisk(record); err != nil {
+		record.restore(secrets, meta)
+		return 0, err
+	}
+	return len(renames), nil
+}
+
+func (js *JSONStore) SetRole(role Role) error {
+	js.Lock()
+	defer js.Unlock()
+
+	record, userExists := js.data[role.Owner]
+	if !userExists {
+		return fmt.Errorf("err user %s does not exist", role.Owner)
+	}
+	if owner, taken := js.roles[role.ID]; taken && owner != role.Owner {
+		return fmt.Errorf("err role %s is owned by another user", role.ID)
+	}
+
+	if record.Roles == nil {
+		record.Roles = make(map[string]Role)
+	}
+	original, roleExists := record.Roles[role.ID]
+	record.Roles[role.ID] = role
+	js.data[role.Owner] = record
+	if e := js.recordOnDisk(record); e != nil {
+		if roleExists {
+			record.Roles[role.ID] = original
+		} else {
+			delete(record.Roles, role.ID)
+		}
 		return e
 	}
+	js.roles[role.ID] = role.Owner
 	return nil
 }
 
-func (js *JSONStore) getUserPath(user string) string {
-	return filepath.Join(js.vaultPath, user, "secrets.json")
+func (js *JSONStore) GetRole(id string) (Role, bool) {
+	js.RLock()
+	defer js.RUnlock()
+	var none Role
+	owner, exists := js.roles[id]
+	if !exists {
+		return none, false
+	}
+	role, exists := js.data[owner].Roles[id]
+	return role, exists
 }
 
-func recordOnDisk(path string, record JSONRecord) error {
+func (js *JSONStore) DeleteRole(owner, id string) error {
+	js.Lock()
+	defer js.Unlock()
+
+	record, userExists := js.data[owner]
+	if !userExists {
+		return fmt.Errorf("err user %s does not exist", owner)
+	}
+	original, roleExists := record.Roles[id]
+	if !roleExists {
+		return NewNoSuchRoleError(id)
+	}
+
+	delete(record.Roles, id)
+	if e := js.recordOnDisk(record); e != nil {
+		record.Roles[id] = original
+		return e
+	}
+	delete(js.roles, id)
+	return nil
+}
+
+func (js *JSONStore) ListRoles(owner string) []Role {
+	js.RLock()
+	defer js.RUnlock()
+	record := js.data[owner]
+	roles := make([]Role, 0, len(record.Roles))
+	for _, role := range record.Roles {
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+// Load reads every record under the vault path into memory. A vault path that
+// does not exist yet is an empty store. Records still laid out the way older
+// stores left them are moved into the current layout.
+func (js *JSONStore) Load() error {
+	js.Lock()
+	defer js.Unlock()
+	layout, err := js.checkManifest()
+	if err != nil {
+		return err
+	}
+	err = js.loadKind(usersDir, func(path string, bytes []byte) (string, error) {
+		var record JSONRecord
+		if err := json.Unmarshal(bytes, &record); err != nil {
+			return "", fmt.Errorf("err reading record %s: %w", path, err)
+		}
+		if record.Secrets == nil {
+			record.Secrets = make(map[string]CipherText)
+		}
+		if record.Metadata == nil {
+			record.Metadata = make(map[string]Metadata)
+		}
+		js.data[record.User.Name] = record
+		for id := range record.Roles {
+			js.roles[id] = record.User.Name
+		}
+		if err := js.sweepBlobs(record); err != nil {
+			return "", err
+		}
+		return js.getUserPath(record.User.Name)
+	})
+	if err != nil {
+		return err
+	}
+	err = js.loadKind(groupsDir, func(path string, bytes []byte) (string, error) {
+		var group Group
+		if err := json.Unmarshal(bytes, &group); err != nil {
+			return "", fmt.Errorf("err reading group %s: %w", path, err)
+		}
+		js.groups[group.Name] = cloneGroup(group)
+		return js.getGroupPath(group.Name)
+	})
+	if err != nil {
+		return err
+	}
+	err = js.loadKind(policiesDir, func(path string, bytes []byte) (string, error) {
+		var policy Policy
+		if err := json.Unmarshal(bytes, &policy); err != nil {
+			return "", fmt.Errorf("err reading policy %s: %w", path, err)
+		}
+		js.policies[policy.Name] = policy
+		return js.getPolicyPath(policy.Name)
+	})
+	if err != nil {
+		return err
+	}
+	if err := js.loadInvites(); err != nil {
+		return err
+	}
+	if err := js.loadSettings(); err != nil {
+		return err
+	}
+	if layout < currentLayout {
+		if err := js.writeManifest(); err != nil {
+			return err
+		}
+	}
+	js.loaded = true
+	return nil
+}
+
+// Unload drops every record from memory. The store must be loaded again before use.
+func (js *JSONStore) Unload() {
+	js.Lock()
+	defer js.Unlock()
+	js.data = make(map[string]JSONRecord, 1024)
+	js.roles = make(map[string]string)
+	js.groups = make(map[string]Group)
+	js.policies = make(map[string]Policy)
+	js.invites = make(map[string]Invite)
+	js.settings = make(map[string]string)
+	js.loaded = false
+}
+
+// Ready reports whether the store has been loaded and the vault path accepts writes.
+func (js *JSONStore) Ready() error {
+	js.RLock()
+	loaded := js.loaded
+	js.RUnlock()
+	if !loaded {
+		return ErrNotLoaded
+	}
+	if err := os.MkdirAll(js.vaultPath, 0700); err != nil {
+		return err
+	}
+	probe, err := os.CreateTemp(js.vaultPath, ".ready-*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+func (js *JSONStore) Backend() string {
+	return "json"
+}
+
+func (js *JSONStore) AddGroup(group Group) error {
+	js.Lock()
+	defer js.Unlock()
+	if _, exists := js.groups[group.Name]; exists {
+		return NewGroupAlreadyExistsError(group.Name)
+	}
+	group.Revision = 1
+	if e := js.groupOnDisk(group); e != nil {
+		return e
+	}
+	js.groups[group.Name] = cloneGroup(group)
+	return nil
+}
+
+func (js *JSONStore) UpdateGroup(group Group) error {
+	js.Lock()
+	defer js.Unlock()
+	current, exists := js.groups[group.Name]
+	if !exists {
+		return NewNoSuchGroupError(group.Name)
+	}
+	if current.Revision != group.Revision {
+		return ErrGroupChanged
+	}
+	group.Revision++
+	if e := js.groupOnDisk(group); e != nil {
+		return e
+	}
+	js.groups[group.Name] = cloneGroup(group)
+	return nil
+}
+
+// GetGroup returns a copy of the group, safe to modify and pass to UpdateGroup.
+func (js *JSONStore) GetGroup(name string) (Group, bool) {
+	js.RLock()
+	defer js.RUnlock()
+	group, exists := js.groups[name]
+	if !exists {
+		return Group{}, false
+	}
+	return cloneGroup(group), true
+}
+
+func (js *JSONStore) ListGroups(member string) []Group {
+	js.RLock()
+	defer js.RUnlock()
+	var groups []Group
+	for _, group := range js.groups {
+		if _, ok := group.Members[member]; ok {
+			groups = append(groups, cloneGroup(group))
+		}
+	}
+	return groups
+}
+
+func (js *JSONStore) GetGroupSecret(name, key string) (CipherText, bool) {
+	js.RLock()
+	defer js.RUnlock()
+	ciphertext, exists := js.groups[name].Secrets[key]
+	return ciphertext, exists
+}
+
+func (js *JSONStore) SetGroupSecret(name string, epoch int, key string, value CipherText) error {
+	js.Lock()
+	defer js.Unlock()
+	group, exists := js.groups[name]
+	if !exists {
+		return NewNoSuchGroupError(name)
+	}
+	if group.Epoch != epoch {
+		return ErrGroupChanged
+	}
+	group = cloneGroup(group)
+	group.Secrets[key] = value
+	group.Revision++
+	if e := js.groupOnDisk(group); e != nil {
+		return e
+	}
+	js.groups[name] = group
+	return nil
+}
+
+// cloneGroup copies the maps of a group so callers can't modify the stored one.
+func cloneGroup(group Group) Group {
+	group.Members = maps.Clone(group.Members)
+	group.Secrets = maps.Clone(group.Secrets)
+	if group.Members == nil {
+		group.Members = make(map[string]GroupMember)
+	}
+	if group.Secrets == nil {
+		group.Secrets = make(map[string]CipherText)
+	}
+	return group
+}
+
+// getGroupPath is where a group is stored.
+func (js *JSONStore) getGroupPath(name string) (string, error) {
+	return js.recordPath(groupsDir, "group:"+name)
+}
+
+func (js *JSONStore) groupOnDisk(group Group) error {
+	path, err := js.getGroupPath(group.Name)
+	if err != nil {
+		return err
+	}
+	bytes, err := json.Marshal(group)
+	if err != nil {
+		return err
+	}
+	return js.writeFile(path, bytes)
+}
+
+func (js *JSONStore) SetPolicy(policy Policy) error {
+	js.Lock()
+	defer js.Unlock()
+	path, err := js.getPolicyPath(policy.Name)
+	if err != nil {
+		return err
+	}
+	bytes, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	if e := js.writeFile(path, bytes); e != nil {
+		return e
+	}
+	js.policies[policy.Name] = policy
+	return nil
+}
+
+func (js *JSONStore) GetPolicy(name string) (Policy, bool) {
+	js.RLock()
+	defer js.RUnlock()
+	policy, exists := js.policies[name]
+	return policy, exists
+}
+
+func (js *JSONStore) DeletePolicy(name string) error {
+	js.Lock()
+	defer js.Unlock()
+	if _, exists := js.policies[name]; !exists {
+		return NewNoSuchPolicyError(name)
+	}
+	path, err := js.getPolicyPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+	delete(js.policies, name)
+	return nil
+}
+
+func (js *JSONStore) ListPolicies() []Policy {
+	js.RLock()
+	defer js.RUnlock()
+	policies := make([]Policy, 0, len(js.policies))
+	for _, policy := range js.policies {
+		policies = append(policies, policy)
+	}
+	return policies
+}
+
+// getPolicyPath is where a policy is stored.
+func (js *JSONStore) getPolicyPath(name string) (string, error) {
+	return js.recordPath(policiesDir, "policy:"+name)
+}
+
+func (js *JSONStore) AddInvite(invite Invite) error {
+	js.Lock()
+	defer js.Unlock()
+	invites := maps.Clone(js.invites)
+	invites[invite.Hash] = invite
+	if e := js.invitesOnDisk(invites); e != nil {
+		return e
+	}
+	js.invites = invites
+	return nil
+}
+
+func (js *JSONStore) TakeInvite(hash string) (Invite, bool) {
+	js.Lock()
+	defer js.Unlock()
+	invite, exists := js.invites[hash]
+	if !exists {
+		return invite, false
+	}
+	invites := maps.Clone(js.invites)
+	delete(invites, hash)
+	// an invite that can't be marked used on disk is not handed out.
+	if e := js.invitesOnDisk(invites); e != nil {
+		return Invite{}, false
+	}
+	js.invites = invites
+	return invite, true
+}
+
+func (js *JSONStore) DeleteInvite(id string) error {
+	js.Lock()
+	defer js.Unlock()
+	for hash, invite := range js.invites {
+		if invite.ID != id {
+			continue
+		}
+		invites := maps.Clone(js.invites)
+		delete(invites, hash)
+		if e := js.invitesOnDisk(invites); e != nil {
+			return e
+		}
+		js.invites = invites
+		return nil
+	}
+	return NewNoSuchInviteError(id)
+}
+
+func (js *JSONStore) ListInvites() []Invite {
+	js.RLock()
+	defer js.RUnlock()
+	invites := make([]Invite, 0, len(js.invites))
+	for _, invite := range js.invites {
+		invites = append(invites, invite)
+	}
+	return invites
+}
+
+func (js *JSONStore) loadInvites() error {
+	bytes, err := js.readFile(filepath.Join(js.vaultPath, invitesFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(bytes, &js.invites); err != nil {
+		return fmt.Errorf("err reading invites: %w", err)
+	}
+	return nil
+}
+
+func (js *JSONStore) invitesOnDisk(invites map[string]Invite) error {
+	bytes, err := json.Marshal(invites)
+	if err != nil {
+		return err
+	}
+	return js.writeFile(filepath.Join(js.vaultPath, invitesFile), bytes)
+}
+
+func (js *JSONStore) GetSetting(name string) (string, bool) {
+	js.RLock()
+	defer js.RUnlock()
+	value, exists := js.settings[name]
+	return value, exists
+}
+
+func (js *JSONStore) SetSetting(name, value string) error {
+	js.Lock()
+	defer js.Unlock()
+	settings := maps.Clone(js.settings)
+	settings[name] = value
+	bytes, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	if err := js.writeFile(filepath.Join(js.vaultPath, settingsFile), bytes); err != nil {
+		return err
+	}
+	js.settings = settings
+	return nil
+}
+
+func (js *JSONStore) loadSettings() error {
+	bytes, err := js.readFile(filepath.Join(js.vaultPath, settingsFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(bytes, &js.settings); err != nil {
+		return fmt.Errorf("err reading settings: %w", err)
+	}
+	return nil
+}
+
+// getUserPath is where a user's record is stored.
+func (js *JSONStore) getUserPath(user string) (string, error) {
+	return js.recordPath(usersDir, user)
+}
+
+func (js *JSONStore) recordOnDisk(record JSONRecord) error {
+	path, err := js.getUserPath(record.User.Name)
+	if err != nil {
+		return err
+	}
 	bytes, err := json.Marshal(record)
 	if err != nil {
 		return err
 	}
+	return js.writeFile(path, bytes)
+}
+
+// readFile reads a file written by writeFile.
+func (js *JSONStore) readFile(path string) ([]byte, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil || js.cipher == nil {
+		return bytes, err
+	}
+	if bytes, err = js.cipher.Decrypt(bytes); err != nil {
+		return nil, fmt.Errorf("err decrypting %s: %w", path, err)
+	}
+	return bytes, nil
+}
+
+// writeFile writes bytes to path, encrypted when the store has a cipher.
+func (js *JSONStore) writeFile(path string, bytes []byte) error {
+	var err error
+	if js.cipher != nil {
+		if bytes, err = js.cipher.Encrypt(bytes); err != nil {
+			return err
+		}
+	}
 	// ensure the parent directories exist
 	dirErr := os.MkdirAll(filepath.Dir(path), 0700)
 	if dirErr != nil {
@@ -0,0 +1,238 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// A vault path stores every user, group and policy as <kind>/<id>/record, where
+// id is a hash of the name: an hmac under the store's cipher when it has one and
+// sha256 otherwise. Names never reach the filesystem, so one like "../../etc"
+// can't escape the vault path. The records carry their own names.
+const (
+	usersDir    = "users"
+	groupsDir   = "groups"
+	policiesDir = "policies"
+	recordFile  = "record"
+)
+
+// Older stores named directories after what they held: <user>/secrets.json,
+// groups/<name>/group.json and policies/<name>/policy.json. Records found there
+// are moved into the current layout as they are loaded.
+var legacyRecords = map[string]string{
+	usersDir:    filepath.Join("*", "secrets.json"),
+	groupsDir:   filepath.Join(groupsDir, "*", "group.json"),
+	policiesDir: filepath.Join(policiesDir, "*", "policy.json"),
+}
+
+// manifestFile describes the layout of the vault path.
+const manifestFile = "manifest.json"
+
+// currentLayout is the layout this store writes. Layout 1 is the named
+// directories of older stores, which had no manifest.
+const currentLayout = 2
+
+type manifest struct {
+	Layout    int  `json:"layout"`
+	Encrypted bool `json:"encrypted"` // whether records are encrypted, so a plain store doesn't misread an encrypted one
+}
+
+// index is the directory a name is stored under.
+func (js *JSONStore) index(name string) (string, error) {
+	if js.cipher != nil {
+		return js.cipher.Index(name)
+	}
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// recordPath is where the record for name of kind is stored. Names are
+// namespaced by kind so a user and a group of the same name differ.
+func (js *JSONStore) recordPath(kind, name string) (string, error) {
+	id, err := js.index(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(js.vaultPath, kind, id, recordFile), nil
+}
+
+// checkManifest returns the layout of the vault path, zero when it has no
+// manifest, failing when it was laid out by a newer store or with different
+// encryption.
+func (js *JSONStore) checkManifest() (int, error) {
+	bytes, err := os.ReadFile(filepath.Join(js.vaultPath, manifestFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var m manifest
+	if err := json.Unmarshal(bytes, &m); err != nil {
+		return 0, fmt.Errorf("err reading manifest: %w", err)
+	}
+	if m.Layout > currentLayout || m.Encrypted != (js.cipher != nil) {
+		return 0, fmt.Errorf("%w: layout %d, encrypted %v", ErrUnknownLayout, m.Layout, m.Encrypted)
+	}
+	return m.Layout, nil
+}
+
+func (js *JSONStore) writeManifest() error {
+	bytes, err := json.Marshal(manifest{Layout: currentLayout, Encrypted: js.cipher != nil})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(js.vaultPath, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(js.vaultPath, manifestFile), bytes, 0600)
+}
+
+// recordFiles lists every record of kind, in the current layout or an older one.
+func (js *JSONStore) recordFiles(kind string) ([]string, error) {
+	var paths []string
+	for _, pattern := range []string{
+		filepath.Join(js.vaultPath, kind, "*", recordFile),
+		filepath.Join(js.vaultPath, legacyRecords[kind]),
+	} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// loadKind reads every record of kind, handing each to add, which returns the
+// path the record belongs at. Records found anywhere else are moved there.
+func (js *JSONStore) loadKind(kind string, add func(path string, bytes []byte) (string, error)) error {
+	paths, err := js.recordFiles(kind)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		bytes, err := js.readFile(path)
+		if err != nil {
+			return err
+		}
+		want, err := add(path, bytes)
+		if err != nil {
+			return err
+		}
+		if want == path {
+			continue
+		}
+		if err := js.writeFile(want, bytes); err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		// the directory only goes if nothing else was kept in it.
+		os.Remove(filepath.Dir(path))
+	}
+	return nil
+}
+
+// recordNames reads the name out of a plaintext record of each kind.
+var recordNames = map[string]func(bytes []byte) (string, error){
+	usersDir: func(bytes []byte) (string, error) {
+		var record JSONRecord
+		err := json.Unmarshal(bytes, &record)
+		return record.User.Name, err
+	},
+	groupsDir: func(bytes []byte) (string, error) {
+		var group Group
+		err := json.Unmarshal(bytes, &group)
+		return group.Name, err
+	},
+	policiesDir: func(bytes []byte) (string, error) {
+		var policy Policy
+		err := json.Unmarshal(bytes, &policy)
+		return policy.Name, err
+	},
+}
+
+// EncryptPlaintext encrypts the records of a vault path left by a store from
+// before records were encrypted, which has no manifest. Every record is read and
+// written encrypted at its place in the current layout before anything is
+// removed. commit then removes the plaintext records and writes the manifest,
+// while rollback removes the encrypted copies again. It is meant for the one
+// moment such a vault gets its keyring: Load never accepts plaintext records,
+// since anyone able to write to the vault path could plant them.
+func (js *JSONStore) EncryptPlaintext() (commit func() error, rollback func(), err error) {
+	js.Lock()
+	defer js.Unlock()
+	if js.cipher == nil {
+		return nil, nil, errors.New("encrypting plaintext records needs a cipher")
+	}
+	layout, err := js.checkManifest()
+	if err != nil {
+		return nil, nil, err
+	}
+	if layout != 0 {
+		return func() error { return nil }, func() {}, nil
+	}
+
+	type move struct {
+		from, to string
+		bytes    []byte
+	}
+	var moves []move
+	for kind, name := range recordNames {
+		paths, err := js.recordFiles(kind)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, path := range paths {
+			bytes, err := os.ReadFile(path)
+			if err != nil {
+				return nil, nil, err
+			}
+			n, err := name(bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("err reading plaintext record %s: %w", path, err)
+			}
+			to, err := js.recordPath(kind, n)
+			if err != nil {
+				return nil, nil, err
+			}
+			moves = append(moves, move{path, to, bytes})
+		}
+	}
+
+	var written []string
+	rollback = func() {
+		for _, path := range written {
+			os.Remove(path)
+			os.Remove(filepath.Dir(path))
+		}
+	}
+	for _, m := range moves {
+		if _, err := os.Stat(m.to); err == nil {
+			rollback()
+			return nil, nil, fmt.Errorf("err encrypting %s: %s already exists", m.from, m.to)
+		}
+		if err := js.writeFile(m.to, m.bytes); err != nil {
+			rollback()
+			return nil, nil, err
+		}
+		written = append(written, m.to)
+	}
+	commit = func() error {
+		for _, m := range moves {
+			if err := os.Remove(m.from); err != nil {
+				return err
+			}
+			os.Remove(filepath.Dir(m.from))
+		}
+		return js.writeManifest()
+	}
+	return commit, rollback, nil
+}
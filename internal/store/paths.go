@@ -0,0 +1,121 @@
+package store
+
+import (
+	"slices"
+	"strings"
+)
+
+// Secret keys are paths such as "prod/db/password", whose "/" separated segments
+// make up a hierarchy of directories. A prefix names a directory: it is empty
+// for the top of a vault, otherwise a key followed by a "/".
+const PathSeparator = "/"
+
+// ListPage is one page of the entries directly under a prefix.
+type ListPage struct {
+	Entries []string `json:"entries"`        // secrets, and directories ending in "/", relative to the prefix
+	Next    string   `json:"next,omitempty"` // the cursor the next page starts after, empty on the last page
+
+	Metadata map[string]Metadata `json:"metadata,omitempty"` // of the secrets in Entries that have any, by entry
+}
+
+// ValidKey reports whether key is a path to a secret: non empty segments, none
+// of which is "." or "..", and no "*", which is kept for patterns, or "#", which
+// picks a field of a secret.
+func ValidKey(key string) bool {
+	if key == "" || strings.ContainsAny(key, "*#") {
+		return false
+	}
+	for _, seg := range strings.Split(key, PathSeparator) {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidPrefix reports whether prefix names a directory.
+func ValidPrefix(prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	key, ok := strings.CutSuffix(prefix, PathSeparator)
+	return ok && ValidKey(key)
+}
+
+// IsPrefix reports whether path names a directory rather than a secret.
+func IsPrefix(path string) bool {
+	return path == "" || strings.HasSuffix(path, PathSeparator)
+}
+
+// ListKeys pages through the entries directly under prefix among keys, for
+// stores that hold a vault's keys in memory. Entries come in order, starting
+// after cursor; limit bounds the page, zero or less returns every entry.
+func ListKeys(keys []string, prefix, cursor string, limit int) (ListPage, error) {
+	if !ValidPrefix(prefix) {
+		return ListPage{}, ErrInvalidPath
+	}
+	var entries []string
+	for _, key := range keys {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		if dir, _, nested := strings.Cut(rest, PathSeparator); nested {
+			rest = dir + PathSeparator
+		}
+		entries = append(entries, rest)
+	}
+	slices.Sort(entries)
+	entries = slices.Compact(entries)
+	if cursor != "" {
+		start, _ := slices.BinarySearch(entries, cursor)
+		if start < len(entries) && entries[start] == cursor {
+			start++
+		}
+		entries = entries[start:]
+	}
+	page := ListPage{Entries: entries}
+	if limit > 0 && len(entries) > limit {
+		page.Entries = entries[:limit]
+		page.Next = entries[limit-1]
+	}
+	if page.Entries == nil {
+		page.Entries = []string{}
+	}
+	return page, nil
+}
+
+// Renames works out where each of keys ends up when from is moved to to, both
+// keys or both prefixes. It fails with NoSuchSecretError when nothing is at from.
+// A key stored before keys had to be valid, such as "a//b" or "a/", is moved on
+// its own when from names it exactly, so it can be given a valid name.
+func Renames(keys []string, from, to string) (map[string]string, error) {
+	if !ValidKey(from) && slices.Contains(keys, from) {
+		if !ValidKey(to) {
+			return nil, ErrInvalidPath
+		}
+		return map[string]string{from: to}, nil
+	}
+	if IsPrefix(from) != IsPrefix(to) {
+		return nil, ErrInvalidPath
+	}
+	if IsPrefix(from) {
+		if from == "" || !ValidPrefix(from) || !ValidPrefix(to) || strings.HasPrefix(to, from) {
+			return nil, ErrInvalidPath
+		}
+	} else if !ValidKey(from) || !ValidKey(to) {
+		return nil, ErrInvalidPath
+	}
+	renames := make(map[string]string)
+	for _, key := range keys {
+		if key == from {
+			renames[key] = to
+		} else if rest, ok := strings.CutPrefix(key, from); ok && IsPrefix(from) {
+			renames[key] = to + rest
+		}
+	}
+	if len(renames) == 0 {
+		return nil, NewNoSuchSecretError(from)
+	}
+	return renames, nil
+}
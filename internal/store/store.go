@@ -1,30 +1,198 @@
 package store
 
-import "bytes"
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"slices"
+	"time"
+)
 
 type CipherText struct {
-	Nonce []byte `json:"nonce"` // base64 encoded nonce
-	Text  []byte `json:"text"`  // base64 encoded text
+	Nonce []byte `json:"nonce"`          // base64 encoded nonce
+	Text  []byte `json:"text"`           // base64 encoded text
+	Blob  string `json:"blob,omitempty"` // names a stream kept outside the record instead, see Store.SetStream
 }
 
 func (c CipherText) Equal(other CipherText) bool {
-	return bytes.Equal(c.Nonce, other.Nonce) && bytes.Equal(c.Text, other.Text)
+	return bytes.Equal(c.Nonce, other.Nonce) && bytes.Equal(c.Text, other.Text) && c.Blob == other.Blob
+}
+
+// Metadata describes a secret without revealing it. Secrets written before
+// metadata was kept have no times until they are next written.
+type Metadata struct {
+	Created     time.Time         `json:"created,omitzero"`
+	Updated     time.Time         `json:"updated,omitzero"`      // when the value last changed
+	UpdatedBy   string            `json:"updated_by,omitempty"`  // the id of the session that changed it, as audited
+	Labels      map[string]string `json:"labels,omitempty"`      // free form, such as "env": "prod"
+	Description string            `json:"description,omitempty"` // what the secret is for
+	Type        string            `json:"type,omitempty"`        // how the value is encoded, TypeString when empty
+	Mode        fs.FileMode       `json:"mode,omitempty"`        // the permissions of an uploaded file
+}
+
+// The kinds of value a secret may hold, as recorded in its Metadata.
+const (
+	TypeString = ""       // text
+	TypeObject = "object" // a json object of named fields
+	TypeBinary = "binary" // raw bytes, such as an uploaded file
+)
+
+// HasLabels reports whether m carries every one of labels.
+func (m Metadata) HasLabels(labels map[string]string) bool {
+	for k, v := range labels {
+		if got, ok := m.Labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
 }
 
 type User struct {
-	Name  string `json:"name"`  // the name of the user
-	Login []byte `json:"login"` // this is a namespaced pbkdf2 key derived from the pw for authenticaton purposes.
-	Salt  []byte `json:"salt"`  // the salt for the login key and the aes key generation
+	Name  string `json:"name"`           // the name of the user
+	Login []byte `json:"login"`          // this is a namespaced pbkdf2 key derived from the pw for authenticaton purposes.
+	Salt  []byte `json:"salt"`           // the salt for the login key and the aes key generation
+	TOTP  *TOTP  `json:"totp,omitempty"` // the user's second factor, if they have enrolled one
+
+	// the user's X25519 key pair, which group keys are wrapped to.
+	PublicKey  []byte      `json:"public_key,omitempty"`
+	PrivateKey *CipherText `json:"private_key,omitempty"` // sealed with the user's vault key
+
+	Policies []string `json:"policies,omitempty"` // the policies granted to the user, the default policy when empty
+	Admin    bool     `json:"admin,omitempty"`    // granted the root policy, like the admins named in config
+	Disabled bool     `json:"disabled,omitempty"` // refused at login until an admin enables them again
 }
 
 func NewUser(name string, login, salt []byte) User {
-	return User{name, login, salt}
+	return User{Name: name, Login: login, Salt: salt}
+}
+
+// TOTP is a user's time based one time password enrollment.
+type TOTP struct {
+	Seed          CipherText `json:"seed"`           // the totp secret sealed with the user's vault key
+	Enabled       bool       `json:"enabled"`        // false until the user confirms a first code
+	RecoveryCodes [][]byte   `json:"recovery_codes"` // hashes of the unused recovery codes
+	LastStep      int64      `json:"last_step"`      // the last time step accepted, so codes can't be replayed
+}
+
+// Clone returns a copy of t that shares nothing with it.
+func (t *TOTP) Clone() *TOTP {
+	if t == nil {
+		return nil
+	}
+	clone := *t
+	clone.RecoveryCodes = slices.Clone(t.RecoveryCodes)
+	return &clone
+}
+
+// Equal reports whether t and other are the same enrollment in the same state.
+func (t *TOTP) Equal(other *TOTP) bool {
+	if t == nil || other == nil {
+		return t == other
+	}
+	return t.Seed.Equal(other.Seed) && t.Enabled == other.Enabled && t.LastStep == other.LastStep &&
+		slices.EqualFunc(t.RecoveryCodes, other.RecoveryCodes, bytes.Equal)
+}
+
+// Role is a machine identity owned by a user. It exchanges a role id and secret id
+// for a scoped session without the owner's password: the owner's vault key is kept
+// wrapped under a key derived from the secret id, and only a hash of the secret id
+// is stored.
+type Role struct {
+	ID         string     `json:"id"`                  // the public role id
+	Owner      string     `json:"owner"`               // the user whose vault the role can access
+	SecretHash []byte     `json:"secret_hash"`         // sha256 of the current secret id
+	WrappedKey CipherText `json:"wrapped_key"`         // the owner's vault key sealed with the secret id
+	CIDRs      []string   `json:"cidrs,omitempty"`     // networks logins must originate from, empty allows any
+	Paths      []string   `json:"paths,omitempty"`     // key patterns sessions are restricted to
+	ReadOnly   bool       `json:"read_only,omitempty"` // whether sessions may only read
+	TTL        int64      `json:"ttl"`                 // session lifetime in seconds
+	Policies   []string   `json:"policies,omitempty"`  // the policies granted to the role, the default policy when empty
+}
+
+// Group is a vault shared by its members. Its secrets are encrypted with a group
+// key that is never stored in the clear, only wrapped to each member's public key.
+type Group struct {
+	Name     string                 `json:"name"`
+	Members  map[string]GroupMember `json:"members"` // by user name
+	Epoch    int                    `json:"epoch"`   // bumped every time the group key is replaced
+	Secrets  map[string]CipherText  `json:"secrets"` // sealed with the group key of the current epoch
+	Revision int                    `json:"revision"`
+	Policies []string               `json:"policies,omitempty"` // granted to every member on top of their own
+}
+
+// GroupMember is a user's membership of a group.
+type GroupMember struct {
+	Admin      bool   `json:"admin,omitempty"` // may add and remove members
+	WrappedKey []byte `json:"wrapped_key"`     // the group key wrapped to the member's public key
+}
+
+// Policy grants capabilities on the paths matched by its rules.
+type Policy struct {
+	Name  string       `json:"name"`
+	Rules []PolicyRule `json:"rules"`
+}
+
+// PolicyRule grants capabilities such as "read" on every path matching Path.
+type PolicyRule struct {
+	Path         string   `json:"path"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// Invite lets one person register while registration is invite only. Only a
+// hash of the invite code is stored.
+type Invite struct {
+	ID        string `json:"id"`         // identifies the invite to admins, unrelated to the code
+	Hash      string `json:"hash"`       // hex sha256 of the invite code
+	CreatedBy string `json:"created_by"` // the admin who minted it
+	Expires   int64  `json:"expires"`    // unix time after which it can't be used
 }
 
 type Store interface {
 	GetUserInfo(string) (User, bool) // find info on a give user, if they exists
 	AddUser(name string, login, salt []byte) error
+	UpdateUser(user User) error                  // replace the stored info of an existing user, all but the second factor
+	SwapTOTP(name string, old, next *TOTP) error // replace a user's second factor, as long as it is still old
 	HasUser(name string) bool
-	Get(name, key string) (CipherText, bool)      // get a given key from the required key, nonce, and text.
-	Set(name, key string, value CipherText) error // set a given value with a key
+	DeleteUser(name string) error // remove a user along with their secrets and roles
+	ListUsers() []User
+	Get(name, key string) (CipherText, bool)                              // get a given key from the required key, nonce, and text.
+	Set(name, key string, value CipherText, meta Metadata) error          // set a value and its metadata, see JSONStore.Set
+	Replace(name, key string, old, value CipherText, meta Metadata) error // Set, as long as key still holds old
+	SetStream(name, key string, r io.Reader, meta Metadata) error         // Set a value read from r, kept outside the record
+	OpenStream(name, key string) (io.ReadCloser, error)                   // read a value stored by SetStream
+	GetMetadata(name, key string) (Metadata, bool)                        // the metadata of a secret
+	SetMetadata(name, key string, meta Metadata) error                    // replace the labels and description of a secret
+
+	// secret keys are "/" separated paths, see ValidKey. List returns a page of
+	// the entries directly under prefix after cursor, counting only secrets
+	// carrying every one of labels.
+	List(name, prefix, cursor string, limit int, labels map[string]string) (ListPage, error)
+	Delete(name, key string) error               // remove a secret
+	DeleteTree(name, prefix string) (int, error) // remove every secret under a non empty prefix, returning how many
+	Move(name, from, to string) (int, error)     // rename a secret or every secret under a prefix, refusing to overwrite
+
+	SetRole(role Role) error            // add or replace a role owned by an existing user
+	GetRole(id string) (Role, bool)     // find a role by its id
+	DeleteRole(owner, id string) error  // remove a role owned by owner
+	ListRoles(owner string) []Role      // all roles owned by a user
+	AddGroup(group Group) error         // create a group, failing if the name is taken
+	UpdateGroup(group Group) error      // replace a group, failing if it changed since it was read
+	GetGroup(name string) (Group, bool) // find a group by name
+	ListGroups(member string) []Group   // all groups a user belongs to
+	GetGroupSecret(group, key string) (CipherText, bool)
+	SetGroupSecret(group string, epoch int, key string, value CipherText) error // fails if the group key has been replaced since epoch
+	AddInvite(invite Invite) error                                              // add an invite
+	TakeInvite(hash string) (Invite, bool)                                      // remove and return the invite with hash, so it can be used once
+	DeleteInvite(id string) error                                               // remove an invite by id
+	ListInvites() []Invite                                                      // every unused invite
+	GetSetting(name string) (string, bool)                                      // a server setting changed while it runs
+	SetSetting(name, value string) error                                        // keep a server setting across restarts
+	SetPolicy(policy Policy) error                                              // add or replace a policy
+	GetPolicy(name string) (Policy, bool)                                       // find a policy by name
+	DeletePolicy(name string) error                                             // remove a policy
+	ListPolicies() []Policy                                                     // every stored policy
+	Load() error                                                                // read in whatever the backend already holds, before serving
+	Unload()                                                                    // drop everything held in memory, e.g. when the vault is sealed
+	Ready() error                                                               // nil when the store is loaded and can persist writes
+	Backend() string                                                            // a short name for the kind of store, e.g. "json"
 }
@@ -0,0 +1,339 @@
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var ErrSealed = errors.New("vault is sealed")
+var ErrNotInitialized = errors.New("vault has not been initialized")
+var ErrAlreadyInitialized = errors.New("vault is already initialized")
+var ErrBadUnsealKey = errors.New("unseal key is incorrect")
+
+// barrierKeySize is the size of both the barrier key and the unseal key wrapping it.
+const barrierKeySize = 32
+
+// KeyringFile is the name of the file under the vault path holding the wrapped barrier key.
+const KeyringFile = "keyring.json"
+
+// Keyring is the on-disk form of the barrier key, wrapped by the unseal key so
+// the unseal key can be changed without re-encrypting the store. The unseal key
+// itself is never stored, only handed out split into Shares key shares.
+type Keyring struct {
+	Version    int    `json:"version"`
+	WrappedKey []byte `json:"wrapped_key"`
+	Nonce      []byte `json:"nonce"`
+	Shares     int    `json:"shares"`
+	Threshold  int    `json:"threshold"`
+
+	// the barrier key wrapped by a KeyProvider, for unsealing without key shares.
+	Provider    string `json:"provider,omitempty"`
+	ProviderKey []byte `json:"provider_key,omitempty"`
+}
+
+// InitKeyring generates a new barrier key, writes it to path wrapped by a fresh
+// unseal key, and returns the unseal key split into shares of which threshold
+// are needed to unseal. A single share is the unseal key itself. When provider
+// is not nil the barrier key is also wrapped by it, so the vault can unseal
+// itself. It refuses to overwrite an existing keyring.
+func InitKeyring(path string, shares, threshold int, provider KeyProvider) ([][]byte, error) {
+	return InitKeyringFunc(path, shares, threshold, provider, nil)
+}
+
+// InitKeyringFunc is InitKeyring, calling prepare, when not nil, with the new
+// barrier key before the keyring is written, so that existing data can be
+// readied under the key first. The keyring is not written if prepare fails.
+// prepare must not keep the key, which is wiped once the keyring is written.
+func InitKeyringFunc(path string, shares, threshold int, provider KeyProvider, prepare func(barrierKey []byte) error) ([][]byte, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, ErrAlreadyInitialized
+	}
+	if err := checkShares(shares, threshold); err != nil {
+		return nil, err
+	}
+	barrierKey, err := GenerateRandBytes(barrierKeySize)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(barrierKey)
+	if prepare != nil {
+		if err := prepare(barrierKey); err != nil {
+			return nil, err
+		}
+	}
+	var ring Keyring
+	if provider != nil {
+		if ring.ProviderKey, err = provider.Wrap(barrierKey); err != nil {
+			return nil, err
+		}
+		ring.Provider = provider.Name()
+	}
+	return writeKeyring(path, ring, barrierKey, shares, threshold)
+}
+
+// ReadKeyring reads the keyring at path without unwrapping it.
+func ReadKeyring(path string) (Keyring, error) {
+	var ring Keyring
+	bytes, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ring, ErrNotInitialized
+	}
+	if err != nil {
+		return ring, err
+	}
+	if err := json.Unmarshal(bytes, &ring); err != nil {
+		return ring, err
+	}
+	// keyrings written before shares existed hold a single unsplit key.
+	ring.Shares, ring.Threshold = max(ring.Shares, 1), max(ring.Threshold, 1)
+	return ring, nil
+}
+
+// OpenKeyring reads the keyring at path and unwraps the barrier key with the
+// unseal key recombined from shares.
+func OpenKeyring(path string, shares [][]byte) ([]byte, error) {
+	ring, err := ReadKeyring(path)
+	if err != nil {
+		return nil, err
+	}
+	unsealKey, err := combineUnsealKey(ring, shares)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(unsealKey)
+	barrierKey, err := Decrypt(ring.Nonce, unsealKey, ring.WrappedKey)
+	if err != nil {
+		return nil, ErrBadUnsealKey
+	}
+	return barrierKey, nil
+}
+
+// OpenKeyringWithProvider unwraps the barrier key with provider instead of key shares.
+func OpenKeyringWithProvider(path string, provider KeyProvider) ([]byte, error) {
+	ring, err := ReadKeyring(path)
+	if err != nil {
+		return nil, err
+	}
+	if ring.Provider != provider.Name() || len(ring.ProviderKey) == 0 {
+		return nil, ErrNoProviderKey
+	}
+	barrierKey, err := provider.Unwrap(ring.ProviderKey)
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping barrier key with %s: %w", provider.Name(), err)
+	}
+	if len(barrierKey) != barrierKeySize {
+		return nil, fmt.Errorf("unwrapping barrier key with %s: wrong key size", provider.Name())
+	}
+	return barrierKey, nil
+}
+
+// EnrollProvider wraps barrierKey with provider and records it in the keyring,
+// replacing any provider enrolled before.
+func EnrollProvider(path string, barrierKey []byte, provider KeyProvider) error {
+	ring, err := ReadKeyring(path)
+	if err != nil {
+		return err
+	}
+	wrapped, err := provider.Wrap(barrierKey)
+	if err != nil {
+		return err
+	}
+	ring.Provider, ring.ProviderKey = provider.Name(), wrapped
+	return saveKeyring(path, ring)
+}
+
+// RekeyKeyring unwraps the barrier key with the current shares and wraps it
+// again under a fresh unseal key, returning the new share set. The store and any
+// enrolled provider are untouched since the barrier key is unchanged.
+func RekeyKeyring(path string, current [][]byte, shares, threshold int) ([][]byte, error) {
+	ring, err := ReadKeyring(path)
+	if err != nil {
+		return nil, err
+	}
+	barrierKey, err := OpenKeyring(path, current)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(barrierKey)
+	return writeKeyring(path, ring, barrierKey, shares, threshold)
+}
+
+func combineUnsealKey(ring Keyring, shares [][]byte) ([]byte, error) {
+	if len(shares) < ring.Threshold {
+		return nil, ErrBadUnsealKey
+	}
+	if ring.Shares == 1 {
+		if len(shares[0]) != barrierKeySize {
+			return nil, ErrBadUnsealKey
+		}
+		return append([]byte(nil), shares[0]...), nil
+	}
+	unsealKey, err := Combine(shares)
+	if err != nil {
+		return nil, err
+	}
+	if len(unsealKey) != barrierKeySize {
+		return nil, ErrBadUnsealKey
+	}
+	return unsealKey, nil
+}
+
+// writeKeyring wraps barrierKey under a new unseal key, replaces the keyring at
+// path with ring updated to hold it and returns the unseal key's shares.
+func writeKeyring(path string, ring Keyring, barrierKey []byte, shares, threshold int) ([][]byte, error) {
+	if err := checkShares(shares, threshold); err != nil {
+		return nil, err
+	}
+	unsealKey, err := GenerateRandBytes(barrierKeySize)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(unsealKey)
+	out := [][]byte{append([]byte(nil), unsealKey...)}
+	if shares > 1 {
+		if out, err = Split(unsealKey, shares, threshold); err != nil {
+			return nil, err
+		}
+	}
+	wrapped, nonce, err := EncryptBytes(unsealKey, barrierKey)
+	if err != nil {
+		return nil, err
+	}
+	ring.Version, ring.WrappedKey, ring.Nonce = 1, wrapped, nonce
+	ring.Shares, ring.Threshold = shares, threshold
+	if err := saveKeyring(path, ring); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func checkShares(shares, threshold int) error {
+	if shares < 1 || shares > 255 || threshold < 1 || threshold > shares {
+		return ErrInvalidShares
+	}
+	return nil
+}
+
+// saveKeyring replaces the keyring at path. It writes then renames so a failed
+// write never leaves the vault without a keyring.
+func saveKeyring(path string, ring Keyring) error {
+	bytes, err := json.Marshal(ring)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, bytes, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Barrier encrypts everything the store writes with the barrier key. It starts
+// sealed, holding no key, and refuses to encrypt or decrypt until unsealed.
+type Barrier struct {
+	sync.RWMutex
+	key   []byte
+	index []byte // hmac key for opaque identifiers, derived from key
+}
+
+func NewBarrier() *Barrier {
+	return &Barrier{}
+}
+
+// Sealed reports whether the barrier is missing its key.
+func (b *Barrier) Sealed() bool {
+	b.RLock()
+	defer b.RUnlock()
+	return b.key == nil
+}
+
+// Unseal hands the barrier its key.
+func (b *Barrier) Unseal(key []byte) error {
+	index, err := DeriveSubkey(key, "govault barrier index")
+	if err != nil {
+		return err
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.key, b.index = key, index
+	return nil
+}
+
+// Seal wipes the barrier key from memory.
+func (b *Barrier) Seal() {
+	b.Lock()
+	defer b.Unlock()
+	clear(b.key)
+	clear(b.index)
+	b.key, b.index = nil, nil
+}
+
+// Index returns a keyed hash of name, stable for as long as the barrier key is,
+// for storing things under identifiers that reveal nothing about them.
+func (b *Barrier) Index(name string) (string, error) {
+	b.RLock()
+	defer b.RUnlock()
+	if b.key == nil {
+		return "", ErrSealed
+	}
+	mac := hmac.New(sha256.New, b.index)
+	mac.Write([]byte(name))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Encrypt seals plaintext under the barrier key, prefixing the nonce.
+func (b *Barrier) Encrypt(plaintext []byte) ([]byte, error) {
+	b.RLock()
+	defer b.RUnlock()
+	if b.key == nil {
+		return nil, ErrSealed
+	}
+	return sealBytes(b.key, plaintext)
+}
+
+// Decrypt opens a ciphertext produced by Encrypt.
+func (b *Barrier) Decrypt(ciphertext []byte) ([]byte, error) {
+	b.RLock()
+	defer b.RUnlock()
+	if b.key == nil {
+		return nil, ErrSealed
+	}
+	return openBytes(b.key, ciphertext)
+}
+
+// EncryptStream returns a writer that seals everything written to it under the
+// barrier key onto dst, for values too large to encrypt in memory. The stream is
+// complete once the writer is closed.
+func (b *Barrier) EncryptStream(dst io.Writer) (io.WriteCloser, error) {
+	b.RLock()
+	defer b.RUnlock()
+	if b.key == nil {
+		return nil, ErrSealed
+	}
+	return NewStreamWriter(b.key, dst)
+}
+
+// DecryptStream returns a reader of a stream sealed by EncryptStream.
+func (b *Barrier) DecryptStream(src io.Reader) (io.Reader, error) {
+	b.RLock()
+	defer b.RUnlock()
+	if b.key == nil {
+		return nil, ErrSealed
+	}
+	return NewStreamReader(b.key, src)
+}
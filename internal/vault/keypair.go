@@ -0,0 +1,77 @@
+package vault
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+)
+
+var ErrBadWrappedKey = errors.New("wrapped key is malformed or not for this key pair")
+
+// GenerateKeyPair returns a new X25519 private key and its public key.
+func GenerateKeyPair() (private, public []byte, err error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv.Bytes(), priv.PublicKey().Bytes(), nil
+}
+
+// WrapForRecipient seals key so only the holder of the private key matching
+// public can open it. An ephemeral X25519 key pair is agreed with public and the
+// shared secret expanded into an AES-GCM key. The result is the ephemeral public
+// key followed by the nonce and ciphertext.
+func WrapForRecipient(public, key []byte) ([]byte, error) {
+	recipient, err := ecdh.X25519().NewPublicKey(public)
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	kek, err := recipientKEK(ephemeral, recipient, ephemeral.PublicKey(), recipient)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealBytes(kek, key)
+	if err != nil {
+		return nil, err
+	}
+	return append(ephemeral.PublicKey().Bytes(), sealed...), nil
+}
+
+// UnwrapWithPrivate opens a key sealed by WrapForRecipient.
+func UnwrapWithPrivate(private, wrapped []byte) ([]byte, error) {
+	priv, err := ecdh.X25519().NewPrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < 32 {
+		return nil, ErrBadWrappedKey
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(wrapped[:32])
+	if err != nil {
+		return nil, ErrBadWrappedKey
+	}
+	kek, err := recipientKEK(priv, ephemeral, ephemeral, priv.PublicKey())
+	if err != nil {
+		return nil, ErrBadWrappedKey
+	}
+	key, err := openBytes(kek, wrapped[32:])
+	if err != nil {
+		return nil, ErrBadWrappedKey
+	}
+	return key, nil
+}
+
+// recipientKEK derives the wrapping key from the agreement between priv and peer,
+// binding it to the ephemeral and recipient public keys.
+func recipientKEK(priv *ecdh.PrivateKey, peer, ephemeral, recipient *ecdh.PublicKey) ([]byte, error) {
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+	secret := append(append(shared, ephemeral.Bytes()...), recipient.Bytes()...)
+	return DeriveSubkey(secret, "govault x25519 wrap")
+}
@@ -0,0 +1,157 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrNoProviderKey = errors.New("keyring holds no key for this provider")
+
+// KeyProvider wraps the barrier key with a key held outside the vault, so the
+// server can unseal itself at boot without an operator.
+type KeyProvider interface {
+	Name() string                          // identifies the kind of provider and its key, recorded in the keyring
+	Wrap(key []byte) ([]byte, error)       // encrypt key for storage in the keyring
+	Unwrap(wrapped []byte) ([]byte, error) // recover a key encrypted by Wrap
+}
+
+// FileKeyProvider wraps keys with a key kept in a local file. It only moves the
+// problem to protecting that file, so it suits development and single hosts
+// where the file lives on separate, better guarded storage.
+type FileKeyProvider struct {
+	path string
+}
+
+func NewFileKeyProvider(path string) *FileKeyProvider {
+	return &FileKeyProvider{path}
+}
+
+func (p *FileKeyProvider) Name() string {
+	return "file"
+}
+
+func (p *FileKeyProvider) Wrap(key []byte) ([]byte, error) {
+	kek, err := p.load(true)
+	if err != nil {
+		return nil, err
+	}
+	return sealBytes(kek, key)
+}
+
+func (p *FileKeyProvider) Unwrap(wrapped []byte) ([]byte, error) {
+	kek, err := p.load(false)
+	if err != nil {
+		return nil, err
+	}
+	return openBytes(kek, wrapped)
+}
+
+// load reads the key file, creating it with a random key when create is set.
+func (p *FileKeyProvider) load(create bool) ([]byte, error) {
+	kek, err := os.ReadFile(p.path)
+	if os.IsNotExist(err) && create {
+		if kek, err = GenerateRandBytes(barrierKeySize); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(p.path), 0700); err != nil {
+			return nil, err
+		}
+		err = os.WriteFile(p.path, kek, 0600)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(kek) != barrierKeySize {
+		return nil, fmt.Errorf("key file %s must hold %d bytes", p.path, barrierKeySize)
+	}
+	return kek, nil
+}
+
+// TransitKeyProvider wraps keys by calling out to a transit service, which holds
+// the wrapping key and never reveals it. TransitHandler is a local stand-in for
+// one; a KMS can be used by putting the same api in front of it.
+type TransitKeyProvider struct {
+	addr   string // base url of the transit service
+	key    string // name of the wrapping key held by the service
+	token  string // bearer token for the service, may be empty
+	client *http.Client
+}
+
+func NewTransitKeyProvider(addr, key, token string) *TransitKeyProvider {
+	return &TransitKeyProvider{addr, key, token, &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (p *TransitKeyProvider) Name() string {
+	return "transit:" + p.key
+}
+
+func (p *TransitKeyProvider) Wrap(key []byte) ([]byte, error) {
+	var res TransitResponse
+	err := p.call("encrypt", TransitRequest{Plaintext: key}, &res)
+	return res.Ciphertext, err
+}
+
+func (p *TransitKeyProvider) Unwrap(wrapped []byte) ([]byte, error) {
+	var res TransitResponse
+	err := p.call("decrypt", TransitRequest{Ciphertext: wrapped}, &res)
+	return res.Plaintext, err
+}
+
+func (p *TransitKeyProvider) call(op string, body TransitRequest, out *TransitResponse) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	endpoint, err := url.JoinPath(p.addr, "v1/transit", op, p.key)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("transit %s: %s: %s", op, res.Status, bytes.TrimSpace(msg))
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// sealBytes encrypts plaintext under key, prefixing the nonce.
+func sealBytes(key, plaintext []byte) ([]byte, error) {
+	ciphertext, nonce, err := EncryptBytes(key, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return append(nonce, ciphertext...), nil
+}
+
+// openBytes decrypts a ciphertext produced by sealBytes.
+func openBytes(key, ciphertext []byte) ([]byte, error) {
+	aesgcm, err := createGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aesgcm.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, text := ciphertext[:aesgcm.NonceSize()], ciphertext[aesgcm.NonceSize():]
+	return aesgcm.Open(nil, nonce, text, nil)
+}
@@ -0,0 +1,126 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrKDFSaturated = errors.New("key derivation queue is full")
+var ErrKDFTimeout = errors.New("timed out waiting for key derivation")
+
+// KDFScheduler bounds how many password key derivations run at once. Callers
+// beyond the concurrency limit wait in a queue of fixed depth, and are turned away
+// immediately once that queue is full so a burst of logins can't pin every cpu.
+type KDFScheduler struct {
+	slots   chan struct{} // one token per derivation allowed to run
+	waiting chan struct{} // one token per caller allowed to queue
+	timeout time.Duration // the longest a caller waits for a slot
+	observe func(result string, took time.Duration)
+}
+
+// Results reported to a scheduler's observer.
+const (
+	KDFResultOK        = "ok"
+	KDFResultSaturated = "saturated"
+	KDFResultTimeout   = "timeout"
+	KDFResultCanceled  = "canceled"
+)
+
+// SetObserver registers fn to be told the outcome of every call to Do and how
+// long the derivation took, or how long the caller waited before giving up. It
+// must be called before the scheduler is used.
+func (s *KDFScheduler) SetObserver(fn func(result string, took time.Duration)) {
+	s.observe = fn
+}
+
+func (s *KDFScheduler) report(result string, start time.Time) {
+	if s.observe != nil {
+		s.observe(result, time.Since(start))
+	}
+}
+
+// run times fn and reports it as a successful derivation.
+func (s *KDFScheduler) run(fn func()) {
+	defer func() { <-s.slots }()
+	start := time.Now()
+	fn()
+	s.report(KDFResultOK, start)
+}
+
+func NewKDFScheduler(concurrency, queueDepth int, timeout time.Duration) *KDFScheduler {
+	return &KDFScheduler{
+		slots:   make(chan struct{}, max(concurrency, 1)),
+		waiting: make(chan struct{}, max(queueDepth, 0)),
+		timeout: timeout,
+	}
+}
+
+// Do runs fn once a slot is free. It returns ErrKDFSaturated without running fn
+// when the queue is full, and ErrKDFTimeout or the context's error when no slot
+// frees up in time.
+func (s *KDFScheduler) Do(ctx context.Context, fn func()) error {
+	select {
+	case s.slots <- struct{}{}:
+		s.run(fn)
+		return nil
+	default:
+	}
+
+	start := time.Now()
+	select {
+	case s.waiting <- struct{}{}:
+	default:
+		s.report(KDFResultSaturated, start)
+		return ErrKDFSaturated
+	}
+
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+	select {
+	case s.slots <- struct{}{}:
+		<-s.waiting
+	case <-timer.C:
+		<-s.waiting
+		s.report(KDFResultTimeout, start)
+		return ErrKDFTimeout
+	case <-ctx.Done():
+		<-s.waiting
+		s.report(KDFResultCanceled, start)
+		return ctx.Err()
+	}
+	s.run(fn)
+	return nil
+}
+
+// Running reports how many derivations are in progress.
+func (s *KDFScheduler) Running() int {
+	return len(s.slots)
+}
+
+// Queued reports how many callers are waiting for a slot.
+func (s *KDFScheduler) Queued() int {
+	return len(s.waiting)
+}
+
+// NewKey is vault.NewKey run through the scheduler.
+func (s *KDFScheduler) NewKey(ctx context.Context, text string, saltSize int) (*Key, error) {
+	salt, err := GenerateRandBytes(saltSize)
+	if err != nil {
+		return nil, err
+	}
+	return s.NewKeyWithSalt(ctx, text, salt)
+}
+
+// NewKeyWithSalt is vault.NewKeyWithSalt run through the scheduler.
+func (s *KDFScheduler) NewKeyWithSalt(ctx context.Context, text string, salt []byte) (*Key, error) {
+	var key *Key
+	var kerr error
+	err := s.Do(ctx, func() {
+		key, kerr = NewKeyWithSalt(text, salt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, kerr
+}
@@ -0,0 +1,122 @@
+package vault
+
+import (
+	"errors"
+)
+
+var ErrInvalidShares = errors.New("shares must be between 1 and 255 and no fewer than the threshold")
+var ErrInvalidShare = errors.New("key share is malformed")
+var ErrDuplicateShare = errors.New("key share was already submitted")
+
+// Split divides secret into n shares using Shamir's secret sharing over GF(256),
+// any threshold of which recombine to the secret. Each share is as long as the
+// secret plus one byte holding its x coordinate.
+func Split(secret []byte, n, threshold int) ([][]byte, error) {
+	if n < 1 || n > 255 || threshold < 1 || threshold > n {
+		return nil, ErrInvalidShares
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("cannot split an empty secret")
+	}
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+	// every byte of the secret is the constant term of its own random polynomial
+	// of degree threshold-1, evaluated at x = 1..n.
+	coeffs := make([]byte, threshold)
+	for b, s := range secret {
+		random, err := GenerateRandBytes(threshold - 1)
+		if err != nil {
+			return nil, err
+		}
+		coeffs[0] = s
+		copy(coeffs[1:], random)
+		for _, share := range shares {
+			share[b] = evalPoly(coeffs, share[len(secret)])
+		}
+	}
+	clear(coeffs)
+	return shares, nil
+}
+
+// Combine recovers the secret from threshold or more shares produced by Split.
+// Too few shares yield garbage rather than an error, callers must verify the result.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, ErrInvalidShare
+	}
+	size := len(shares[0])
+	xs := make([]byte, len(shares))
+	for i, share := range shares {
+		if len(share) != size || size < 2 || share[size-1] == 0 {
+			return nil, ErrInvalidShare
+		}
+		xs[i] = share[size-1]
+		for _, x := range xs[:i] {
+			if x == xs[i] {
+				return nil, ErrDuplicateShare
+			}
+		}
+	}
+	secret := make([]byte, size-1)
+	for b := range secret {
+		// lagrange interpolation at x = 0.
+		var acc byte
+		for i, share := range shares {
+			basis := byte(1)
+			for j, xj := range xs {
+				if i != j {
+					basis = gfMul(basis, gfDiv(xj, xj^xs[i]))
+				}
+			}
+			acc ^= gfMul(share[b], basis)
+		}
+		secret[b] = acc
+	}
+	return secret, nil
+}
+
+// ShareX returns the x coordinate a share was evaluated at.
+func ShareX(share []byte) byte {
+	if len(share) == 0 {
+		return 0
+	}
+	return share[len(share)-1]
+}
+
+// evalPoly evaluates the polynomial with coeffs (constant term first) at x by Horner's rule.
+func evalPoly(coeffs []byte, x byte) byte {
+	var y byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// gfMul multiplies in GF(2^8) with the AES polynomial, without branching on its inputs.
+func gfMul(a, b byte) byte {
+	var p byte
+	for range 8 {
+		p ^= a & -(b & 1)
+		carry := -(a >> 7)
+		a = a<<1 ^ 0x1b&carry
+		b >>= 1
+	}
+	return p
+}
+
+// gfInv returns the multiplicative inverse of a as a^254. The inverse of 0 is 0.
+func gfInv(a byte) byte {
+	r := a
+	for range 6 {
+		r = gfMul(r, r)
+		r = gfMul(r, a)
+	}
+	return gfMul(r, r)
+}
+
+func gfDiv(a, b byte) byte {
+	return gfMul(a, gfInv(b))
+}
@@ -0,0 +1,214 @@
+package vault
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Streams are sealed with the STREAM construction so values of any size can be
+// encrypted without holding them in memory, and without the limits of sealing
+// everything with a single GCM call. The plaintext is cut into StreamChunkSize
+// chunks, each sealed with AES-GCM under a key derived for the stream from a
+// random salt. A chunk's nonce is its position in the stream and a flag set only
+// on the last chunk, so chunks that are reordered, dropped, or cut off at the
+// end fail to open.
+//
+// A sealed stream is a version byte and the salt, then the sealed chunks. Every
+// chunk but the last holds exactly StreamChunkSize bytes; the last holds what is
+// left, nothing when the whole stream is empty.
+const StreamChunkSize = 64 << 10
+
+const (
+	streamVersion  = 1
+	streamSaltSize = 16
+	streamInfo     = "govault stream"
+)
+
+var ErrStreamVersion = errors.New("stream was sealed in an unknown format")
+var ErrStreamCorrupt = errors.New("stream is corrupt or was truncated")
+var errStreamClosed = errors.New("stream writer is closed")
+
+// streamNonce is the nonce of the counter'th chunk: an 11 byte big endian
+// counter followed by a byte marking the last chunk.
+func streamNonce(nonce []byte, counter uint64, last bool) []byte {
+	clear(nonce)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+func streamAEAD(key, salt []byte) (cipher.AEAD, error) {
+	subkey, err := hkdf.Key(sha256.New, key, salt, streamInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(subkey)
+	return createGCM(subkey)
+}
+
+type streamWriter struct {
+	aead    cipher.AEAD
+	dst     io.Writer
+	buf     []byte // plaintext of the chunk being filled
+	out     []byte // the sealed chunk being written
+	nonce   []byte
+	counter uint64
+	closed  bool
+	err     error // the first write to dst that failed, returned from then on
+}
+
+// NewStreamWriter returns a writer that seals everything written to it with key
+// onto dst. The stream is only complete once Close has sealed the last chunk,
+// and Close does not close dst.
+func NewStreamWriter(key []byte, dst io.Writer) (io.WriteCloser, error) {
+	salt, err := GenerateRandBytes(streamSaltSize)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := streamAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dst.Write(append([]byte{streamVersion}, salt...)); err != nil {
+		return nil, err
+	}
+	return &streamWriter{
+		aead:  aead,
+		dst:   dst,
+		buf:   make([]byte, 0, StreamChunkSize),
+		out:   make([]byte, 0, StreamChunkSize+aead.Overhead()),
+		nonce: make([]byte, aead.NonceSize()),
+	}, nil
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, errStreamClosed
+	}
+	n := 0
+	for len(p) > 0 {
+		if s.err != nil {
+			return n, s.err
+		}
+		// a full chunk is only sealed once more follows it, since until then it
+		// might be the last.
+		if len(s.buf) == StreamChunkSize {
+			s.err = s.seal(false)
+			continue
+		}
+		k := min(len(p), StreamChunkSize-len(s.buf))
+		s.buf = append(s.buf, p[:k]...)
+		p, n = p[k:], n+k
+	}
+	return n, nil
+}
+
+// Close seals the last chunk.
+func (s *streamWriter) Close() error {
+	if s.closed {
+		return s.err
+	}
+	s.closed = true
+	if s.err == nil {
+		s.err = s.seal(true)
+	}
+	clear(s.buf)
+	return s.err
+}
+
+func (s *streamWriter) seal(last bool) error {
+	s.out = s.aead.Seal(s.out[:0], streamNonce(s.nonce, s.counter, last), s.buf, nil)
+	clear(s.buf)
+	s.buf = s.buf[:0]
+	s.counter++
+	_, err := s.dst.Write(s.out)
+	return err
+}
+
+type streamReader struct {
+	aead    cipher.AEAD
+	src     *bufio.Reader
+	buf     []byte // the sealed chunk being read
+	plain   []byte // what is left of the last chunk opened
+	opened  []byte // backs plain
+	nonce   []byte
+	counter uint64
+	done    bool  // whether the last chunk has been opened
+	err     error // returned once plain is drained
+}
+
+// NewStreamReader returns a reader of the plaintext of a stream sealed with key
+// by a writer from NewStreamWriter. Reads fail with ErrStreamCorrupt as soon as
+// a chunk fails to open, so plaintext read before that may be followed by an
+// error rather than io.EOF.
+func NewStreamReader(key []byte, src io.Reader) (io.Reader, error) {
+	header := make([]byte, 1+streamSaltSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return nil, ErrStreamCorrupt
+	}
+	if header[0] != streamVersion {
+		return nil, ErrStreamVersion
+	}
+	aead, err := streamAEAD(key, header[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{
+		aead:   aead,
+		src:    bufio.NewReader(src),
+		buf:    make([]byte, StreamChunkSize+aead.Overhead()),
+		opened: make([]byte, 0, StreamChunkSize),
+		nonce:  make([]byte, aead.NonceSize()),
+	}, nil
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.plain) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		if s.done {
+			return 0, io.EOF
+		}
+		s.err = s.open()
+	}
+	n := copy(p, s.plain)
+	s.plain = s.plain[n:]
+	return n, nil
+}
+
+// open reads and opens the next chunk. A chunk is the last when it is short, or
+// when nothing follows it.
+func (s *streamReader) open() error {
+	n, err := io.ReadFull(s.src, s.buf)
+	last := false
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		last = true
+	case err != nil:
+		return err
+	default:
+		if _, err := s.src.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	if n < s.aead.Overhead() {
+		return ErrStreamCorrupt
+	}
+	plain, err := s.aead.Open(s.opened[:0], streamNonce(s.nonce, s.counter, last), s.buf[:n], nil)
+	if err != nil {
+		return ErrStreamCorrupt
+	}
+	s.plain, s.done = plain, last
+	s.counter++
+	return nil
+}
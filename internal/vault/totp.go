@@ -0,0 +1,100 @@
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters from RFC 6238 that authenticator apps assume by default.
+const (
+	TOTPPeriod = 30 // seconds per time step
+	TOTPDigits = 6
+	totpMod    = 1_000_000 // 10^TOTPDigits
+	totpSkew   = 1         // time steps of clock drift tolerated either side of now
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new random 160 bit TOTP seed.
+func GenerateTOTPSecret() ([]byte, error) {
+	return GenerateRandBytes(20)
+}
+
+// EncodeTOTPSecret renders a seed as the base32 text authenticator apps accept.
+func EncodeTOTPSecret(secret []byte) string {
+	return totpEncoding.EncodeToString(secret)
+}
+
+// TOTPStep returns the time step t falls in.
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / TOTPPeriod
+}
+
+// TOTPCode computes the code for the given time step (RFC 4226 HOTP with SHA-1).
+func TOTPCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", TOTPDigits, bin%totpMod)
+}
+
+// ValidateTOTP checks code against the steps around t and returns the step that
+// matched. Callers should reject steps at or before the last one accepted so a
+// code cannot be replayed.
+func ValidateTOTP(secret []byte, code string, t time.Time) (int64, bool) {
+	now := TOTPStep(t)
+	matched, ok := int64(0), false
+	for step := now - totpSkew; step <= now+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(TOTPCode(secret, step)), []byte(code)) == 1 {
+			matched, ok = step, true
+		}
+	}
+	return matched, ok
+}
+
+// TOTPURI returns the otpauth:// provisioning uri for a seed, which authenticator
+// apps accept directly or rendered as a QR code.
+func TOTPURI(issuer, account string, secret []byte) string {
+	label := url.PathEscape(issuer + ":" + account)
+	q := url.Values{}
+	q.Set("secret", EncodeTOTPSecret(secret))
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(TOTPDigits))
+	q.Set("period", fmt.Sprint(TOTPPeriod))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// GenerateRecoveryCodes returns n single use codes of the form xxxxx-xxxxx.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b, err := GenerateRandBytes(7)
+		if err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(totpEncoding.EncodeToString(b))[:10]
+		codes[i] = s[:5] + "-" + s[5:]
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode returns the digest a recovery code is stored as.
+func HashRecoveryCode(salt []byte, code string) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return h.Sum(nil)
+}
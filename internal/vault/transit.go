@@ -0,0 +1,61 @@
+package vault
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+)
+
+// TransitRequest is the body of a transit encrypt or decrypt call.
+type TransitRequest struct {
+	Plaintext  []byte `json:"plaintext,omitempty"`
+	Ciphertext []byte `json:"ciphertext,omitempty"`
+}
+
+// TransitResponse is the result of a transit encrypt or decrypt call.
+type TransitResponse struct {
+	Plaintext  []byte `json:"plaintext,omitempty"`
+	Ciphertext []byte `json:"ciphertext,omitempty"`
+}
+
+// TransitHandler serves a minimal transit api: encryption as a service with
+// named keys derived from root, which never leave the process. Requests must
+// carry token as a bearer token unless it is empty. It stands in for a KMS in
+// development, run by govault transit serve.
+func TransitHandler(root []byte, token string) http.Handler {
+	mux := http.NewServeMux()
+	serve := func(op func(key []byte, req TransitRequest) (TransitResponse, error)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			var req TransitRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+			key, err := DeriveSubkey(root, "govault transit "+r.PathValue("key"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			res, err := op(key, req)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(res)
+		}
+	}
+	mux.HandleFunc("POST /v1/transit/encrypt/{key}", serve(func(key []byte, req TransitRequest) (TransitResponse, error) {
+		ciphertext, err := sealBytes(key, req.Plaintext)
+		return TransitResponse{Ciphertext: ciphertext}, err
+	}))
+	mux.HandleFunc("POST /v1/transit/decrypt/{key}", serve(func(key []byte, req TransitRequest) (TransitResponse, error) {
+		plaintext, err := openBytes(key, req.Ciphertext)
+		return TransitResponse{Plaintext: plaintext}, err
+	}))
+	return mux
+}
@@ -3,6 +3,7 @@ package vault
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hkdf"
 	"crypto/pbkdf2"
 	"crypto/rand"
 	"crypto/sha256"
@@ -80,6 +81,11 @@ func DeriveKeyWithSalt(text string, salt []byte) ([]byte, error) {
 }
 
 func Encrypt(key []byte, text string) ([]byte, []byte, error) {
+	return EncryptBytes(key, []byte(text))
+}
+
+// EncryptBytes seals plaintext with key and returns the ciphertext and the random nonce used.
+func EncryptBytes(key, plaintext []byte) ([]byte, []byte, error) {
 	aesgcm, err := createGCM(key)
 	if err != nil {
 		return nil, nil, err
@@ -91,7 +97,7 @@ func Encrypt(key []byte, text string) ([]byte, []byte, error) {
 		return nil, nil, err
 	}
 
-	ciphertext := aesgcm.Seal(nil, nonce, []byte(text), nil)
+	ciphertext := aesgcm.Seal(nil, nonce, plaintext, nil)
 	return ciphertext, nonce, nil
 }
 
@@ -109,6 +115,12 @@ func Decrypt(nonce, key, ciphertext []byte) ([]byte, error) {
 	return plaintext, nil
 }
 
+// DeriveSubkey expands high entropy secret material into a 32 byte key bound to
+// info. It must not be used on passwords, those go through pbkdf2.
+func DeriveSubkey(secret []byte, info string) ([]byte, error) {
+	return hkdf.Key(sha256.New, secret, nil, info, 32)
+}
+
 func createGCM(key []byte) (cipher.AEAD, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
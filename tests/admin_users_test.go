@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jdpolicano/govault/internal/audit"
+	"github.com/jdpolicano/govault/internal/server"
+	"github.com/jdpolicano/govault/internal/server/routes/admin"
+	"github.com/jdpolicano/govault/internal/server/routes/group"
+	"github.com/jdpolicano/govault/internal/server/routes/login"
+	"github.com/jdpolicano/govault/internal/server/routes/register"
+	"github.com/jdpolicano/govault/internal/store"
+)
+
+// adminRefs returns unsealed refs with "root" configured as an admin and a
+// session token for them.
+func adminRefs(t *testing.T) (*server.ServerRefs, string) {
+	t.Helper()
+	config := server.DefaultConfig()
+	config.Admins = []string{"root"}
+	refs := unsealedRefs(t, config)
+	return refs, groupUser(t, refs, "root")
+}
+
+func credentials(h http.HandlerFunc, user, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(server.AuthCredentials{Username: user, Password: password})
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("POST", "/", bytes.NewReader(body)))
+	return rec
+}
+
+func TestDisableUser(t *testing.T) {
+	refs, root := adminRefs(t)
+	if rec := credentials(register.Handler(refs), "bob", "hunter22"); rec.Code != http.StatusOK {
+		t.Fatalf("register failed: %d %s", rec.Code, rec.Body)
+	}
+	if n := refs.Sessions.Len(); n != 2 {
+		t.Fatalf("expected two sessions, got %d", n)
+	}
+
+	if code, res := groupCall(admin.DisableUserHandler(refs), root, admin.UserRequest{User: "bob"}); code != http.StatusOK {
+		t.Fatalf("disable failed: %d %+v", code, res)
+	}
+	if n := refs.Sessions.Len(); n != 1 {
+		t.Errorf("expected disabling to end bob's session, got %d sessions", n)
+	}
+	if rec := credentials(login.Handler(refs), "bob", "hunter22"); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a disabled account to be refused, got %d", rec.Code)
+	}
+	if rec := credentials(login.Handler(refs), "bob", "wrong"); rec.Code == http.StatusForbidden {
+		t.Fatalf("expected a wrong password not to learn the account is disabled")
+	}
+
+	groupCall(admin.EnableUserHandler(refs), root, admin.UserRequest{User: "bob"})
+	if rec := credentials(login.Handler(refs), "bob", "hunter22"); rec.Code != http.StatusOK {
+		t.Fatalf("expected an enabled account to log in, got %d", rec.Code)
+	}
+	if code, _ := groupCall(admin.DisableUserHandler(refs), root, admin.UserRequest{User: "root"}); code != http.StatusBadRequest {
+		t.Errorf("expected admins not to disable themselves, got %d", code)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	refs, root := adminRefs(t)
+	groupUser(t, refs, "alice")
+	bob := groupUser(t, refs, "bob")
+	refs.Store.Set("bob", "db", store.CipherText{Nonce: []byte("n"), Text: []byte("c")}, store.Metadata{})
+	groupCall(group.CreateHandler(refs), bob, group.CreateRequest{Group: "ops"})
+	groupCall(group.AddMemberHandler(refs), bob, group.MemberRequest{Group: "ops", User: "alice"})
+
+	if code, res := groupCall(admin.DeleteUserHandler(refs), root, admin.UserRequest{User: "bob"}); code != http.StatusOK {
+		t.Fatalf("delete failed: %d %+v", code, res)
+	}
+	if refs.Store.HasUser("bob") {
+		t.Fatalf("expected bob to be gone")
+	}
+	if records, _ := filepath.Glob(filepath.Join(refs.Config.VaultPath, "users", "*")); len(records) != 2 {
+		t.Errorf("expected bob's record to be removed from disk, got %v", records)
+	}
+	if _, ok := refs.Sessions.Get(bob); ok {
+		t.Errorf("expected bob's session to be revoked")
+	}
+	g, _ := refs.Store.GetGroup("ops")
+	if _, ok := g.Members["bob"]; ok || !g.Members["alice"].Admin {
+		t.Errorf("expected bob dropped from the group and alice promoted, got %+v", g.Members)
+	}
+
+	if code, _ := groupCall(admin.DeleteUserHandler(refs), root, admin.UserRequest{User: "bob"}); code != http.StatusNotFound {
+		t.Errorf("expected deleting an unknown user to 404, got %d", code)
+	}
+}
+
+func TestAdminUsersRequireAdmin(t *testing.T) {
+	refs, root := adminRefs(t)
+	bob := groupUser(t, refs, "bob")
+	if code, _ := groupCall(admin.LogoutUserHandler(refs), bob, admin.UserRequest{User: "root"}); code != http.StatusForbidden {
+		t.Fatalf("expected non-admins to be refused, got %d", code)
+	}
+
+	// promoted admins get root the same as configured ones.
+	groupCall(admin.SetAdminHandler(refs), root, admin.AdminRequest{User: "bob", Admin: true})
+	code, res := groupCall(admin.UsersHandler(refs), bob, nil)
+	if code != http.StatusOK {
+		t.Fatalf("expected bob to list users once promoted, got %d", code)
+	}
+	users := res.Data.([]any)
+	if len(users) != 2 || users[0].(map[string]any)["admin"] != true {
+		t.Errorf("unexpected listing %+v", users)
+	}
+}
+
+func TestAdminActionAudited(t *testing.T) {
+	config := server.DefaultConfig()
+	config.Admins = []string{"root"}
+	config.Audit.File = filepath.Join(t.TempDir(), "audit.log")
+	config.Audit.ChainKey = chainKey
+	refs := unsealedRefs(t, config)
+	if err := refs.OpenAudit(); err != nil {
+		t.Fatalf("OpenAudit returned error: %v", err)
+	}
+	root := groupUser(t, refs, "root")
+	groupUser(t, refs, "bob")
+	groupCall(admin.LogoutUserHandler(refs), root, admin.UserRequest{User: "bob"})
+	refs.Audit.Close()
+
+	f, _ := os.Open(config.Audit.File)
+	defer f.Close()
+	if _, err := audit.Verify(f, chainKey); err != nil {
+		t.Fatalf("audit log does not verify: %v", err)
+	}
+	raw, _ := os.ReadFile(config.Audit.File)
+	if !strings.Contains(string(raw), `"operation":"admin.users.logout","user":"root"`) || !strings.Contains(string(raw), `"target":"bob"`) {
+		t.Fatalf("expected the logout and its target in the audit log, got %s", raw)
+	}
+}
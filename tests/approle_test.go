@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/server"
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/server/routes/approle"
+	"github.com/jdpolicano/govault/internal/store"
+)
+
+func TestRoleIssueAndOpen(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	owner := server.NewSession("bob", key, time.Minute)
+	role, creds, err := server.NewRole(owner, server.Scope{Paths: []string{"ci/*"}}, []string{"10.0.0.0/8"}, time.Hour)
+	if err != nil {
+		t.Fatalf("NewRole returned error: %v", err)
+	}
+	if bytes.Contains(role.SecretHash, []byte(creds.SecretID)) {
+		t.Fatalf("secret id should not be stored")
+	}
+
+	got, err := server.OpenRole(role, creds.SecretID, "10.1.2.3:5555")
+	if err != nil || !bytes.Equal(got, key) {
+		t.Fatalf("OpenRole failed: %v", err)
+	}
+	if _, err := server.OpenRole(role, creds.SecretID, "192.168.0.1:5555"); !errors.Is(err, e.AddressNotAllowed) {
+		t.Errorf("expected address to be rejected, got %v", err)
+	}
+
+	rotated, next, err := server.RotateRoleSecret(owner, role)
+	if err != nil {
+		t.Fatalf("RotateRoleSecret returned error: %v", err)
+	}
+	if _, err := server.OpenRole(rotated, creds.SecretID, "10.1.2.3:5555"); !errors.Is(err, e.IncorrectRoleCredentials) {
+		t.Errorf("expected old secret id to be rejected, got %v", err)
+	}
+	if _, err := server.OpenRole(rotated, next.SecretID, "10.1.2.3:5555"); err != nil {
+		t.Errorf("expected new secret id to work, got %v", err)
+	}
+}
+
+func TestRoleCannotEscalate(t *testing.T) {
+	owner := server.NewSession("bob", []byte("key"), time.Minute)
+	owner.Scope = server.Scope{ReadOnly: true}
+	if _, _, err := server.NewRole(owner, server.Scope{}, nil, time.Hour); !errors.Is(err, e.ScopeEscalation) {
+		t.Fatalf("expected scope escalation, got %v", err)
+	}
+	if _, _, err := server.NewRole(server.NewSession("bob", []byte("key"), time.Minute), server.Scope{}, []string{"nope"}, time.Hour); !errors.Is(err, e.InvalidCIDR) {
+		t.Fatalf("expected invalid cidr, got %v", err)
+	}
+}
+
+func TestJSONStoreRoles(t *testing.T) {
+	js := store.NewJSONStore(t.TempDir())
+	if err := js.AddUser("bob", []byte("login"), []byte("salt")); err != nil {
+		t.Fatalf("AddUser returned error: %v", err)
+	}
+	role := store.Role{ID: "r1", Owner: "bob", SecretHash: []byte("h")}
+	if err := js.SetRole(role); err != nil {
+		t.Fatalf("SetRole returned error: %v", err)
+	}
+	if got, ok := js.GetRole("r1"); !ok || got.Owner != "bob" {
+		t.Fatalf("GetRole returned wrong role")
+	}
+	if n := len(js.ListRoles("bob")); n != 1 {
+		t.Errorf("expected one role, got %d", n)
+	}
+	if err := js.DeleteRole("alice", "r1"); err == nil {
+		t.Errorf("expected deleting another user's role to fail")
+	}
+	if err := js.DeleteRole("bob", "r1"); err != nil {
+		t.Fatalf("DeleteRole returned error: %v", err)
+	}
+	if _, ok := js.GetRole("r1"); ok {
+		t.Errorf("expected role to be gone")
+	}
+}
+
+func TestRoleRoutesNeedUserSession(t *testing.T) {
+	refs := unsealedRefs(t, server.DefaultConfig())
+	bob := groupUser(t, refs, "bob")
+	code, res := groupCall(approle.CreateHandler(refs), bob, approle.CreateRequest{CIDRs: []string{"10.0.0.0/8"}, TTL: "1m"})
+	if code != http.StatusOK {
+		t.Fatalf("create failed: %d %+v", code, res)
+	}
+	roleID := res.Data.(map[string]any)["role_id"].(string)
+
+	owner, _ := refs.Sessions.Get(bob)
+	roleSess, readOnly := owner, owner
+	roleSess.Role = roleID
+	readOnly.Scope = server.Scope{ReadOnly: true}
+	for name, sess := range map[string]server.Session{"role": roleSess, "read only": readOnly} {
+		token, _ := refs.Sessions.CreateSession(sess)
+		if code, _ := groupCall(approle.CreateHandler(refs), token, approle.CreateRequest{TTL: "24h"}); code != http.StatusForbidden {
+			t.Errorf("%s: expected create to be refused, got %d", name, code)
+		}
+		if code, _ := groupCall(approle.RotateHandler(refs), token, approle.RoleRequest{RoleID: roleID}); code != http.StatusForbidden {
+			t.Errorf("%s: expected rotate to be refused, got %d", name, code)
+		}
+		if code, _ := groupCall(approle.RevokeHandler(refs), token, approle.RoleRequest{RoleID: roleID}); code != http.StatusForbidden {
+			t.Errorf("%s: expected revoke to be refused, got %d", name, code)
+		}
+	}
+	if _, exists := refs.Store.GetRole(roleID); !exists {
+		t.Errorf("expected the role to survive")
+	}
+}
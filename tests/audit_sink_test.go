@@ -0,0 +1,198 @@
+package tests
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/audit"
+	"github.com/jdpolicano/govault/internal/server"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+)
+
+func TestFileSinkRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := audit.NewFileSink(path, 600, 5)
+	if err != nil {
+		t.Fatalf("NewFileSink returned error: %v", err)
+	}
+	a, _ := audit.NewAuditor(chainKey, sink)
+	for i := 0; i < 10; i++ {
+		a.Record(audit.Event{Operation: "get", User: "bob", Status: 200, Result: audit.ResultSuccess})
+	}
+	a.Close()
+
+	rotated, _ := filepath.Glob(path + ".*")
+	if len(rotated) == 0 {
+		t.Fatalf("expected the log to rotate")
+	}
+	var readers []io.Reader
+	for i := len(rotated); i >= 1; i-- {
+		f, err := os.Open(fmt.Sprintf("%s.%d", path, i))
+		if err != nil {
+			t.Fatalf("missing rotated file %d: %v", i, err)
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	current, _ := os.Open(path)
+	defer current.Close()
+	res, err := audit.Verify(io.MultiReader(append(readers, current)...), chainKey)
+	if err != nil || res.Events != 10 {
+		t.Fatalf("expected 10 events across rotated files, got %d %v", res.Events, err)
+	}
+
+	// a restart resumes the chain even when the current file is empty.
+	sink, _ = audit.NewFileSink(path, 600, 5)
+	last, err := sink.Last()
+	if err != nil || last.Seq != 10 {
+		t.Fatalf("expected to resume at event 10, got %d %v", last.Seq, err)
+	}
+}
+
+func TestSocketSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer ln.Close()
+	lines := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		lines <- line
+	}()
+
+	sink := audit.NewSocketSink(path)
+	defer sink.Close()
+	if err := sink.Write(audit.Event{Seq: 1, Operation: "set"}); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	select {
+	case line := <-lines:
+		if !strings.Contains(line, `"operation":"set"`) {
+			t.Errorf("unexpected line %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no event received")
+	}
+}
+
+func TestSyslogSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Skipf("unixgram sockets unavailable: %v", err)
+	}
+	defer conn.Close()
+
+	sink := audit.NewSyslogSink("unixgram", path, "govault")
+	defer sink.Close()
+	ev := audit.Event{Seq: 1, Time: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), Operation: "get", Result: audit.ResultDenied}
+	if err := sink.Write(ev); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("no message received: %v", err)
+	}
+	msg := string(buf[:n])
+	// authpriv (10) * 8 + notice (5)
+	if !strings.HasPrefix(msg, "<85>1 2026-01-02T03:04:05Z ") || !strings.Contains(msg, " govault ") || !strings.Contains(msg, ` audit - {"seq":1`) {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func TestAuditFailClosed(t *testing.T) {
+	config := server.DefaultConfig()
+	config.Audit.Socket = filepath.Join(t.TempDir(), "missing.sock")
+	config.Audit.FailClosed = true
+	config.Audit.ChainKey = chainKey
+	refs := server.NewServerRefs(config)
+	if err := refs.OpenAudit(); err != nil {
+		t.Fatalf("OpenAudit returned error: %v", err)
+	}
+
+	called := false
+	h := func(http.ResponseWriter, *http.Request) { called = true }
+	rec := httptest.NewRecorder()
+	middleware.Audit(refs, "get")(h)(rec, httptest.NewRequest("POST", "/get", nil))
+	if called || rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected request to be refused, got %d called=%v", rec.Code, called)
+	}
+	status := refs.Audit.Status()
+	if len(status) != 1 || status[0].Failures == 0 {
+		t.Errorf("expected the sink failure to be counted, got %+v", status)
+	}
+}
+
+func TestAuditorPartialFailure(t *testing.T) {
+	file, _ := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.log"), 0, 0)
+	a, _ := audit.NewAuditor(chainKey, file, audit.NewSocketSink(filepath.Join(t.TempDir(), "missing.sock")))
+	defer a.Close()
+	_, err := a.Record(audit.Event{Operation: "get"})
+	if err == nil || errors.Is(err, audit.ErrNoSinkRecorded) {
+		t.Fatalf("expected a partial failure, got %v", err)
+	}
+}
+
+// stallSink holds every write until release is closed.
+type stallSink struct {
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (s *stallSink) Name() string { return "stall" }
+func (s *stallSink) Close() error { return nil }
+func (s *stallSink) Write(audit.Event) error {
+	s.writing <- struct{}{}
+	<-s.release
+	return nil
+}
+
+func TestAuditorSlowSink(t *testing.T) {
+	slow := &stallSink{writing: make(chan struct{}, 2), release: make(chan struct{})}
+	a, _ := audit.NewAuditor(chainKey, slow)
+	events := make(chan audit.Event, 2)
+	for range 2 {
+		go func() {
+			ev, _ := a.Record(audit.Event{Operation: "get"})
+			events <- ev
+		}()
+	}
+	<-slow.writing
+
+	// a write in flight must not hold up the chain or the status of the sinks.
+	status := make(chan []audit.SinkStatus)
+	go func() { status <- a.Status() }()
+	select {
+	case <-status:
+	case <-time.After(time.Second):
+		t.Fatalf("expected Status not to wait for a sink write")
+	}
+	close(slow.release)
+	first, second := <-events, <-events
+	if first.Seq+second.Seq != 3 || first.Hash == second.Hash {
+		t.Fatalf("expected both events in the chain, got %+v %+v", first, second)
+	}
+	a.Close()
+	if _, err := a.Record(audit.Event{Operation: "get"}); !errors.Is(err, audit.ErrNoSinkRecorded) {
+		t.Fatalf("expected a closed auditor to refuse events, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/audit"
+	"github.com/jdpolicano/govault/internal/server"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+)
+
+// chainKey keys the audit hash chain in tests.
+var chainKey = []byte("chain key")
+
+func writeAuditEvents(t *testing.T, path string, n int) {
+	t.Helper()
+	sink, err := audit.NewFileSink(path, 0, 0)
+	if err != nil {
+		t.Fatalf("NewFileSink returned error: %v", err)
+	}
+	log, err := audit.NewAuditor(chainKey, sink)
+	if err != nil {
+		t.Fatalf("NewAuditor returned error: %v", err)
+	}
+	defer log.Close()
+	for i := 0; i < n; i++ {
+		if _, err := log.Record(audit.Event{Operation: "get", User: "bob", Status: 200, Result: audit.ResultSuccess}); err != nil {
+			t.Fatalf("Record returned error: %v", err)
+		}
+	}
+}
+
+func TestAuditChainVerifies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeAuditEvents(t, path, 2)
+	writeAuditEvents(t, path, 2) // reopening continues the chain
+
+	f, _ := os.Open(path)
+	defer f.Close()
+	res, err := audit.Verify(f, chainKey)
+	if err != nil || res.Events != 4 {
+		t.Fatalf("expected 4 verified events, got %d %v", res.Events, err)
+	}
+}
+
+func TestAuditDetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeAuditEvents(t, path, 3)
+	raw, _ := os.ReadFile(path)
+	lines := strings.SplitAfter(string(raw), "\n")
+
+	cases := map[string]string{
+		"edited":    lines[0] + strings.Replace(lines[1], `"user":"bob"`, `"user":"eve"`, 1) + lines[2],
+		"deleted":   lines[0] + lines[2],
+		"head cut":  lines[1] + lines[2],
+		"reordered": lines[0] + lines[2] + lines[1],
+	}
+	for name, content := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := audit.Verify(strings.NewReader(content), chainKey); err == nil {
+				t.Errorf("expected verification to fail")
+			}
+		})
+	}
+}
+
+func TestAuditChainNeedsKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeAuditEvents(t, path, 2)
+	raw, _ := os.ReadFile(path)
+
+	// without the key, an edited log can't be given a chain that verifies.
+	var ev audit.Event
+	json.Unmarshal(raw[:bytes.IndexByte(raw, '\n')], &ev)
+	ev.User = "eve"
+	ev.Hash, _ = audit.ComputeHash([]byte("guessed key"), ev)
+	forged, _ := json.Marshal(ev)
+	if _, err := audit.VerifyPartial(bytes.NewReader(append(forged, '\n')), chainKey); err == nil {
+		t.Errorf("expected an event hashed under another key to fail")
+	}
+	if _, err := audit.Verify(bytes.NewReader(raw), []byte("other key")); err == nil {
+		t.Errorf("expected the log to fail under another key")
+	}
+	if _, err := audit.NewAuditor(nil); !errors.Is(err, audit.ErrNoChainKey) {
+		t.Errorf("expected an auditor without a chain key to be refused, got %v", err)
+	}
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	dir := t.TempDir()
+	config := server.DefaultConfig()
+	config.Audit.File = filepath.Join(dir, "audit.log")
+	config.Audit.HMAC = []byte("hmac key")
+	config.Audit.ChainKey = chainKey
+	refs := server.NewServerRefs(config)
+	if err := refs.OpenAudit(); err != nil {
+		t.Fatalf("OpenAudit returned error: %v", err)
+	}
+	refs.Sessions.Set("govault-id", server.NewSession("bob", []byte("key"), time.Minute))
+
+	h := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotFound) }
+	chain := middleware.Chain(h,
+		middleware.Audit(refs, "get"),
+		middleware.ValidateToken(refs),
+		middleware.ParseJSONBody[keyedBody](refs),
+	)
+	req := httptest.NewRequest("POST", "/get", bytes.NewBufferString(`{"key":"prod/db"}`))
+	req.Header.Set("Authorization", "Bearer govault-id")
+	chain(httptest.NewRecorder(), req)
+	chain(httptest.NewRecorder(), httptest.NewRequest("POST", "/get", nil))
+
+	raw, _ := os.ReadFile(config.Audit.File)
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected two events, got %d", len(lines))
+	}
+	if !strings.Contains(lines[0], `"user":"bob"`) || !strings.Contains(lines[0], "hmac-sha256:") || strings.Contains(lines[0], "prod/db") {
+		t.Errorf("unexpected first event %s", lines[0])
+	}
+	if !strings.Contains(lines[0], `"result":"failure"`) || !strings.Contains(lines[1], `"result":"denied"`) {
+		t.Errorf("unexpected results %s", raw)
+	}
+	if strings.Contains(string(raw), "govault-id") {
+		t.Errorf("session token leaked into the audit log")
+	}
+}
@@ -2,10 +2,17 @@ package tests
 
 import (
 	"bytes"
+	"encoding/json"
+	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jdpolicano/govault/internal/server"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+	"github.com/jdpolicano/govault/internal/server/routes/login"
+	"github.com/jdpolicano/govault/internal/server/routes/register"
 )
 
 func TestValidateAuthRequest(t *testing.T) {
@@ -19,3 +26,95 @@ func TestValidateAuthRequest(t *testing.T) {
 		t.Errorf("unexpected credentials: %+v", cred)
 	}
 }
+
+func TestAuthenticate(t *testing.T) {
+	sessions := server.NewSessionMap()
+	sessions.Set("govault-live", server.NewSession("bob", []byte("key"), time.Minute))
+	sessions.Set("govault-stale", server.NewSession("bob", []byte("key"), -time.Minute))
+	sessions.Set("govault-zero", server.NewSession("bob", []byte("key"), 0))
+	sessions.Set("govault-empty", server.Session{})
+	auth := server.NewAuthenticator(sessions)
+
+	cases := []struct {
+		name      string
+		header    string
+		status    int
+		challenge string
+	}{
+		{"valid", "Bearer govault-live", 0, ""},
+		{"lowercase scheme", "bearer govault-live", 0, ""},
+		{"missing", "", http.StatusUnauthorized, `Bearer realm="govault"`},
+		{"wrong scheme", "Basic govault-live", http.StatusBadRequest, `error="invalid_request"`},
+		{"missing prefix", "Bearer live", http.StatusBadRequest, `error="invalid_request"`},
+		{"empty token", "Bearer govault-", http.StatusBadRequest, `error="invalid_request"`},
+		{"unknown", "Bearer govault-nope", http.StatusUnauthorized, `error="invalid_token"`},
+		{"expired", "Bearer govault-stale", http.StatusUnauthorized, `error="invalid_token"`},
+		{"zero ttl", "Bearer govault-zero", http.StatusUnauthorized, `error="invalid_token"`},
+		{"zero session", "Bearer govault-empty", http.StatusUnauthorized, `error="invalid_token"`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if c.header != "" {
+				req.Header.Set("Authorization", c.header)
+			}
+			sess, err := auth.Authenticate(req)
+			if c.status == 0 {
+				if err != nil || sess.User != "bob" {
+					t.Fatalf("expected session for bob, got %+v %v", sess, err)
+				}
+				return
+			}
+			authErr, ok := err.(*server.AuthError)
+			if !ok {
+				t.Fatalf("expected *AuthError, got %v", err)
+			}
+			if authErr.Status != c.status {
+				t.Errorf("expected status %d got %d", c.status, authErr.Status)
+			}
+			if !strings.Contains(authErr.Challenge(), c.challenge) {
+				t.Errorf("challenge %q does not contain %q", authErr.Challenge(), c.challenge)
+			}
+		})
+	}
+
+	if _, ok := sessions.Get("govault-stale"); ok {
+		t.Errorf("expected expired session to be evicted")
+	}
+}
+
+func TestValidateTokenChallenge(t *testing.T) {
+	refs := server.NewServerRefs(server.DefaultConfig())
+	rec := httptest.NewRecorder()
+	h := func(http.ResponseWriter, *http.Request) { t.Fatalf("handler should not be called") }
+
+	middleware.ValidateToken(refs)(h)(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 got %d", rec.Code)
+	}
+	if rec.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("expected WWW-Authenticate challenge")
+	}
+}
+
+func TestIssuedTokensAuthenticate(t *testing.T) {
+	refs := unsealedRefs(t, server.DefaultConfig())
+	credentials(register.Handler(refs), "bob", "hunter22")
+	rec := credentials(login.Handler(refs), "bob", "hunter22")
+	var res struct {
+		Data server.TokenSuccess `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("login failed: %d %s", rec.Code, rec.Body)
+	}
+	if !strings.HasPrefix(res.Data.Token, server.TokenPrefix) {
+		t.Fatalf("expected the issued token to carry the prefix, got %q", res.Data.Token)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+res.Data.Token)
+	if _, err := refs.Auth.Authenticate(req); err != nil {
+		t.Fatalf("expected the token from /login to authenticate as issued, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdpolicano/govault/internal/server"
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/server/routes/file"
+	"github.com/jdpolicano/govault/internal/server/routes/get"
+	"github.com/jdpolicano/govault/internal/server/routes/set"
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+// fileCall sends raw bytes to a file route with the query given.
+func fileCall(h http.HandlerFunc, token, query, contentType string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/?"+query, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+func TestFileSecrets(t *testing.T) {
+	config := server.DefaultConfig()
+	config.MaxSecretSize = 64
+	config.MaxFileSize = 128
+	refs := unsealedRefs(t, config)
+	bob := groupUser(t, refs, "bob")
+	upload, download := file.UploadHandler(refs), file.DownloadHandler(refs)
+
+	keystore := []byte{0x00, 0xff, 0x10, 'k', 'e', 'y', 0x80}
+	if rec := fileCall(upload, bob, "key=tls/keystore&mode=0640", "application/octet-stream", keystore); rec.Code != http.StatusOK {
+		t.Fatalf("upload failed: %d %s", rec.Code, rec.Body)
+	}
+	rec := fileCall(download, bob, "key=tls/keystore", "", nil)
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), keystore) || rec.Header().Get(file.ModeHeader) != "0640" {
+		t.Fatalf("unexpected download %d %q %v", rec.Code, rec.Body, rec.Header())
+	}
+	if rec.Header().Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("expected an octet stream, got %s", rec.Header().Get("Content-Type"))
+	}
+
+	// json reads get the bytes as base64 rather than mangled text.
+	_, res := groupCall(get.Handler(refs), bob, get.GetRequest{Key: "tls/keystore"})
+	if res.Data != base64.StdEncoding.EncodeToString(keystore) {
+		t.Errorf("expected the binary secret as base64, got %+v", res.Data)
+	}
+
+	if rec := fileCall(upload, bob, "key=big", "application/octet-stream", make([]byte, 129)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a file over the limit to be refused, got %d", rec.Code)
+	}
+	if code, _ := groupCall(set.Handler(refs), bob, set.SetRequest{Key: "big", Value: string(make([]byte, 65))}); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a value over the limit to be refused, got %d", code)
+	}
+	big := set.PatchRequest{Key: "obj", Fields: map[string]json.RawMessage{"f": json.RawMessage(`"` + string(bytes.Repeat([]byte("x"), 64)) + `"`)}}
+	if code, _ := groupCall(set.PatchHandler(refs), bob, big); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a patch over the limit to be refused, got %d", code)
+	}
+	if rec := fileCall(upload, bob, "key=k", "application/json", []byte("{}")); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected a json upload to be refused, got %d", rec.Code)
+	}
+	if rec := fileCall(upload, bob, "key=k&mode=4755", "application/octet-stream", []byte("x")); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a mode beyond permission bits to be refused, got %d", rec.Code)
+	}
+	if rec := fileCall(download, bob, "key=missing", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expected a missing file to be not found, got %d", rec.Code)
+	}
+}
+
+func TestLargeFileSecrets(t *testing.T) {
+	config := server.DefaultConfig()
+	refs := unsealedRefs(t, config)
+	bob := groupUser(t, refs, "bob")
+	upload, download := file.UploadHandler(refs), file.DownloadHandler(refs)
+	blobs := func() []string {
+		paths, _ := filepath.Glob(filepath.Join(config.VaultPath, "users", "*", "blobs", "*"))
+		return paths
+	}
+
+	// larger than a secret may be, and spread over several chunks.
+	image, _ := vault.GenerateRandBytes(int(config.MaxSecretSize) + 3*vault.StreamChunkSize + 17)
+	if rec := fileCall(upload, bob, "key=disk.img", "application/octet-stream", image); rec.Code != http.StatusOK {
+		t.Fatalf("upload failed: %d %s", rec.Code, rec.Body)
+	}
+	if paths := blobs(); len(paths) != 1 {
+		t.Fatalf("expected the file to be kept in one blob, got %v", paths)
+	}
+	if rec := fileCall(download, bob, "key=disk.img", "", nil); rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), image) {
+		t.Fatalf("unexpected download %d of %d bytes", rec.Code, rec.Body.Len())
+	}
+	if code, res := groupCall(get.Handler(refs), bob, get.GetRequest{Key: "disk.img"}); code != http.StatusUnprocessableEntity || res.Error != e.UseFileRoute.Error() {
+		t.Errorf("expected a json read of a large file to point to /file/get, got %d %+v", code, res)
+	}
+
+	// replacing the file removes the old blob, and a reload keeps the new one.
+	if rec := fileCall(upload, bob, "key=disk.img", "application/octet-stream", []byte("small")); rec.Code != http.StatusOK {
+		t.Fatalf("upload failed: %d %s", rec.Code, rec.Body)
+	}
+	os.WriteFile(filepath.Join(filepath.Dir(blobs()[0]), "stray"), []byte("left by a crash"), 0600)
+	refs.Store.Unload()
+	if err := refs.Store.Load(); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if paths := blobs(); len(paths) != 1 {
+		t.Fatalf("expected only the current blob to be kept, got %v", paths)
+	}
+	if rec := fileCall(download, bob, "key=disk.img", "", nil); rec.Body.String() != "small" {
+		t.Fatalf("unexpected download %d %q", rec.Code, rec.Body)
+	}
+	_, res := groupCall(get.Handler(refs), bob, get.GetRequest{Key: "disk.img"})
+	if res.Data != base64.StdEncoding.EncodeToString([]byte("small")) {
+		t.Errorf("expected a small streamed file to be read as json, got %+v", res.Data)
+	}
+
+	if err := refs.Store.Delete("bob", "disk.img"); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if paths := blobs(); len(paths) != 0 {
+		t.Errorf("expected deleting the secret to remove its blob, got %v", paths)
+	}
+}
+
+func TestStreamedUploadOverLimitLeavesNothing(t *testing.T) {
+	config := server.DefaultConfig()
+	config.MaxFileSize = 2 * vault.StreamChunkSize
+	refs := unsealedRefs(t, config)
+	bob := groupUser(t, refs, "bob")
+	body := make([]byte, config.MaxFileSize+1)
+	if rec := fileCall(file.UploadHandler(refs), bob, "key=big", "application/octet-stream", body); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected a file over the limit to be refused, got %d", rec.Code)
+	}
+	if _, exists := refs.Store.Get("bob", "big"); exists {
+		t.Errorf("expected nothing to be stored")
+	}
+	if paths, _ := filepath.Glob(filepath.Join(config.VaultPath, "users", "*", "blobs", "*")); len(paths) != 0 {
+		t.Errorf("expected no blob to be left behind, got %v", paths)
+	}
+}
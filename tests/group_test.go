@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/server"
+	"github.com/jdpolicano/govault/internal/server/routes/group"
+	"github.com/jdpolicano/govault/internal/store"
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+func TestWrapForRecipient(t *testing.T) {
+	private, public, err := vault.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair returned error: %v", err)
+	}
+	key := []byte("0123456789abcdef0123456789abcdef")
+	wrapped, err := vault.WrapForRecipient(public, key)
+	if err != nil {
+		t.Fatalf("WrapForRecipient returned error: %v", err)
+	}
+	got, err := vault.UnwrapWithPrivate(private, wrapped)
+	if err != nil || !bytes.Equal(got, key) {
+		t.Fatalf("expected the key back, got %q %v", got, err)
+	}
+	other, _, _ := vault.GenerateKeyPair()
+	if _, err := vault.UnwrapWithPrivate(other, wrapped); err == nil {
+		t.Fatalf("expected another private key to fail")
+	}
+}
+
+// groupUser adds a user with a key pair and returns a session token for them.
+func groupUser(t *testing.T, refs *server.ServerRefs, name string) string {
+	t.Helper()
+	key := []byte(name + "-0123456789abcdef0123456789abcdef")[:32]
+	refs.Store.AddUser(name, []byte("login"), []byte("salt"))
+	user, _ := refs.Store.GetUserInfo(name)
+	if err := refs.EnsureKeyPair(&user, key); err != nil {
+		t.Fatalf("EnsureKeyPair returned error: %v", err)
+	}
+	token, err := refs.Sessions.CreateSession(server.NewSession(name, key, time.Minute))
+	if err != nil {
+		t.Fatalf("CreateSession returned error: %v", err)
+	}
+	return token
+}
+
+func groupCall(h http.HandlerFunc, token string, body any) (int, server.Response) {
+	raw, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(raw))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	var res server.Response
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	return rec.Code, res
+}
+
+func TestGroupMembership(t *testing.T) {
+	config := server.DefaultConfig()
+	refs := unsealedRefs(t, config)
+	alice, bob := groupUser(t, refs, "alice"), groupUser(t, refs, "bob")
+	get, set := group.GetHandler(refs), group.SetHandler(refs)
+
+	if code, res := groupCall(group.CreateHandler(refs), alice, group.CreateRequest{Group: "ops"}); code != http.StatusOK {
+		t.Fatalf("create failed: %d %+v", code, res)
+	}
+	groupCall(set, alice, group.SetRequest{Group: "ops", Key: "db", Value: "hunter2"})
+	if code, _ := groupCall(get, bob, group.GetRequest{Group: "ops", Key: "db"}); code != http.StatusNotFound {
+		t.Fatalf("expected outsiders to be refused, got %d", code)
+	}
+	if code, _ := groupCall(group.AddMemberHandler(refs), bob, group.MemberRequest{Group: "ops", User: "bob"}); code != http.StatusNotFound {
+		t.Fatalf("expected outsiders not to add themselves, got %d", code)
+	}
+	if code, res := groupCall(group.AddMemberHandler(refs), alice, group.MemberRequest{Group: "ops", User: "bob"}); code != http.StatusOK {
+		t.Fatalf("add member failed: %d %+v", code, res)
+	}
+	if code, res := groupCall(get, bob, group.GetRequest{Group: "ops", Key: "db"}); code != http.StatusOK || res.Data != "hunter2" {
+		t.Fatalf("expected bob to read the secret, got %d %+v", code, res)
+	}
+	if code, _ := groupCall(group.RemoveMemberHandler(refs), bob, group.MemberRequest{Group: "ops", User: "alice"}); code != http.StatusForbidden {
+		t.Fatalf("expected members to need admin to remove others, got %d", code)
+	}
+
+	// keep bob's copy of the group key to show it is useless after removal.
+	g, _ := refs.Store.GetGroup("ops")
+	bobUser, _ := refs.Store.GetUserInfo("bob")
+	sess, _ := refs.Sessions.Get(bob)
+	oldKey, err := server.OpenGroupKey(g, bobUser, sess.Key)
+	if err != nil {
+		t.Fatalf("OpenGroupKey returned error: %v", err)
+	}
+	if code, res := groupCall(group.RemoveMemberHandler(refs), alice, group.MemberRequest{Group: "ops", User: "bob"}); code != http.StatusOK {
+		t.Fatalf("remove member failed: %d %+v", code, res)
+	}
+	g, _ = refs.Store.GetGroup("ops")
+	if g.Epoch != 1 {
+		t.Errorf("expected the key to be rotated, got epoch %d", g.Epoch)
+	}
+	if _, err := vault.Decrypt(g.Secrets["db"].Nonce, oldKey, g.Secrets["db"].Text); err == nil {
+		t.Errorf("expected the old group key to no longer open secrets")
+	}
+	if code, res := groupCall(get, alice, group.GetRequest{Group: "ops", Key: "db"}); code != http.StatusOK || res.Data != "hunter2" {
+		t.Fatalf("expected alice to still read the secret, got %d %+v", code, res)
+	}
+	if code, _ := groupCall(get, bob, group.GetRequest{Group: "ops", Key: "db"}); code != http.StatusNotFound {
+		t.Fatalf("expected bob to be refused after removal, got %d", code)
+	}
+}
+
+func TestGroupLastAdmin(t *testing.T) {
+	refs := unsealedRefs(t, server.DefaultConfig())
+	alice := groupUser(t, refs, "alice")
+	groupUser(t, refs, "bob")
+	groupCall(group.CreateHandler(refs), alice, group.CreateRequest{Group: "ops"})
+	groupCall(group.AddMemberHandler(refs), alice, group.MemberRequest{Group: "ops", User: "bob"})
+	if code, _ := groupCall(group.RemoveMemberHandler(refs), alice, group.MemberRequest{Group: "ops", User: "alice"}); code != http.StatusBadRequest {
+		t.Fatalf("expected the last admin not to leave members behind, got %d", code)
+	}
+}
+
+func TestGroupStaleWrites(t *testing.T) {
+	refs := unsealedRefs(t, server.DefaultConfig())
+	alice := groupUser(t, refs, "alice")
+	groupCall(group.CreateHandler(refs), alice, group.CreateRequest{Group: "ops"})
+	stale, _ := refs.Store.GetGroup("ops")
+	fresh := stale
+	fresh.Epoch++
+	if err := refs.Store.UpdateGroup(fresh); err != nil {
+		t.Fatalf("UpdateGroup returned error: %v", err)
+	}
+	if err := refs.Store.UpdateGroup(stale); !errors.Is(err, store.ErrGroupChanged) {
+		t.Errorf("expected an update from a stale read to be refused, got %v", err)
+	}
+	if err := refs.Store.SetGroupSecret("ops", stale.Epoch, "db", store.CipherText{}); !errors.Is(err, store.ErrGroupChanged) {
+		t.Errorf("expected a write under a replaced key to be refused, got %v", err)
+	}
+}
+
+func TestGroupPersists(t *testing.T) {
+	config := server.DefaultConfig()
+	refs := unsealedRefs(t, config)
+	alice := groupUser(t, refs, "alice")
+	groupCall(group.CreateHandler(refs), alice, group.CreateRequest{Group: "ops"})
+	groupCall(group.SetHandler(refs), alice, group.SetRequest{Group: "ops", Key: "db", Value: "hunter2"})
+
+	refs.Store.Unload()
+	if err := refs.Store.Load(); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if code, res := groupCall(group.GetHandler(refs), alice, group.GetRequest{Group: "ops", Key: "db"}); code != http.StatusOK || res.Data != "hunter2" {
+		t.Fatalf("expected the group secret to survive a reload, got %d %+v", code, res)
+	}
+	if groups := refs.Store.ListGroups("alice"); len(groups) != 1 {
+		t.Errorf("expected alice to belong to one group, got %d", len(groups))
+	}
+}
+
+func TestGroupNameValidated(t *testing.T) {
+	config := server.DefaultConfig()
+	refs := unsealedRefs(t, config)
+	alice := groupUser(t, refs, "alice")
+	for _, name := range []string{"../ops", "ops/prod", "Ops", ".ops"} {
+		if code, res := groupCall(group.CreateHandler(refs), alice, group.CreateRequest{Group: name}); code != http.StatusBadRequest {
+			t.Errorf("expected %q to be refused, got %d %+v", name, code, res)
+		}
+	}
+}
@@ -30,14 +30,16 @@ func TestJSONStoreUserLifecycle(t *testing.T) {
 		t.Fatalf("GetUserInfo returned wrong user")
 	}
 
-	// check file exists
-	path := filepath.Join(dir, "bob", "secrets.json")
-	if _, err := os.Stat(path); err != nil {
-		t.Errorf("expected user file to exist: %v", err)
+	// check file exists, under a directory that isn't the user's name
+	if paths, _ := filepath.Glob(filepath.Join(dir, "users", "*", "record")); len(paths) != 1 {
+		t.Errorf("expected one user record, got %v", paths)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bob")); !os.IsNotExist(err) {
+		t.Errorf("expected no directory named for the user")
 	}
 
 	// test Set and Get
-	err = js.Set("bob", "key", store.CipherText{Nonce: []byte("n"), Text: []byte("c")})
+	err = js.Set("bob", "key", store.CipherText{Nonce: []byte("n"), Text: []byte("c")}, store.Metadata{})
 	if err != nil {
 		t.Fatalf("Set returned error: %v", err)
 	}
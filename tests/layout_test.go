@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jdpolicano/govault/internal/server"
+	"github.com/jdpolicano/govault/internal/store"
+)
+
+func TestJSONStoreNamesStayInVault(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "vault")
+	js := store.NewJSONStore(dir)
+	for _, name := range []string{"../../escape", "/etc/passwd", "a/b"} {
+		if err := js.AddUser(name, []byte("login"), []byte("salt")); err != nil {
+			t.Fatalf("AddUser(%q) returned error: %v", name, err)
+		}
+	}
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if !d.IsDir() && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			t.Errorf("expected every file inside the vault path, found %s", path)
+		}
+		return nil
+	})
+
+	reloaded := store.NewJSONStore(dir)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if !reloaded.HasUser("../../escape") || !reloaded.HasUser("a/b") {
+		t.Errorf("expected the users to survive a reload")
+	}
+}
+
+// writeJSON lays a record out by hand, the way an older store left it.
+func writeJSON(t *testing.T, path string, v any) {
+	t.Helper()
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Dir(path), 0700)
+	if err := os.WriteFile(path, bytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadMigratesNamedLayout(t *testing.T) {
+	dir := t.TempDir()
+	writeJSON(t, filepath.Join(dir, "bob", "secrets.json"), store.NewJSONRecord(store.User{Name: "bob"}))
+	writeJSON(t, filepath.Join(dir, "groups", "ops", "group.json"), store.Group{Name: "ops"})
+	writeJSON(t, filepath.Join(dir, "policies", "ci", "policy.json"), store.Policy{Name: "ci"})
+	// something else kept beside a legacy record must survive the move.
+	os.WriteFile(filepath.Join(dir, "bob", "notes"), []byte("keep"), 0600)
+
+	js := store.NewJSONStore(dir)
+	if err := js.Load(); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if !js.HasUser("bob") {
+		t.Errorf("expected the user to be loaded")
+	}
+	if _, ok := js.GetGroup("ops"); !ok {
+		t.Errorf("expected the group to be loaded")
+	}
+	if _, ok := js.GetPolicy("ci"); !ok {
+		t.Errorf("expected the policy to be loaded")
+	}
+	for _, old := range []string{"bob/secrets.json", "groups/ops", "policies/ci"} {
+		if _, err := os.Stat(filepath.Join(dir, old)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be moved", old)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bob", "notes")); err != nil {
+		t.Errorf("expected unrelated files to be left alone: %v", err)
+	}
+	for _, kind := range []string{"users", "groups", "policies"} {
+		if moved, _ := filepath.Glob(filepath.Join(dir, kind, "*", "record")); len(moved) != 1 {
+			t.Errorf("expected one %s record in the new layout, got %v", kind, moved)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "manifest.json")); err != nil {
+		t.Errorf("expected a manifest to be written: %v", err)
+	}
+
+	reloaded := store.NewJSONStore(dir)
+	if err := reloaded.Load(); err != nil || !reloaded.HasUser("bob") {
+		t.Fatalf("expected the migrated store to load, got %v", err)
+	}
+}
+
+func TestUnsealMigratesNamedLayout(t *testing.T) {
+	config := server.DefaultConfig()
+	config.VaultPath = t.TempDir()
+	dir := config.VaultPath
+	writeJSON(t, filepath.Join(dir, "bob", "secrets.json"), store.NewJSONRecord(store.User{Name: "bob"}))
+	writeJSON(t, filepath.Join(dir, "groups", "ops", "group.json"), store.Group{Name: "ops"})
+	writeJSON(t, filepath.Join(dir, "policies", "ci", "policy.json"), store.Policy{Name: "ci"})
+	os.WriteFile(filepath.Join(dir, "bob", "notes"), []byte("keep"), 0600)
+
+	refs := unsealedRefs(t, config)
+	if !refs.Store.HasUser("bob") {
+		t.Errorf("expected the user to be loaded")
+	}
+	if _, ok := refs.Store.GetGroup("ops"); !ok {
+		t.Errorf("expected the group to be loaded")
+	}
+	if _, ok := refs.Store.GetPolicy("ci"); !ok {
+		t.Errorf("expected the policy to be loaded")
+	}
+	for _, old := range []string{"bob/secrets.json", "groups/ops", "policies/ci"} {
+		if _, err := os.Stat(filepath.Join(dir, old)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be moved", old)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bob", "notes")); err != nil {
+		t.Errorf("expected unrelated files to be left alone: %v", err)
+	}
+	for _, kind := range []string{"users", "groups", "policies"} {
+		moved, _ := filepath.Glob(filepath.Join(dir, kind, "*", "record"))
+		if len(moved) != 1 {
+			t.Fatalf("expected one %s record in the new layout, got %v", kind, moved)
+		}
+		raw, _ := os.ReadFile(moved[0])
+		if plain, err := refs.Barrier.Decrypt(raw); err != nil || json.Valid(raw) || !json.Valid(plain) {
+			t.Errorf("expected the %s record to be encrypted by the barrier, got %q %v", kind, raw, err)
+		}
+	}
+	var m struct {
+		Layout    int  `json:"layout"`
+		Encrypted bool `json:"encrypted"`
+	}
+	raw, _ := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err := json.Unmarshal(raw, &m); err != nil || m.Layout != 2 || !m.Encrypted {
+		t.Errorf("expected an encrypted layout 2 manifest, got %s %v", raw, err)
+	}
+}
+
+func TestLoadRefusesUnknownLayout(t *testing.T) {
+	dir := t.TempDir()
+	writeJSON(t, filepath.Join(dir, "manifest.json"), map[string]any{"layout": 99})
+	if err := store.NewJSONStore(dir).Load(); !errors.Is(err, store.ErrUnknownLayout) {
+		t.Errorf("expected a newer layout to be refused, got %v", err)
+	}
+
+	dir = t.TempDir()
+	writeJSON(t, filepath.Join(dir, "manifest.json"), map[string]any{"layout": 2, "encrypted": true})
+	if err := store.NewJSONStore(dir).Load(); !errors.Is(err, store.ErrUnknownLayout) {
+		t.Errorf("expected an encrypted layout to be refused by a plain store, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/server"
+	"github.com/jdpolicano/govault/internal/server/routes/login"
+)
+
+func testPolicy() server.LockoutPolicy {
+	return server.LockoutPolicy{
+		UserThreshold: 2,
+		AddrThreshold: 10,
+		BaseDelay:     time.Second,
+		MaxDelay:      4 * time.Second,
+		Window:        time.Minute,
+	}
+}
+
+func TestLoginGuardBackoff(t *testing.T) {
+	g := server.NewLoginGuard(testPolicy(), 16)
+	g.Fail("bob", "1.2.3.4")
+	if wait := g.Check("bob", "1.2.3.4"); wait != 0 {
+		t.Fatalf("expected no lockout below threshold, got %v", wait)
+	}
+	g.Fail("bob", "1.2.3.4")
+	first := g.Check("bob", "5.6.7.8")
+	if first <= 0 || first > time.Second {
+		t.Fatalf("expected a lockout of about a second, got %v", first)
+	}
+	for i := 0; i < 5; i++ {
+		g.Fail("bob", "1.2.3.4")
+	}
+	if wait := g.Check("bob", "5.6.7.8"); wait <= 2*time.Second || wait > 4*time.Second {
+		t.Fatalf("expected backoff to grow and cap at the max delay, got %v", wait)
+	}
+
+	snap := g.Snapshot()
+	if len(snap) != 2 || snap[0].Kind != "user" || snap[0].Failures != 7 || snap[0].LockedUntil.IsZero() {
+		t.Fatalf("unexpected snapshot %+v", snap)
+	}
+	if !g.Clear("user", "bob") || g.Check("bob", "5.6.7.8") != 0 {
+		t.Fatalf("expected clear to lift the lockout")
+	}
+}
+
+func TestLoginGuardBoundsAttemptsInFlight(t *testing.T) {
+	g := server.NewLoginGuard(testPolicy(), 16)
+	// guesses made at once all pass the check before any of them fails.
+	for i := 0; i < 2; i++ {
+		if wait := g.Check("bob", "1.2.3.4"); wait != 0 {
+			t.Fatalf("expected attempt %d to proceed, got %v", i, wait)
+		}
+	}
+	if wait := g.Check("bob", "5.6.7.8"); wait <= 0 {
+		t.Fatalf("expected an attempt past the threshold to wait while others are in flight")
+	}
+	g.Release("bob", "1.2.3.4")
+	if wait := g.Check("bob", "5.6.7.8"); wait != 0 {
+		t.Fatalf("expected a released attempt to make room, got %v", wait)
+	}
+	g.Fail("bob", "1.2.3.4")
+	g.Fail("bob", "5.6.7.8")
+	if wait := g.Check("bob", "5.6.7.8"); wait <= 0 {
+		t.Fatalf("expected the account to be locked once the attempts failed")
+	}
+	if snap := g.Snapshot(); len(snap) != 3 || snap[0].Failures != 2 {
+		t.Fatalf("unexpected snapshot %+v", snap)
+	}
+}
+
+func TestLoginSuccessKeepsAddressFailures(t *testing.T) {
+	policy := testPolicy()
+	policy.AddrThreshold = 3
+	g := server.NewLoginGuard(policy, 16)
+	// guesses spread over many accounts, with a login to the attacker's own
+	// account in between each.
+	for _, user := range []string{"alice", "carol", "dave"} {
+		g.Fail(user, "1.2.3.4")
+		g.Succeed("mallory", "1.2.3.4")
+	}
+	if wait := g.Check("erin", "1.2.3.4"); wait <= 0 {
+		t.Fatalf("expected the address to stay locked out, got %v", wait)
+	}
+	g.Fail("bob", "5.6.7.8")
+	g.Succeed("bob", "5.6.7.8")
+	if snap := g.Snapshot(); len(snap) != 5 || slices.ContainsFunc(snap, func(s server.LockoutStatus) bool { return s.Name == "bob" }) {
+		t.Fatalf("expected a success to clear the account only, got %+v", snap)
+	}
+}
+
+func TestLoginUniformAndLocked(t *testing.T) {
+	config := server.DefaultConfig()
+	config.VaultPath = t.TempDir()
+	config.Lockout = testPolicy()
+	refs := unsealedRefs(t, config)
+	if err := refs.Store.AddUser("bob", []byte("login"), []byte("salt")); err != nil {
+		t.Fatalf("AddUser returned error: %v", err)
+	}
+	h := login.Handler(refs)
+
+	attempt := func(user string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(server.AuthCredentials{Username: user, Password: "wrong"})
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("POST", "/login", bytes.NewReader(body)))
+		return rec
+	}
+
+	known, unknown := attempt("bob"), attempt("nobody")
+	if known.Code != unknown.Code || known.Body.String() != unknown.Body.String() {
+		t.Fatalf("responses differ: %d %q vs %d %q", known.Code, known.Body, unknown.Code, unknown.Body)
+	}
+
+	attempt("bob")
+	locked := attempt("bob")
+	if locked.Code != http.StatusTooManyRequests || locked.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected lockout with Retry-After, got %d", locked.Code)
+	}
+}
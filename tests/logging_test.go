@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jdpolicano/govault/internal/server"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+)
+
+func TestLoggerRedactsSecrets(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := server.NewLogger(buf, server.LogConfig{Format: "json", Level: slog.LevelDebug})
+	logger.Info("attempt",
+		"user", "bob",
+		"password", "hunter2",
+		slog.Group("body", "value", "s3cret"),
+		"note", server.Redacted("tok3n"),
+		"key", []byte("raw key"),
+	)
+	out := buf.String()
+	for _, leaked := range []string{"hunter2", "s3cret", "tok3n", "raw key", "cmF3IGtleQ"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("log line leaked %q: %s", leaked, out)
+		}
+	}
+	if !strings.Contains(out, `"user":"bob"`) {
+		t.Errorf("expected non sensitive attributes to be kept: %s", out)
+	}
+}
+
+func TestRequestIDPropagates(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := server.NewLogger(buf, server.LogConfig{Format: "json"})
+	var seen string
+	h := func(w http.ResponseWriter, r *http.Request) {
+		seen = server.RequestID(r.Context())
+		logger.InfoContext(r.Context(), "handled")
+	}
+	chain := middleware.Chain(h, middleware.RequestID(), middleware.Logging(logger))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	rec := httptest.NewRecorder()
+	chain(rec, req)
+	if seen != "abc-123" || rec.Header().Get("X-Request-ID") != "abc-123" {
+		t.Fatalf("expected the client id to be kept, got %q %q", seen, rec.Header().Get("X-Request-ID"))
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log line %q", line)
+		}
+		if entry["request_id"] != "abc-123" {
+			t.Errorf("log line missing request id: %s", line)
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "bad id\nwith newline")
+	rec = httptest.NewRecorder()
+	chain(rec, req)
+	if id := rec.Header().Get("X-Request-ID"); id == "" || strings.Contains(id, " ") {
+		t.Errorf("expected a generated id, got %q", id)
+	}
+}
+
+func TestRequestIDMissingContext(t *testing.T) {
+	if id := server.RequestID(context.Background()); id != "" {
+		t.Errorf("expected no request id, got %q", id)
+	}
+}
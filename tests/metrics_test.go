@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/metrics"
+	"github.com/jdpolicano/govault/internal/server"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+	"github.com/jdpolicano/govault/internal/server/routes/sys"
+	"github.com/jdpolicano/govault/internal/store"
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+func scrape(t *testing.T, reg *metrics.Registry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	reg.Expose(&buf)
+	return buf.String()
+}
+
+func TestRegistryExposition(t *testing.T) {
+	reg := metrics.NewRegistry()
+	c := reg.Counter("test_total", "A counter.", "route")
+	c.Inc("/a")
+	c.Add(2, `/b"\`)
+	h := reg.Histogram("test_seconds", "A histogram.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/a")
+	h.Observe(0.5, "/a")
+	reg.GaugeFunc("test_gauge", "A gauge.", func() float64 { return 7 })
+
+	out := scrape(t, reg)
+	for _, want := range []string{
+		"# TYPE test_total counter",
+		`test_total{route="/a"} 1`,
+		`test_total{route="/b\"\\"} 2`,
+		"# TYPE test_seconds histogram",
+		`test_seconds_bucket{route="/a",le="0.1"} 1`,
+		`test_seconds_bucket{route="/a",le="1"} 2`,
+		`test_seconds_bucket{route="/a",le="+Inf"} 2`,
+		`test_seconds_count{route="/a"} 2`,
+		"test_gauge 7",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestInstrumentUsesRoutePattern(t *testing.T) {
+	refs := server.NewServerRefs(server.DefaultConfig())
+	mux := http.NewServeMux()
+	mux.HandleFunc("/get", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	h := middleware.Chain(mux.ServeHTTP, middleware.Instrument(refs, mux))
+
+	h(httptest.NewRecorder(), httptest.NewRequest("POST", "/get", nil))
+	h(httptest.NewRecorder(), httptest.NewRequest("POST", "/no/such/path", nil))
+
+	out := scrape(t, refs.Metrics.Registry)
+	for _, want := range []string{
+		`govault_http_requests_total{route="/get",code="403"} 1`,
+		`govault_http_requests_total{route="unmatched",code="404"} 1`,
+		"govault_sessions_active 0",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "/no/such/path") {
+		t.Fatalf("raw path leaked into labels")
+	}
+}
+
+func TestKDFObserver(t *testing.T) {
+	s := vault.NewKDFScheduler(1, 0, time.Second)
+	var mu sync.Mutex
+	var results []string
+	s.SetObserver(func(result string, took time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, result)
+	})
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go s.Do(context.Background(), func() { close(started); <-release })
+	<-started
+	if err := s.Do(context.Background(), func() {}); !errors.Is(err, vault.ErrKDFSaturated) {
+		t.Fatalf("expected saturation, got %v", err)
+	}
+	close(release)
+	for s.Running() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(results) != 2 || results[0] != vault.KDFResultSaturated || results[1] != vault.KDFResultOK {
+		t.Fatalf("unexpected results %v", results)
+	}
+}
+
+func TestStoreMetrics(t *testing.T) {
+	config := server.DefaultConfig()
+	config.VaultPath = t.TempDir()
+	refs := server.NewServerRefs(config)
+	refs.Store.GetUserInfo("nobody")
+	refs.Store.Set("nobody", "k", store.CipherText{}, store.Metadata{})
+
+	out := scrape(t, refs.Metrics.Registry)
+	for _, want := range []string{
+		`govault_store_operation_duration_seconds_count{op="get_user"} 1`,
+		`govault_store_operation_duration_seconds_count{op="set"} 1`,
+		`govault_store_errors_total{op="set"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestMetricsNeedToken(t *testing.T) {
+	config := server.DefaultConfig()
+	config.Audit.File = filepath.Join(t.TempDir(), "audit.log")
+	config.Audit.ChainKey = chainKey
+	refs := server.NewServerRefs(config)
+	if err := refs.OpenAudit(); err != nil {
+		t.Fatalf("OpenAudit returned error: %v", err)
+	}
+	defer refs.Audit.Close()
+
+	fetch := func(token string) (int, string) {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		sys.MetricsHandler(refs)(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+
+	if code, body := fetch(""); code != http.StatusNotFound || strings.Contains(body, "audit.log") {
+		t.Fatalf("expected metrics to be off without a token, got %d %s", code, body)
+	}
+	config.MetricsToken = "scrape-me"
+	if code, body := fetch("guess"); code != http.StatusUnauthorized || strings.Contains(body, "audit.log") {
+		t.Fatalf("expected a wrong token to be refused, got %d %s", code, body)
+	}
+	if code, body := fetch("scrape-me"); code != http.StatusOK || !strings.Contains(body, "govault_audit_sink_failures_total") {
+		t.Fatalf("expected the metrics for the right token, got %d %s", code, body)
+	}
+}
@@ -2,9 +2,10 @@ package tests
 
 import (
 	"bytes"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -41,9 +42,9 @@ func TestChainOrder(t *testing.T) {
 }
 
 func TestValidateToken(t *testing.T) {
-	ctx := server.NewContext(server.DefaultConfig())
+	ctx := server.NewServerRefs(server.DefaultConfig())
 	sess := server.NewSession("bob", []byte("key"), time.Minute)
-	ctx.Sessions.Set("id", sess)
+	ctx.Sessions.Set("govault-id", sess)
 
 	req := httptest.NewRequest("GET", "/", nil)
 	req.Header.Set("Authorization", "Bearer govault-id")
@@ -76,15 +77,30 @@ func TestParseJSONBody(t *testing.T) {
 		}
 	}
 
-	middleware.ParseJSONBody[testBody]()(h)(httptest.NewRecorder(), req)
+	refs := server.NewServerRefs(server.DefaultConfig())
+	middleware.ParseJSONBody[testBody](refs)(h)(httptest.NewRecorder(), req)
 	if !called {
 		t.Fatalf("handler not called")
 	}
 }
 
+func TestParseJSONBodyLimit(t *testing.T) {
+	config := server.DefaultConfig()
+	config.MaxSecretSize = 16
+	refs := server.NewServerRefs(config)
+	h := func(w http.ResponseWriter, r *http.Request) { t.Fatalf("handler should not be called") }
+
+	big := `{"name":"` + strings.Repeat("a", int(config.MaxBodySize())) + `"}`
+	rec := httptest.NewRecorder()
+	middleware.ParseJSONBody[testBody](refs)(h)(rec, httptest.NewRequest("POST", "/", strings.NewReader(big)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected an oversized body to be refused with 413, got %d", rec.Code)
+	}
+}
+
 func TestLogging(t *testing.T) {
 	buf := &bytes.Buffer{}
-	logger := log.New(buf, "", 0)
+	logger := slog.New(slog.NewTextHandler(buf, nil))
 
 	h := func(http.ResponseWriter, *http.Request) {}
 	middleware.Logging(logger)(h)(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
@@ -0,0 +1,223 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/jdpolicano/govault/internal/server"
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/server/routes/admin"
+	"github.com/jdpolicano/govault/internal/server/routes/approle"
+	"github.com/jdpolicano/govault/internal/server/routes/group"
+	"github.com/jdpolicano/govault/internal/server/routes/policy"
+	"github.com/jdpolicano/govault/internal/server/routes/set"
+	"github.com/jdpolicano/govault/internal/server/routes/token"
+	"github.com/jdpolicano/govault/internal/store"
+)
+
+var ciRead = store.Policy{Name: "ci-read", Rules: []store.PolicyRule{
+	{Path: "secret/ci/*", Capabilities: []string{"read"}},
+}}
+
+func TestValidatePolicy(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy store.Policy
+		err    error
+	}{
+		{"valid", ciRead, nil},
+		{"builtin", store.Policy{Name: server.RootPolicy, Rules: ciRead.Rules}, e.BuiltinPolicy},
+		{"no rules", store.Policy{Name: "empty"}, e.InvalidPolicy},
+		{"unsafe name", store.Policy{Name: "../x", Rules: ciRead.Rules}, e.InvalidPolicy},
+		{"unknown capability", store.Policy{Name: "x", Rules: []store.PolicyRule{{Path: "*", Capabilities: []string{"sudo"}}}}, e.InvalidPolicy},
+	}
+	for _, c := range cases {
+		if err := server.ValidatePolicy(c.policy); !errors.Is(err, c.err) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	config := server.DefaultConfig()
+	config.Admins = []string{"root"}
+	refs := unsealedRefs(t, config)
+	groupUser(t, refs, "bob")
+	bob := server.Session{User: "bob"}
+
+	if d := refs.Explain(bob, server.CapWrite, "secret/prod/db"); !d.Allowed || d.Policies[0] != server.DefaultPolicy {
+		t.Errorf("expected the default policy to allow writes, got %+v", d)
+	}
+	if d := refs.Explain(bob, server.CapAdmin, "sys/seal"); d.Allowed || len(d.Matches) != 0 {
+		t.Errorf("expected admin to be denied with nothing matching, got %+v", d)
+	}
+	if d := refs.Explain(server.Session{User: "root"}, server.CapAdmin, "sys/seal"); !d.Allowed {
+		t.Errorf("expected configured admins to be granted root, got %+v", d)
+	}
+
+	refs.Store.SetPolicy(ciRead)
+	user, _ := refs.Store.GetUserInfo("bob")
+	user.Policies = []string{"ci-read", "gone"}
+	refs.Store.UpdateUser(user)
+	if d := refs.Explain(bob, server.CapRead, "secret/ci/token"); !d.Allowed {
+		t.Errorf("expected ci-read to allow reads, got %+v", d)
+	}
+	d := refs.Explain(bob, server.CapWrite, "secret/ci/token")
+	if d.Allowed || len(d.Matches) != 1 || len(d.Missing) != 1 || d.Missing[0] != "gone" {
+		t.Errorf("expected a matching rule without write and a missing policy, got %+v", d)
+	}
+	if d := refs.Explain(bob, server.CapRead, "secret/prod/db"); d.Allowed {
+		t.Errorf("expected attached policies to replace the default, got %+v", d)
+	}
+}
+
+func TestPolicyDeniesRoute(t *testing.T) {
+	refs := unsealedRefs(t, server.DefaultConfig())
+	bob := groupUser(t, refs, "bob")
+	refs.Store.SetPolicy(ciRead)
+	user, _ := refs.Store.GetUserInfo("bob")
+	user.Policies = []string{"ci-read"}
+	refs.Store.UpdateUser(user)
+
+	code, res := groupCall(set.Handler(refs), bob, set.SetRequest{Key: "ci/token", Value: "x"})
+	if code != http.StatusForbidden || res.Error != e.PolicyDenied.Error() {
+		t.Fatalf("expected the write to be denied by policy, got %d %+v", code, res)
+	}
+
+	// policies attached to a group apply to its members.
+	groupCall(group.CreateHandler(refs), bob, group.CreateRequest{Group: "ci"})
+	writer := store.Policy{Name: "ci-write", Rules: []store.PolicyRule{{Path: "secret/ci/*", Capabilities: []string{"write"}}}}
+	refs.Store.SetPolicy(writer)
+	g, _ := refs.Store.GetGroup("ci")
+	g.Policies = []string{"ci-write"}
+	refs.Store.UpdateGroup(g)
+	if code, res := groupCall(set.Handler(refs), bob, set.SetRequest{Key: "ci/token", Value: "x"}); code != http.StatusOK {
+		t.Fatalf("expected the group's policy to allow the write, got %d %+v", code, res)
+	}
+}
+
+func TestAdminByPolicy(t *testing.T) {
+	refs := unsealedRefs(t, server.DefaultConfig())
+	bob := groupUser(t, refs, "bob")
+	lockouts := func() int {
+		req := httptest.NewRequest("GET", "/v1/admin/lockouts", nil)
+		req.Header.Set("Authorization", "Bearer "+bob)
+		rec := httptest.NewRecorder()
+		admin.LockoutsHandler(refs)(rec, req)
+		return rec.Code
+	}
+	if code := lockouts(); code != http.StatusForbidden {
+		t.Fatalf("expected non-admins to be refused, got %d", code)
+	}
+	refs.Store.SetPolicy(store.Policy{Name: "ops", Rules: []store.PolicyRule{{Path: "sys/admin/*", Capabilities: []string{"admin"}}}})
+	user, _ := refs.Store.GetUserInfo("bob")
+	user.Policies = []string{server.DefaultPolicy, "ops"}
+	refs.Store.UpdateUser(user)
+	if code := lockouts(); code != http.StatusOK {
+		t.Fatalf("expected a policy granting admin to admit bob, got %d", code)
+	}
+}
+
+func TestExplainHandler(t *testing.T) {
+	config := server.DefaultConfig()
+	config.Admins = []string{"root"}
+	refs := unsealedRefs(t, config)
+	bob, root := groupUser(t, refs, "bob"), groupUser(t, refs, "root")
+	explain := policy.ExplainHandler(refs)
+
+	code, _ := groupCall(explain, bob, policy.ExplainRequest{User: "root", Capability: server.CapRead, Path: "secret/x"})
+	if code != http.StatusForbidden {
+		t.Fatalf("expected explaining another user to need admin, got %d", code)
+	}
+	code, res := groupCall(explain, root, policy.ExplainRequest{User: "bob", Capability: server.CapAdmin, Path: "sys/seal"})
+	if code != http.StatusOK || res.Data.(map[string]any)["allowed"] != false {
+		t.Fatalf("expected an explanation of bob's denial, got %d %+v", code, res)
+	}
+}
+
+func TestPolicyLimitedTokens(t *testing.T) {
+	refs := unsealedRefs(t, server.DefaultConfig())
+	groupUser(t, refs, "bob")
+	bob := server.Session{User: "bob"}
+	if _, err := refs.LimitPolicies(bob, []string{server.RootPolicy}); !errors.Is(err, e.ScopeEscalation) {
+		t.Fatalf("expected a token to be refused policies bob lacks, got %v", err)
+	}
+	parent := server.Scope{Policies: []string{server.DefaultPolicy}}
+	child, err := parent.Narrow(server.Scope{ReadOnly: true})
+	if err != nil || len(child.Policies) != 1 {
+		t.Fatalf("expected child tokens to inherit policies, got %+v %v", child, err)
+	}
+	if _, err := parent.Narrow(server.Scope{Policies: []string{"ci-read"}}); !errors.Is(err, e.ScopeEscalation) {
+		t.Fatalf("expected child tokens not to add policies, got %v", err)
+	}
+}
+
+func TestDerivedIdentitiesKeepPolicies(t *testing.T) {
+	refs := unsealedRefs(t, server.DefaultConfig())
+	refs.Store.SetPolicy(ciRead)
+	bob := groupUser(t, refs, "bob")
+	user, _ := refs.Store.GetUserInfo("bob")
+	user.Policies = []string{server.DefaultPolicy, "ci-read"}
+	refs.Store.UpdateUser(user)
+	sess, _ := refs.Sessions.Get(bob)
+
+	// a role named no policies gets bob's, not just the default ones.
+	code, res := groupCall(approle.CreateHandler(refs), bob, approle.CreateRequest{})
+	if code != http.StatusOK {
+		t.Fatalf("role create failed: %d %+v", code, res)
+	}
+	roles := refs.Store.ListRoles("bob")
+	if len(roles) != 1 || !slices.Equal(roles[0].Policies, []string{"ci-read", server.DefaultPolicy}) {
+		t.Fatalf("expected the role to carry bob's policies, got %+v", roles)
+	}
+
+	// a token minted from a session limited to ci-read stays on ci-read, even
+	// after bob is given more.
+	limited := sess
+	limited.Scope.Policies = []string{"ci-read"}
+	parent, _ := refs.Sessions.CreateSession(limited)
+	code, child := mintToken(t, refs, parent, token.TokenRequest{})
+	if code != http.StatusOK {
+		t.Fatalf("mint failed: %d", code)
+	}
+	user.Policies = append(user.Policies, server.RootPolicy)
+	refs.Store.UpdateUser(user)
+	derived, _ := refs.Sessions.Get(child)
+	if got := refs.SessionPolicies(derived); !slices.Equal(got, []string{"ci-read"}) {
+		t.Fatalf("expected the derived token to keep its parent's policies, got %v", got)
+	}
+
+	// a token minted from a role session gets the role's policies pinned.
+	role := sess
+	role.Role = roles[0].ID
+	role.Scope = server.RoleScope(roles[0])
+	roleToken, _ := refs.Sessions.CreateSession(role)
+	if code, child = mintToken(t, refs, roleToken, token.TokenRequest{}); code != http.StatusOK {
+		t.Fatalf("mint failed: %d", code)
+	}
+	derived, _ = refs.Sessions.Get(child)
+	if !slices.Equal(derived.Scope.Policies, roles[0].Policies) {
+		t.Fatalf("expected a child of a role session to be limited to the role's policies, got %v", derived.Scope.Policies)
+	}
+}
+
+func TestPoliciesPersist(t *testing.T) {
+	refs := unsealedRefs(t, server.DefaultConfig())
+	refs.Store.SetPolicy(ciRead)
+	refs.Store.Unload()
+	if err := refs.Store.Load(); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if p, ok := refs.Store.GetPolicy("ci-read"); !ok || p.Rules[0].Path != "secret/ci/*" {
+		t.Fatalf("expected the policy to survive a reload, got %+v", p)
+	}
+	if err := refs.Store.DeletePolicy("ci-read"); err != nil {
+		t.Fatalf("DeletePolicy returned error: %v", err)
+	}
+	if err := refs.Store.DeletePolicy("ci-read"); !errors.As(err, new(store.NoSuchPolicyError)) {
+		t.Fatalf("expected deleting twice to fail, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/server"
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+func TestAutoUnsealWithFileProvider(t *testing.T) {
+	config := server.DefaultConfig()
+	config.VaultPath = t.TempDir()
+	config.Seal = server.SealConfig{Provider: "file", KeyFile: filepath.Join(t.TempDir(), "seal.key")}
+	provider, _ := server.NewKeyProvider(config.Seal)
+	refs := server.NewServerRefs(config)
+	if _, err := vault.InitKeyring(refs.KeyringPath(), 3, 2, provider); err != nil {
+		t.Fatalf("InitKeyring returned error: %v", err)
+	}
+	if err := refs.AutoUnseal(); err != nil || refs.Barrier.Sealed() {
+		t.Fatalf("expected auto-unseal, got %v", err)
+	}
+	refs.Store.AddUser("bob", []byte("login"), []byte("salt"))
+
+	// a restarted server unseals itself into the same store.
+	restarted := server.NewServerRefs(config)
+	if err := restarted.AutoUnseal(); err != nil || !restarted.Store.HasUser("bob") {
+		t.Fatalf("expected restart to unseal the same store, got %v", err)
+	}
+
+	os.WriteFile(config.Seal.KeyFile, make([]byte, 32), 0600)
+	if err := server.NewServerRefs(config).AutoUnseal(); err == nil {
+		t.Fatalf("expected a different key file to fail")
+	}
+}
+
+func TestAutoUnsealWithTransitProvider(t *testing.T) {
+	transit := httptest.NewServer(vault.TransitHandler([]byte("a thirty two byte transit root!!"), "s3cret"))
+	defer transit.Close()
+
+	config := server.DefaultConfig()
+	config.VaultPath = t.TempDir()
+	refs := server.NewServerRefs(config)
+	keys, _ := vault.InitKeyring(refs.KeyringPath(), 1, 1, nil)
+
+	// enrolling happens on the first unseal with key shares after the provider is configured.
+	config.Seal = server.SealConfig{Provider: "transit", Transit: server.TransitConfig{Address: transit.URL, Key: "govault", Token: "s3cret"}}
+	if err := refs.AutoUnseal(); err != vault.ErrNoProviderKey {
+		t.Fatalf("expected ErrNoProviderKey before enrolling, got %v", err)
+	}
+	if _, err := refs.Unseal(keys[0]); err != nil {
+		t.Fatalf("Unseal returned error: %v", err)
+	}
+	ring, _ := vault.ReadKeyring(refs.KeyringPath())
+	if ring.Provider != "transit:govault" {
+		t.Fatalf("expected the transit provider to be enrolled, got %q", ring.Provider)
+	}
+
+	if err := server.NewServerRefs(config).AutoUnseal(); err != nil {
+		t.Fatalf("expected auto-unseal through transit, got %v", err)
+	}
+	config.Seal.Transit.Token = "wrong"
+	if err := server.NewServerRefs(config).AutoUnseal(); err == nil {
+		t.Fatalf("expected a bad transit token to fail")
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{
+		"vaultPath": "/srv/govault",
+		"admins": ["root"],
+		"seal": {"provider": "transit", "transit": {"address": "http://localhost:8200", "key": "govault"}},
+		"registration": {"mode": "invite", "inviteTTL": "48h", "reserved": ["ops"]},
+		"maxSecretSize": 4096,
+		"maxFileSize": 1073741824,
+		"kdf": {"concurrency": 3, "queueDepth": 0, "timeout": "2s"}
+	}`), 0600)
+	config := server.DefaultConfig()
+	if err := server.LoadConfigFile(path, config); err != nil {
+		t.Fatalf("LoadConfigFile returned error: %v", err)
+	}
+	if config.VaultPath != "/srv/govault" || !config.IsAdmin("root") || config.Seal.Transit.Key != "govault" || config.MaxSecretSize != 4096 || config.MaxFileSize != 1<<30 {
+		t.Fatalf("unexpected config %+v", config)
+	}
+	if k := config.KDF; k.Concurrency != 3 || k.QueueDepth != 0 || k.Timeout != 2*time.Second {
+		t.Fatalf("unexpected kdf config %+v", k)
+	}
+	if r := config.Registration; r.Mode != server.RegistrationInvite || r.InviteTTL != 48*time.Hour || r.Reserved[0] != "ops" {
+		t.Fatalf("unexpected registration config %+v", r)
+	}
+
+	os.WriteFile(path, []byte(`{"vaultpth": "typo"}`), 0600)
+	if err := server.LoadConfigFile(path, server.DefaultConfig()); err == nil {
+		t.Fatalf("expected unknown settings to be rejected")
+	}
+	os.WriteFile(path, []byte(`{"registration": {"mode": "closed"}}`), 0600)
+	if err := server.LoadConfigFile(path, server.DefaultConfig()); err == nil {
+		t.Fatalf("expected an unknown registration mode to be rejected")
+	}
+	for _, kdf := range []string{`{"concurrency": 0}`, `{"queueDepth": -1}`, `{"timeout": "0s"}`, `{"timeout": "soon"}`} {
+		os.WriteFile(path, []byte(`{"kdf": `+kdf+`}`), 0600)
+		if err := server.LoadConfigFile(path, server.DefaultConfig()); err == nil {
+			t.Errorf("expected kdf settings %s to be rejected", kdf)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/server"
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/server/routes/admin"
+	"github.com/jdpolicano/govault/internal/server/routes/register"
+)
+
+func registerWith(t *testing.T, h http.HandlerFunc, creds server.AuthCredentials) int {
+	t.Helper()
+	body, _ := json.Marshal(creds)
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("POST", "/", bytes.NewReader(body)))
+	return rec.Code
+}
+
+func TestValidateUsername(t *testing.T) {
+	config := server.DefaultConfig()
+	config.Registration.Reserved = []string{"ops-bot"}
+	cases := []struct {
+		name string
+		err  error
+	}{
+		{"bob", nil},
+		{"alice.smith-2_x", nil},
+		{"bo", e.InvalidUsername},
+		{"Bob", e.InvalidUsername},
+		{"../../etc", e.InvalidUsername},
+		{".hidden", e.InvalidUsername},
+		{"a/b", e.InvalidUsername},
+		{"bob smith", e.InvalidUsername},
+		{string(make([]byte, 65)), e.InvalidUsername},
+		{"root", e.ReservedUsername},
+		{"groups", e.ReservedUsername},
+		{"ops-bot", e.ReservedUsername},
+	}
+	for _, c := range cases {
+		if err := config.ValidateUsername(c.name); !errors.Is(err, c.err) {
+			t.Errorf("%q: expected %v, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestRegistrationModes(t *testing.T) {
+	refs, root := adminRefs(t)
+	reg := register.Handler(refs)
+
+	groupCall(admin.RegistrationHandler(refs), root, admin.RegistrationRequest{Mode: server.RegistrationDisabled})
+	if rec := credentials(reg, "bob", "hunter22"); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected registration to be closed, got %d", rec.Code)
+	}
+	if code, _ := groupCall(admin.RegistrationHandler(refs), root, admin.RegistrationRequest{Mode: "sometimes"}); code != http.StatusBadRequest {
+		t.Fatalf("expected an unknown mode to be refused, got %d", code)
+	}
+	groupCall(admin.RegistrationHandler(refs), root, admin.RegistrationRequest{Mode: server.RegistrationOpen})
+	if rec := credentials(reg, "bob", "hunter22"); rec.Code != http.StatusOK {
+		t.Fatalf("expected registration to be open, got %d", rec.Code)
+	}
+	if rec := credentials(reg, "../eve", "hunter22"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected an unsafe name to be refused, got %d", rec.Code)
+	}
+}
+
+func TestRegistrationModeSurvivesRestart(t *testing.T) {
+	config := server.DefaultConfig()
+	config.Admins = []string{"root"}
+	config.VaultPath = t.TempDir()
+	refs := server.NewServerRefs(config)
+	key := unseal(t, refs)
+	root := groupUser(t, refs, "root")
+	groupCall(admin.RegistrationHandler(refs), root, admin.RegistrationRequest{Mode: server.RegistrationDisabled})
+
+	restarted := server.NewServerRefs(config)
+	if _, err := restarted.Unseal(key); err != nil {
+		t.Fatalf("Unseal returned error: %v", err)
+	}
+	if mode := restarted.RegistrationMode(); mode != server.RegistrationDisabled {
+		t.Fatalf("expected the switched mode to outlast a restart, got %q", mode)
+	}
+	if rec := credentials(register.Handler(restarted), "bob", "hunter22"); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected registration to stay closed, got %d", rec.Code)
+	}
+}
+
+func TestInviteOnlyRegistration(t *testing.T) {
+	refs, root := adminRefs(t)
+	refs.Config.Registration.Mode = server.RegistrationInvite
+	reg := register.Handler(refs)
+	withInvite := func(user, code string) int {
+		return registerWith(t, reg, server.AuthCredentials{Username: user, Password: "hunter22", Invite: code})
+	}
+
+	if code := withInvite("bob", ""); code != http.StatusForbidden {
+		t.Fatalf("expected an invite to be required, got %d", code)
+	}
+	code, res := groupCall(admin.CreateInviteHandler(refs), root, admin.InviteRequest{TTL: "1h"})
+	if code != http.StatusOK {
+		t.Fatalf("create invite failed: %d %+v", code, res)
+	}
+	invite := res.Data.(map[string]any)["code"].(string)
+
+	// a rejected registration hands the invite back.
+	if code := withInvite("root", invite); code != http.StatusBadRequest {
+		t.Fatalf("expected a reserved name to be refused, got %d", code)
+	}
+	if code := withInvite("bob", invite); code != http.StatusOK {
+		t.Fatalf("expected the invite to be accepted, got %d", code)
+	}
+	if code := withInvite("eve", invite); code != http.StatusForbidden {
+		t.Fatalf("expected the invite to work only once, got %d", code)
+	}
+	if len(refs.Store.ListInvites()) != 0 {
+		t.Errorf("expected the used invite to be gone")
+	}
+}
+
+func TestInviteExpiry(t *testing.T) {
+	refs, _ := adminRefs(t)
+	ic, err := refs.NewInvite("root", time.Minute)
+	if err != nil {
+		t.Fatalf("NewInvite returned error: %v", err)
+	}
+	if _, err := refs.RedeemInvite(ic.Code, time.Now().Add(2*time.Minute)); !errors.Is(err, e.InvalidInvite) {
+		t.Fatalf("expected an expired invite to be refused, got %v", err)
+	}
+	if _, err := refs.RedeemInvite(ic.Code, time.Now()); !errors.Is(err, e.InvalidInvite) {
+		t.Fatalf("expected an expired invite to be removed, got %v", err)
+	}
+}
+
+func TestInvitesPersist(t *testing.T) {
+	refs, root := adminRefs(t)
+	ic, _ := refs.NewInvite("root", 0)
+	refs.NewInvite("root", 0)
+	refs.Store.Unload()
+	if err := refs.Store.Load(); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if n := len(refs.Store.ListInvites()); n != 2 {
+		t.Fatalf("expected two invites after a reload, got %d", n)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(refs.Config.VaultPath, "invites.json")); len(matches) != 1 {
+		t.Fatalf("expected invites on disk")
+	}
+	if code, _ := groupCall(admin.RevokeInviteHandler(refs), root, admin.InviteInfo{ID: ic.ID}); code != http.StatusOK {
+		t.Fatalf("revoke failed: %d", code)
+	}
+	if _, err := refs.RedeemInvite(ic.Code, time.Now()); err == nil {
+		t.Fatalf("expected a revoked invite to be refused")
+	}
+}
@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+func TestKDFSchedulerSaturation(t *testing.T) {
+	s := vault.NewKDFScheduler(1, 1, time.Second)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go s.Do(context.Background(), func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	queued := make(chan error, 1)
+	go func() { queued <- s.Do(context.Background(), func() {}) }()
+	for s.Queued() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := s.Do(context.Background(), func() {}); !errors.Is(err, vault.ErrKDFSaturated) {
+		t.Fatalf("expected ErrKDFSaturated, got %v", err)
+	}
+	close(release)
+	if err := <-queued; err != nil {
+		t.Fatalf("queued call should have run, got %v", err)
+	}
+}
+
+func TestKDFSchedulerTimeout(t *testing.T) {
+	s := vault.NewKDFScheduler(1, 4, 20*time.Millisecond)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go s.Do(context.Background(), func() {
+		close(started)
+		<-release
+	})
+	<-started
+	defer close(release)
+
+	if err := s.Do(context.Background(), func() {}); !errors.Is(err, vault.ErrKDFTimeout) {
+		t.Fatalf("expected ErrKDFTimeout, got %v", err)
+	}
+	if s.Queued() != 0 {
+		t.Errorf("timed out caller should leave the queue")
+	}
+}
+
+// benchmarkLightUnderKDFLoad measures the latency of a cheap request while logins
+// saturate the machine, with derive standing in for how logins run their kdf.
+func benchmarkLightUnderKDFLoad(b *testing.B, derive func(salt []byte)) {
+	salt := []byte("0123456789abcdef")
+	stop := make(chan struct{})
+	var wg, ready sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		ready.Add(1)
+		go func() {
+			defer wg.Done()
+			ready.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					derive(salt)
+				}
+			}
+		}()
+	}
+
+	ready.Wait()
+
+	key := make([]byte, 32)
+	latencies := make([]time.Duration, 0, b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		ct, nonce, _ := vault.Encrypt(key, "secret")
+		vault.Decrypt(nonce, key, ct)
+		latencies = append(latencies, time.Since(start))
+	}
+	b.StopTimer()
+	close(stop)
+	wg.Wait()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	b.ReportMetric(float64(latencies[len(latencies)/2].Microseconds()), "p50-us")
+	b.ReportMetric(float64(latencies[len(latencies)*99/100].Microseconds()), "p99-us")
+}
+
+func BenchmarkLightRequestUnboundedKDF(b *testing.B) {
+	benchmarkLightUnderKDFLoad(b, func(salt []byte) {
+		vault.NewKeyWithSalt("password", salt)
+	})
+}
+
+func BenchmarkLightRequestScheduledKDF(b *testing.B) {
+	s := vault.NewKDFScheduler(1, 8, 50*time.Millisecond)
+	benchmarkLightUnderKDFLoad(b, func(salt []byte) {
+		if _, err := s.NewKeyWithSalt(context.Background(), "password", salt); err != nil {
+			time.Sleep(10 * time.Millisecond) // a rejected client backing off
+		}
+	})
+}
+
+func BenchmarkKDFScheduledLogin(b *testing.B) {
+	s := vault.NewKDFScheduler(2, 64, time.Minute)
+	salt := []byte("0123456789abcdef")
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := s.NewKeyWithSalt(context.Background(), "password", salt); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,215 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/server"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+	"github.com/jdpolicano/govault/internal/server/routes/sys"
+	"github.com/jdpolicano/govault/internal/server/routes/token"
+)
+
+type keyedBody struct {
+	Key string `json:"key"`
+}
+
+func (k keyedBody) SecretKey() string { return k.Key }
+
+func TestScopeAllows(t *testing.T) {
+	cases := []struct {
+		name  string
+		scope server.Scope
+		cap   server.Capability
+		key   string
+		want  bool
+	}{
+		{"unrestricted", server.Scope{}, server.CapWrite, "any", true},
+		{"prefix match", server.Scope{Paths: []string{"ci/*"}}, server.CapRead, "ci/deploy", true},
+		{"prefix miss", server.Scope{Paths: []string{"ci/*"}}, server.CapRead, "prod/db", false},
+		{"exact match", server.Scope{Paths: []string{"ci"}}, server.CapRead, "ci", true},
+		{"exact miss", server.Scope{Paths: []string{"ci"}}, server.CapRead, "ci/x", false},
+		{"read only read", server.Scope{ReadOnly: true}, server.CapRead, "x", true},
+		{"read only write", server.Scope{ReadOnly: true}, server.CapWrite, "x", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.scope.Allows(c.cap, c.key); got != c.want {
+				t.Errorf("Allows(%s, %q) = %v want %v", c.cap, c.key, got, c.want)
+			}
+		})
+	}
+}
+
+func TestScopeNarrow(t *testing.T) {
+	cases := []struct {
+		name   string
+		parent server.Scope
+		child  server.Scope
+		ok     bool
+	}{
+		{"from unrestricted", server.Scope{}, server.Scope{Paths: []string{"ci/*"}}, true},
+		{"sub prefix", server.Scope{Paths: []string{"ci/*"}}, server.Scope{Paths: []string{"ci/deploy/*"}}, true},
+		{"sibling prefix", server.Scope{Paths: []string{"ci/*"}}, server.Scope{Paths: []string{"cid/*"}}, false},
+		{"widen paths", server.Scope{Paths: []string{"ci/*"}}, server.Scope{}, false},
+		{"drop read only", server.Scope{ReadOnly: true}, server.Scope{}, false},
+		{"keep read only", server.Scope{ReadOnly: true}, server.Scope{ReadOnly: true}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := c.parent.Narrow(c.child)
+			if (err == nil) != c.ok {
+				t.Errorf("Narrow returned %v, want ok=%v", err, c.ok)
+			}
+		})
+	}
+}
+
+func TestScopedSessionUses(t *testing.T) {
+	sessions := server.NewSessionMap()
+	parent := server.NewSession("bob", []byte("key"), time.Minute)
+	id, err := sessions.CreateScopedSession(parent, server.Scope{ReadOnly: true}, time.Hour, 2)
+	if err != nil {
+		t.Fatalf("CreateScopedSession returned error: %v", err)
+	}
+	sess, _ := sessions.Get(id)
+	if sess.Remaining() > time.Minute {
+		t.Errorf("derived ttl should be capped at the parent's")
+	}
+	for i := 0; i < 2; i++ {
+		if _, ok := sessions.Use(id); !ok {
+			t.Fatalf("use %d should succeed", i)
+		}
+	}
+	if _, ok := sessions.Use(id); ok {
+		t.Fatalf("session should be gone after its uses are spent")
+	}
+}
+
+func TestAuthorizeMiddleware(t *testing.T) {
+	refs := server.NewServerRefs(server.DefaultConfig())
+	sess := server.NewSession("bob", []byte("key"), time.Minute)
+	sess.Scope = server.Scope{Paths: []string{"ci/*"}, ReadOnly: true}
+	refs.Sessions.Set("govault-id", sess)
+
+	run := func(cap server.Capability, key string) int {
+		req := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"key":"`+key+`"}`))
+		req.Header.Set("Authorization", "Bearer govault-id")
+		rec := httptest.NewRecorder()
+		h := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+		middleware.Chain(h,
+			middleware.ValidateToken(refs),
+			middleware.ParseJSONBody[keyedBody](refs),
+			middleware.Authorize(refs, cap),
+		)(rec, req)
+		return rec.Code
+	}
+
+	if code := run(server.CapRead, "ci/token"); code != http.StatusOK {
+		t.Errorf("expected read in scope to pass, got %d", code)
+	}
+	if code := run(server.CapWrite, "ci/token"); code != http.StatusForbidden {
+		t.Errorf("expected write to be forbidden, got %d", code)
+	}
+	if code := run(server.CapRead, "prod/db"); code != http.StatusForbidden {
+		t.Errorf("expected out of scope read to be forbidden, got %d", code)
+	}
+}
+
+// mintToken derives a token from the session behind parent through the token route.
+func mintToken(t *testing.T, refs *server.ServerRefs, parent string, body token.TokenRequest) (int, string) {
+	t.Helper()
+	code, res := groupCall(token.Handler(refs), parent, body)
+	data, _ := res.Data.(map[string]any)
+	child, _ := data["token"].(string)
+	return code, child
+}
+
+func TestDerivedTokensKeepRole(t *testing.T) {
+	config := server.DefaultConfig()
+	config.Admins = []string{"alice"}
+	refs := unsealedRefs(t, config)
+	groupUser(t, refs, "alice")
+	sess := server.NewSession("alice", []byte("alice-0123456789abcdef0123456789a"), time.Minute)
+	sess.Role = "ci"
+	role, _ := refs.Sessions.CreateSession(sess)
+
+	code, child := mintToken(t, refs, role, token.TokenRequest{})
+	if code != http.StatusOK {
+		t.Fatalf("mint failed: %d", code)
+	}
+	if got, _ := refs.Sessions.Get(child); got.Role != "ci" {
+		t.Fatalf("expected the child to be a session of the role, got %+v", got)
+	}
+	if code, _ := groupCall(sys.SealHandler(refs), child, nil); code != http.StatusForbidden {
+		t.Fatalf("expected the child of a role session not to seal the vault, got %d", code)
+	}
+	if refs.Barrier.Sealed() {
+		t.Fatalf("expected the vault to stay unsealed")
+	}
+}
+
+func TestDerivedTokensKeepUseLimit(t *testing.T) {
+	refs := unsealedRefs(t, server.DefaultConfig())
+	groupUser(t, refs, "alice")
+	sess := server.NewSession("alice", []byte("alice-0123456789abcdef0123456789a"), time.Minute)
+	sess.Uses = 3
+	limited, _ := refs.Sessions.CreateSession(sess)
+
+	if code, _ := mintToken(t, refs, limited, token.TokenRequest{}); code != http.StatusForbidden {
+		t.Fatalf("expected an unlimited child of a limited token to be refused, got %d", code)
+	}
+	code, child := mintToken(t, refs, limited, token.TokenRequest{Uses: 10})
+	if code != http.StatusOK {
+		t.Fatalf("mint failed: %d", code)
+	}
+	// the parent had 3 uses. The refused mint spent one, as it was refused by the
+	// handler rather than by authorization, and this one leaves a single use.
+	if got, _ := refs.Sessions.Get(child); got.Uses != 1 {
+		t.Fatalf("expected the child to be capped at the parent's remaining use, got %d", got.Uses)
+	}
+	if code, _ := groupCall(sys.SealHandler(refs), child, nil); code != http.StatusForbidden {
+		t.Fatalf("expected a limited child not to pass as a password login, got %d", code)
+	}
+	if code, _ := mintToken(t, refs, limited, token.TokenRequest{Uses: 1}); code != http.StatusForbidden {
+		t.Fatalf("expected a token on its last use not to mint more, got %d", code)
+	}
+}
+
+func TestRefusedRequestsSpendNoUses(t *testing.T) {
+	refs := server.NewServerRefs(server.DefaultConfig())
+	sess := server.NewSession("bob", []byte("key"), time.Minute)
+	sess.Scope = server.Scope{Paths: []string{"ci/*"}}
+	sess.Uses = 2
+	refs.Sessions.Set("govault-id", sess)
+
+	run := func(key string) int {
+		req := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"key":"`+key+`"}`))
+		req.Header.Set("Authorization", "Bearer govault-id")
+		rec := httptest.NewRecorder()
+		h := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+		middleware.Chain(h,
+			middleware.ValidateToken(refs),
+			middleware.ParseJSONBody[keyedBody](refs),
+			middleware.Authorize(refs, server.CapRead),
+		)(rec, req)
+		return rec.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := run("prod/db"); code != http.StatusForbidden {
+			t.Fatalf("expected out of scope reads to be refused, got %d", code)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if code := run("ci/token"); code != http.StatusOK {
+			t.Fatalf("use %d should succeed, got %d", i, code)
+		}
+	}
+	if code := run("ci/token"); code != http.StatusUnauthorized {
+		t.Fatalf("expected the token to be gone after its uses, got %d", code)
+	}
+}
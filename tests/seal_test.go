@@ -0,0 +1,369 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/server"
+	"github.com/jdpolicano/govault/internal/server/middleware"
+	"github.com/jdpolicano/govault/internal/server/routes/sys"
+	"github.com/jdpolicano/govault/internal/store"
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+// unseal initializes a keyring for refs and unseals it.
+func unseal(t *testing.T, refs *server.ServerRefs) []byte {
+	t.Helper()
+	keys, err := server.InitVault(refs.Config, 1, 1, nil)
+	if err != nil {
+		t.Fatalf("InitVault returned error: %v", err)
+	}
+	if _, err := refs.Unseal(keys[0]); err != nil {
+		t.Fatalf("Unseal returned error: %v", err)
+	}
+	return keys[0]
+}
+
+// unsealedRefs returns server refs over an initialized and unsealed vault.
+func unsealedRefs(t *testing.T, config *server.ContextConfig) *server.ServerRefs {
+	t.Helper()
+	if config.VaultPath == server.DefaultConfig().VaultPath {
+		config.VaultPath = t.TempDir()
+	}
+	refs := server.NewServerRefs(config)
+	unseal(t, refs)
+	return refs
+}
+
+func TestBarrierEncryptsRecords(t *testing.T) {
+	config := server.DefaultConfig()
+	config.VaultPath = t.TempDir()
+	refs := unsealedRefs(t, config)
+	if err := refs.Store.AddUser("bob", []byte("login-hash"), []byte("salt")); err != nil {
+		t.Fatalf("AddUser returned error: %v", err)
+	}
+	refs.Store.Set("bob", "prod/aws_root", store.CipherText{Nonce: []byte("n"), Text: []byte("c")}, store.Metadata{})
+	records, _ := filepath.Glob(filepath.Join(config.VaultPath, "users", "*", "record"))
+	if len(records) != 1 {
+		t.Fatalf("expected one record under an opaque directory, got %v", records)
+	}
+	if _, err := os.Stat(filepath.Join(config.VaultPath, "bob")); !os.IsNotExist(err) {
+		t.Fatalf("expected no directory named for the user, got %v", err)
+	}
+	raw, err := os.ReadFile(records[0])
+	if err != nil {
+		t.Fatalf("reading record: %v", err)
+	}
+	if bytes.Contains(raw, []byte("bob")) || bytes.Contains(raw, []byte("aws_root")) || json.Valid(raw) {
+		t.Fatalf("expected record to be encrypted on disk, got %q", raw)
+	}
+}
+
+func TestLoadMovesNamedDirectories(t *testing.T) {
+	config := server.DefaultConfig()
+	config.VaultPath = t.TempDir()
+	refs := server.NewServerRefs(config)
+	key := unseal(t, refs)
+	refs.Store.AddUser("bob", []byte("login"), []byte("salt"))
+	records, _ := filepath.Glob(filepath.Join(config.VaultPath, "users", "*", "record"))
+
+	// lay the record out the way stores did before directories were opaque.
+	legacy := filepath.Join(config.VaultPath, "bob", "secrets.json")
+	os.MkdirAll(filepath.Dir(legacy), 0700)
+	os.Rename(records[0], legacy)
+	os.RemoveAll(filepath.Join(config.VaultPath, "users"))
+
+	restarted := server.NewServerRefs(config)
+	if _, err := restarted.Unseal(key); err != nil {
+		t.Fatalf("Unseal returned error: %v", err)
+	}
+	if !restarted.Store.HasUser("bob") {
+		t.Fatalf("expected the legacy record to be loaded")
+	}
+	if _, err := os.Stat(filepath.Dir(legacy)); !os.IsNotExist(err) {
+		t.Fatalf("expected the named directory to be removed")
+	}
+	if moved, _ := filepath.Glob(filepath.Join(config.VaultPath, "users", "*", "record")); len(moved) != 1 {
+		t.Fatalf("expected the record to move to an opaque directory, got %v", moved)
+	}
+}
+
+func TestInitEncryptsPlaintextVault(t *testing.T) {
+	config := server.DefaultConfig()
+	config.VaultPath = t.TempDir()
+	// vaults from before the barrier kept records in plaintext under the user's name.
+	record := store.NewJSONRecord(store.NewUser("bob", []byte("login"), []byte("salt")))
+	record.Secrets["prod/aws_root"] = store.CipherText{Nonce: []byte("n"), Text: []byte("c")}
+	writeJSON(t, filepath.Join(config.VaultPath, "bob", "secrets.json"), record)
+
+	refs := server.NewServerRefs(config)
+	key := unseal(t, refs)
+	if !refs.Store.HasUser("bob") {
+		t.Fatalf("expected the plaintext record to be loaded")
+	}
+	if _, ok := refs.Store.Get("bob", "prod/aws_root"); !ok {
+		t.Fatalf("expected the plaintext record's secrets to be loaded")
+	}
+	records, _ := filepath.Glob(filepath.Join(config.VaultPath, "users", "*", "record"))
+	if len(records) != 1 {
+		t.Fatalf("expected the record to move to an opaque directory, got %v", records)
+	}
+	raw, _ := os.ReadFile(records[0])
+	if json.Valid(raw) || bytes.Contains(raw, []byte("aws_root")) {
+		t.Fatalf("expected the record to be encrypted when the keyring was created, got %q", raw)
+	}
+	if _, err := os.Stat(filepath.Join(config.VaultPath, "bob")); !os.IsNotExist(err) {
+		t.Fatalf("expected the plaintext record to be removed, got %v", err)
+	}
+
+	// once the vault has a keyring, plaintext records are no longer taken.
+	writeJSON(t, filepath.Join(config.VaultPath, "eve", "secrets.json"), store.NewJSONRecord(store.NewUser("eve", nil, nil)))
+	refs.Seal()
+	if _, err := refs.Unseal(key); err == nil || refs.Store.HasUser("eve") {
+		t.Fatalf("expected a plaintext record in an encrypted vault to be refused, got %v", err)
+	}
+}
+
+func TestUnsealRefusesPlaintextWithoutManifest(t *testing.T) {
+	config := server.DefaultConfig()
+	config.VaultPath = t.TempDir()
+	refs := server.NewServerRefs(config)
+	key := unseal(t, refs)
+	refs.Seal()
+
+	// someone able to write to the vault path removes the manifest and plants an admin.
+	os.Remove(filepath.Join(config.VaultPath, "manifest.json"))
+	eve := store.NewUser("eve", []byte("login"), []byte("salt"))
+	eve.Admin = true
+	writeJSON(t, filepath.Join(config.VaultPath, "users", "planted", "record"), store.NewJSONRecord(eve))
+
+	if _, err := refs.Unseal(key); err == nil || refs.Store.HasUser("eve") {
+		t.Fatalf("expected a plaintext record to be refused once the keyring exists, got %v", err)
+	}
+	if _, err := server.InitVault(config, 1, 1, nil); err != vault.ErrAlreadyInitialized {
+		t.Fatalf("expected initializing again to be refused, got %v", err)
+	}
+}
+
+func TestInitKeepsPlaintextWhenKeyringFails(t *testing.T) {
+	config := server.DefaultConfig()
+	config.VaultPath = t.TempDir()
+	legacy := filepath.Join(config.VaultPath, "bob", "secrets.json")
+	writeJSON(t, legacy, store.NewJSONRecord(store.NewUser("bob", []byte("login"), []byte("salt"))))
+
+	// a key file of the wrong size fails the keyring after the records are encrypted.
+	keyFile := filepath.Join(t.TempDir(), "kek")
+	os.WriteFile(keyFile, []byte("short"), 0600)
+	if _, err := server.InitVault(config, 1, 1, vault.NewFileKeyProvider(keyFile)); err == nil {
+		t.Fatalf("expected the bad key file to fail initialization")
+	}
+	if _, err := os.Stat(filepath.Join(config.VaultPath, vault.KeyringFile)); !os.IsNotExist(err) {
+		t.Fatalf("expected no keyring to be written, got %v", err)
+	}
+	if _, err := os.Stat(legacy); err != nil {
+		t.Fatalf("expected the plaintext record to be kept, got %v", err)
+	}
+	if records, _ := filepath.Glob(filepath.Join(config.VaultPath, "users", "*", "record")); len(records) != 0 {
+		t.Fatalf("expected no encrypted copies to be left behind, got %v", records)
+	}
+}
+
+func TestLoadMovesUserNamedUsers(t *testing.T) {
+	config := server.DefaultConfig()
+	config.VaultPath = t.TempDir()
+	refs := server.NewServerRefs(config)
+	key := unseal(t, refs)
+	refs.Store.AddUser("bob", []byte("login"), []byte("salt"))
+	refs.Store.AddUser("users", []byte("login"), []byte("salt"))
+	records, _ := filepath.Glob(filepath.Join(config.VaultPath, "users", "*", "record"))
+
+	// a user named "users" kept their record beside the opaque directories.
+	for _, record := range records {
+		raw, _ := os.ReadFile(record)
+		plain, _ := refs.Barrier.Decrypt(raw)
+		if bytes.Contains(plain, []byte(`"name":"users"`)) {
+			os.Rename(record, filepath.Join(config.VaultPath, "users", "secrets.json"))
+			os.Remove(filepath.Dir(record))
+		}
+	}
+
+	restarted := server.NewServerRefs(config)
+	if _, err := restarted.Unseal(key); err != nil {
+		t.Fatalf("Unseal returned error: %v", err)
+	}
+	if !restarted.Store.HasUser("bob") || !restarted.Store.HasUser("users") {
+		t.Fatalf("expected both records to be loaded")
+	}
+	if moved, _ := filepath.Glob(filepath.Join(config.VaultPath, "users", "*", "record")); len(moved) != 2 {
+		t.Fatalf("expected both records in opaque directories, got %v", moved)
+	}
+}
+
+func TestSealUnsealCycle(t *testing.T) {
+	config := server.DefaultConfig()
+	config.VaultPath = t.TempDir()
+	refs := server.NewServerRefs(config)
+	if _, err := refs.Unseal(make([]byte, 32)); err != vault.ErrNotInitialized {
+		t.Fatalf("expected ErrNotInitialized, got %v", err)
+	}
+	key := unseal(t, refs)
+	refs.Store.AddUser("bob", []byte("login"), []byte("salt"))
+	token, _ := refs.Sessions.CreateUserSession("bob", []byte("key"), time.Minute)
+
+	refs.Seal()
+	if !refs.Barrier.Sealed() || refs.Store.HasUser("bob") {
+		t.Fatalf("expected sealing to drop the store")
+	}
+	if _, ok := refs.Sessions.Get(token); ok {
+		t.Fatalf("expected sealing to revoke sessions")
+	}
+	if err := refs.Store.AddUser("alice", []byte("login"), []byte("salt")); err == nil {
+		t.Fatalf("expected writes to fail while sealed")
+	}
+
+	wrong := append([]byte(nil), key...)
+	wrong[0] ^= 1
+	if _, err := refs.Unseal(wrong); err != vault.ErrBadUnsealKey {
+		t.Fatalf("expected ErrBadUnsealKey, got %v", err)
+	}
+	if _, err := refs.Unseal(key); err != nil {
+		t.Fatalf("Unseal returned error: %v", err)
+	}
+	if !refs.Store.HasUser("bob") {
+		t.Fatalf("expected store to be reloaded after unsealing")
+	}
+}
+
+func TestRequireUnsealed(t *testing.T) {
+	config := server.DefaultConfig()
+	config.VaultPath = t.TempDir()
+	refs := server.NewServerRefs(config)
+	h := middleware.RequireUnsealed(refs, "/healthz", "/v1/sys/")(func(w http.ResponseWriter, r *http.Request) {})
+
+	for path, want := range map[string]int{
+		"/get":           http.StatusServiceUnavailable,
+		"/healthz/extra": http.StatusServiceUnavailable,
+		"/healthz":       http.StatusOK,
+		"/v1/sys/unseal": http.StatusOK,
+	} {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("POST", path, nil))
+		if rec.Code != want {
+			t.Errorf("%s: expected %d, got %d", path, want, rec.Code)
+		}
+	}
+}
+
+func TestUnsealHandler(t *testing.T) {
+	config := server.DefaultConfig()
+	config.VaultPath = t.TempDir()
+	refs := server.NewServerRefs(config)
+	keys, _ := vault.InitKeyring(refs.KeyringPath(), 1, 1, nil)
+	h := sys.UnsealHandler(refs)
+
+	send := func(key []byte) int {
+		body, _ := json.Marshal(sys.UnsealRequest{Key: key})
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("POST", "/v1/sys/unseal", bytes.NewReader(body)))
+		return rec.Code
+	}
+	if code := send(make([]byte, 32)); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a wrong key, got %d", code)
+	}
+	if code := send(keys[0]); code != http.StatusOK || refs.Barrier.Sealed() {
+		t.Fatalf("expected unseal to succeed, got %d", code)
+	}
+}
+
+func TestShamirRoundTrip(t *testing.T) {
+	secret := []byte("a thirty two byte barrier secret")
+	shares, err := vault.Split(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("Split returned error: %v", err)
+	}
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		picked := make([][]byte, len(subset))
+		for i, j := range subset {
+			picked[i] = shares[j]
+		}
+		got, err := vault.Combine(picked)
+		if err != nil || !bytes.Equal(got, secret) {
+			t.Errorf("shares %v: got %q, %v", subset, got, err)
+		}
+	}
+	if got, _ := vault.Combine(shares[:2]); bytes.Equal(got, secret) {
+		t.Errorf("expected fewer than the threshold to reveal nothing")
+	}
+	if _, err := vault.Combine([][]byte{shares[0], shares[0]}); err != vault.ErrDuplicateShare {
+		t.Errorf("expected ErrDuplicateShare, got %v", err)
+	}
+	if _, err := vault.Split(secret, 2, 3); err != vault.ErrInvalidShares {
+		t.Errorf("expected ErrInvalidShares, got %v", err)
+	}
+}
+
+func TestUnsealWithShares(t *testing.T) {
+	config := server.DefaultConfig()
+	config.VaultPath = t.TempDir()
+	refs := server.NewServerRefs(config)
+	keys, err := vault.InitKeyring(refs.KeyringPath(), 5, 3, nil)
+	if err != nil {
+		t.Fatalf("InitKeyring returned error: %v", err)
+	}
+
+	status, _ := refs.Unseal(keys[4])
+	if !status.Sealed || status.Progress != 1 || status.Threshold != 3 {
+		t.Fatalf("unexpected status after one share %+v", status)
+	}
+	if _, err := refs.Unseal(keys[4]); err != vault.ErrDuplicateShare {
+		t.Fatalf("expected ErrDuplicateShare, got %v", err)
+	}
+	refs.Unseal(keys[1])
+	if status, err := refs.Unseal(keys[2]); err != nil || status.Sealed || status.Progress != 0 {
+		t.Fatalf("expected unseal at the threshold, got %+v %v", status, err)
+	}
+}
+
+func TestRekey(t *testing.T) {
+	config := server.DefaultConfig()
+	config.VaultPath = t.TempDir()
+	refs := server.NewServerRefs(config)
+	old, _ := vault.InitKeyring(refs.KeyringPath(), 3, 2, nil)
+	refs.Unseal(old[0])
+	refs.Unseal(old[1])
+	refs.Store.AddUser("bob", []byte("login"), []byte("salt"))
+
+	rekey, err := refs.BeginRekey(5, 3)
+	if err != nil || rekey.Required != 2 {
+		t.Fatalf("BeginRekey returned %+v %v", rekey, err)
+	}
+	if _, _, err := refs.SubmitRekeyShare("wrong", old[0]); err == nil {
+		t.Fatalf("expected a mismatched nonce to be rejected")
+	}
+	if _, keys, _ := refs.SubmitRekeyShare(rekey.Nonce, old[2]); keys != nil {
+		t.Fatalf("expected no keys before the threshold")
+	}
+	_, keys, err := refs.SubmitRekeyShare(rekey.Nonce, old[0])
+	if err != nil || len(keys) != 5 {
+		t.Fatalf("expected five new shares, got %d %v", len(keys), err)
+	}
+
+	refs.Seal()
+	refs.Unseal(old[0])
+	refs.Unseal(old[1])
+	if _, err := refs.Unseal(old[2]); err != vault.ErrBadUnsealKey {
+		t.Fatalf("expected the old shares to stop working, got %v", err)
+	}
+	for _, k := range keys[2:] {
+		refs.Unseal(k)
+	}
+	if refs.Barrier.Sealed() || !refs.Store.HasUser("bob") {
+		t.Fatalf("expected the new shares to unseal the same store")
+	}
+}
@@ -0,0 +1,290 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/server"
+	"github.com/jdpolicano/govault/internal/server/routes/get"
+	"github.com/jdpolicano/govault/internal/server/routes/secrets"
+	"github.com/jdpolicano/govault/internal/server/routes/set"
+	"github.com/jdpolicano/govault/internal/store"
+)
+
+func TestListKeys(t *testing.T) {
+	keys := []string{"prod/db/password", "prod/db/user", "prod/api", "staging/api", "readme"}
+	page, err := store.ListKeys(keys, "", "", 0)
+	if err != nil || !reflect.DeepEqual(page.Entries, []string{"prod/", "readme", "staging/"}) {
+		t.Fatalf("unexpected top level listing %+v %v", page, err)
+	}
+	page, _ = store.ListKeys(keys, "prod/", "", 1)
+	if !reflect.DeepEqual(page.Entries, []string{"api"}) || page.Next != "api" {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+	page, _ = store.ListKeys(keys, "prod/", page.Next, 1)
+	if !reflect.DeepEqual(page.Entries, []string{"db/"}) || page.Next != "" {
+		t.Fatalf("unexpected last page %+v", page)
+	}
+	for _, prefix := range []string{"prod", "/prod/", "prod//", "../"} {
+		if _, err := store.ListKeys(keys, prefix, "", 0); !errors.Is(err, store.ErrInvalidPath) {
+			t.Errorf("expected %q to be refused, got %v", prefix, err)
+		}
+	}
+}
+
+func TestJSONStoreMoveAndDeleteTree(t *testing.T) {
+	js := store.NewJSONStore(t.TempDir())
+	js.AddUser("bob", []byte("login"), []byte("salt"))
+	for _, key := range []string{"prod/db", "prod/api", "prod/old/key", "other"} {
+		js.Set("bob", key, store.CipherText{Text: []byte(key)}, store.Metadata{})
+	}
+
+	if n, err := js.Move("bob", "prod/", "live/"); err != nil || n != 3 {
+		t.Fatalf("expected three secrets moved, got %d %v", n, err)
+	}
+	if ct, ok := js.Get("bob", "live/old/key"); !ok || string(ct.Text) != "prod/old/key" {
+		t.Errorf("expected the secret under its new path")
+	}
+	if _, err := js.Move("bob", "other", "live/db"); !errors.As(err, new(store.SecretExistsError)) {
+		t.Errorf("expected a move onto a secret to be refused, got %v", err)
+	}
+	if _, err := js.Move("bob", "live/", "live/nested/"); !errors.Is(err, store.ErrInvalidPath) {
+		t.Errorf("expected a move into itself to be refused, got %v", err)
+	}
+	if _, err := js.Move("bob", "gone", "here"); !errors.As(err, new(store.NoSuchSecretError)) {
+		t.Errorf("expected moving nothing to fail, got %v", err)
+	}
+
+	if n, err := js.DeleteTree("bob", "live/"); err != nil || n != 3 {
+		t.Fatalf("expected three secrets deleted, got %d %v", n, err)
+	}
+	page, _ := js.List("bob", "", "", 0, nil)
+	if !reflect.DeepEqual(page.Entries, []string{"other"}) {
+		t.Errorf("expected only the other secret left, got %v", page.Entries)
+	}
+	if err := js.Delete("bob", "other"); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if err := js.Delete("bob", "other"); !errors.As(err, new(store.NoSuchSecretError)) {
+		t.Errorf("expected a second delete to fail, got %v", err)
+	}
+}
+
+func TestSecretRoutes(t *testing.T) {
+	config := server.DefaultConfig()
+	refs := unsealedRefs(t, config)
+	bob := groupUser(t, refs, "bob")
+	for _, key := range []string{"ci/token", "ci/deploy/key", "prod/db"} {
+		if code, res := groupCall(set.Handler(refs), bob, set.SetRequest{Key: key, Value: "v"}); code != http.StatusOK {
+			t.Fatalf("set %s failed: %d %+v", key, code, res)
+		}
+	}
+	if code, _ := groupCall(set.Handler(refs), bob, set.SetRequest{Key: "ci//x", Value: "v"}); code != http.StatusBadRequest {
+		t.Errorf("expected a key with an empty segment to be refused, got %d", code)
+	}
+
+	list := secrets.ListHandler(refs)
+	if code, res := groupCall(list, bob, secrets.ListRequest{Prefix: "ci/"}); code != http.StatusOK ||
+		!reflect.DeepEqual(res.Data.(map[string]any)["entries"], []any{"deploy/", "token"}) {
+		t.Fatalf("unexpected listing %d %+v", code, res)
+	}
+
+	parent, _ := refs.Sessions.Get(bob)
+	scoped, _ := refs.Sessions.CreateScopedSession(parent, server.Scope{Paths: []string{"ci/*"}}, time.Minute, 0)
+	if code, _ := groupCall(list, scoped, secrets.ListRequest{}); code != http.StatusForbidden {
+		t.Errorf("expected a token scoped to ci/ to be refused the whole vault, got %d", code)
+	}
+	if code, _ := groupCall(secrets.MoveHandler(refs), scoped, secrets.MoveRequest{From: "ci/", To: "prod/ci/"}); code != http.StatusForbidden {
+		t.Errorf("expected a move out of scope to be refused, got %d", code)
+	}
+
+	del := secrets.DeleteHandler(refs)
+	if code, _ := groupCall(del, bob, secrets.DeleteRequest{Key: "ci/", Recursive: true}); code != http.StatusBadRequest {
+		t.Errorf("expected an unconfirmed recursive delete to be refused, got %d", code)
+	}
+	if code, res := groupCall(del, bob, secrets.DeleteRequest{Key: "ci/", Recursive: true, Confirm: "ci/"}); code != http.StatusOK || res.Data != float64(2) {
+		t.Fatalf("expected two secrets deleted, got %d %+v", code, res)
+	}
+	if code, res := groupCall(secrets.MoveHandler(refs), bob, secrets.MoveRequest{From: "prod/db", To: "prod/database"}); code != http.StatusOK || res.Data != float64(1) {
+		t.Fatalf("expected the secret renamed, got %d %+v", code, res)
+	}
+	if code, _ := groupCall(del, bob, secrets.DeleteRequest{Key: "prod/db"}); code != http.StatusNotFound {
+		t.Errorf("expected the old name to be gone, got %d", code)
+	}
+}
+
+func TestSecretMetadata(t *testing.T) {
+	config := server.DefaultConfig()
+	refs := unsealedRefs(t, config)
+	bob := groupUser(t, refs, "bob")
+	sess, _ := refs.Sessions.Get(bob)
+	write := set.Handler(refs)
+	groupCall(write, bob, set.SetRequest{Key: "prod/db", Value: "v1", Labels: map[string]string{"env": "prod"}, Description: "primary database"})
+	groupCall(write, bob, set.SetRequest{Key: "staging/db", Value: "v1", Labels: map[string]string{"env": "staging"}})
+	created, _ := refs.Store.GetMetadata("bob", "prod/db")
+	if created.Created.IsZero() || created.UpdatedBy != sess.ID || created.Description != "primary database" {
+		t.Fatalf("unexpected metadata after the first write %+v", created)
+	}
+
+	// a new value keeps the labels, description and creation time.
+	time.Sleep(time.Millisecond)
+	groupCall(write, bob, set.SetRequest{Key: "prod/db", Value: "v2"})
+	code, res := groupCall(get.Handler(refs), bob, get.GetRequest{Key: "prod/db", Metadata: true})
+	info, _ := res.Data.(map[string]any)
+	meta, _ := info["metadata"].(map[string]any)
+	if code != http.StatusOK || info["value"] != "v2" || meta["description"] != "primary database" ||
+		meta["created"] != created.Created.Format(time.RFC3339Nano) || meta["updated"] == meta["created"] {
+		t.Fatalf("unexpected get with metadata %d %+v", code, res)
+	}
+
+	code, res = groupCall(secrets.ListHandler(refs), bob, secrets.ListRequest{Labels: map[string]string{"env": "prod"}})
+	page, _ := res.Data.(map[string]any)
+	if code != http.StatusOK || !reflect.DeepEqual(page["entries"], []any{"prod/"}) {
+		t.Fatalf("expected the label filter to leave only prod/, got %d %+v", code, res)
+	}
+	_, res = groupCall(secrets.ListHandler(refs), bob, secrets.ListRequest{Prefix: "prod/"})
+	if listed, _ := res.Data.(map[string]any)["metadata"].(map[string]any); listed["db"] == nil {
+		t.Errorf("expected the listing to carry metadata, got %+v", res)
+	}
+
+	relabel := secrets.MetadataRequest{Key: "staging/db", Labels: map[string]string{"env": "prod"}}
+	if code, res := groupCall(secrets.MetadataHandler(refs), bob, relabel); code != http.StatusOK {
+		t.Fatalf("metadata update failed: %d %+v", code, res)
+	}
+	if m, _ := refs.Store.GetMetadata("bob", "staging/db"); !m.HasLabels(map[string]string{"env": "prod"}) || m.Created.IsZero() {
+		t.Errorf("expected the labels replaced and the times kept, got %+v", m)
+	}
+	bad := set.SetRequest{Key: "prod/x", Value: "v", Labels: map[string]string{"bad key": "v"}}
+	if code, _ := groupCall(write, bob, bad); code != http.StatusBadRequest {
+		t.Errorf("expected an invalid label to be refused, got %d", code)
+	}
+	if code, _ := groupCall(secrets.MetadataHandler(refs), bob, secrets.MetadataRequest{Key: "nope"}); code != http.StatusNotFound {
+		t.Errorf("expected labelling a missing secret to fail, got %d", code)
+	}
+}
+
+func TestStructuredSecrets(t *testing.T) {
+	config := server.DefaultConfig()
+	refs := unsealedRefs(t, config)
+	bob := groupUser(t, refs, "bob")
+	write, read, patch := set.Handler(refs), get.Handler(refs), set.PatchHandler(refs)
+
+	data := json.RawMessage(`{"user":"app","password":"hunter2","port":5432}`)
+	if code, res := groupCall(write, bob, set.SetRequest{Key: "db/prod", Data: data}); code != http.StatusOK {
+		t.Fatalf("set failed: %d %+v", code, res)
+	}
+	if code, res := groupCall(read, bob, get.GetRequest{Key: "db/prod#password"}); code != http.StatusOK || res.Data != "hunter2" {
+		t.Fatalf("expected the password field, got %d %+v", code, res)
+	}
+	if code, res := groupCall(read, bob, get.GetRequest{Key: "db/prod#port"}); code != http.StatusOK || res.Data != float64(5432) {
+		t.Fatalf("expected the port field, got %d %+v", code, res)
+	}
+	if code, _ := groupCall(read, bob, get.GetRequest{Key: "db/prod#missing"}); code != http.StatusNotFound {
+		t.Errorf("expected a missing field to be not found, got %d", code)
+	}
+
+	fields := map[string]json.RawMessage{"password": json.RawMessage(`"s3cret"`), "user": json.RawMessage("null")}
+	if code, res := groupCall(patch, bob, set.PatchRequest{Key: "db/prod", Fields: fields}); code != http.StatusOK {
+		t.Fatalf("patch failed: %d %+v", code, res)
+	}
+	_, res := groupCall(read, bob, get.GetRequest{Key: "db/prod"})
+	if !reflect.DeepEqual(res.Data, map[string]any{"password": "s3cret", "port": float64(5432)}) {
+		t.Errorf("expected the patched object, got %+v", res.Data)
+	}
+
+	for _, bad := range []string{`"just a string"`, `[1,2]`, `null`, `{"a":`} {
+		if code, _ := groupCall(write, bob, set.SetRequest{Key: "db/bad", Data: json.RawMessage(bad)}); code != http.StatusBadRequest {
+			t.Errorf("expected %s to be refused as an object, got %d", bad, code)
+		}
+	}
+	groupCall(write, bob, set.SetRequest{Key: "plain", Value: "text"})
+	if code, _ := groupCall(read, bob, get.GetRequest{Key: "plain#field"}); code != http.StatusBadRequest {
+		t.Errorf("expected a field of a text secret to be refused, got %d", code)
+	}
+	if code, _ := groupCall(patch, bob, set.PatchRequest{Key: "plain", Fields: fields}); code != http.StatusBadRequest {
+		t.Errorf("expected patching a text secret to be refused, got %d", code)
+	}
+
+	// the value is still stored as one sealed blob.
+	cipher, _ := refs.Store.Get("bob", "db/prod")
+	if strings.Contains(string(cipher.Text), "s3cret") {
+		t.Errorf("expected the object to be encrypted")
+	}
+}
+
+func TestReplaceRefusesStaleWrites(t *testing.T) {
+	js := store.NewJSONStore(t.TempDir())
+	js.AddUser("bob", []byte("login"), []byte("salt"))
+	first := store.CipherText{Text: []byte("1")}
+	if err := js.Replace("bob", "k", store.CipherText{}, first, store.Metadata{}); err != nil {
+		t.Fatalf("Replace returned error creating the secret: %v", err)
+	}
+	if err := js.Replace("bob", "k", store.CipherText{}, first, store.Metadata{}); !errors.Is(err, store.ErrSecretChanged) {
+		t.Errorf("expected creating an existing secret to fail, got %v", err)
+	}
+	if err := js.Replace("bob", "k", first, store.CipherText{Text: []byte("2")}, store.Metadata{}); err != nil {
+		t.Errorf("Replace returned error: %v", err)
+	}
+	if err := js.Replace("bob", "k", first, store.CipherText{Text: []byte("3")}, store.Metadata{}); !errors.Is(err, store.ErrSecretChanged) {
+		t.Errorf("expected a replace of a stale value to fail, got %v", err)
+	}
+}
+
+func TestLegacyKeysCanBeMovedAndDeleted(t *testing.T) {
+	refs := unsealedRefs(t, server.DefaultConfig())
+	bob := groupUser(t, refs, "bob")
+	// keys like these were accepted before keys had to be valid paths.
+	for _, key := range []string{"/lead", "a//b", "star*", "trail/"} {
+		refs.Store.Set("bob", key, store.CipherText{Text: []byte(key)}, store.Metadata{})
+	}
+
+	move, del := secrets.MoveHandler(refs), secrets.DeleteHandler(refs)
+	if code, res := groupCall(move, bob, secrets.MoveRequest{From: "/lead", To: "lead"}); code != http.StatusOK || res.Data != float64(1) {
+		t.Fatalf("expected the legacy key to be renamed, got %d %+v", code, res)
+	}
+	if code, _ := groupCall(move, bob, secrets.MoveRequest{From: "trail/", To: "a//c"}); code != http.StatusBadRequest {
+		t.Errorf("expected a move onto an invalid key to be refused, got %d", code)
+	}
+	if code, res := groupCall(move, bob, secrets.MoveRequest{From: "trail/", To: "trail"}); code != http.StatusOK || res.Data != float64(1) {
+		t.Fatalf("expected the key ending in a separator to be renamed, got %d %+v", code, res)
+	}
+	for _, key := range []string{"a//b", "star*"} {
+		if code, res := groupCall(del, bob, secrets.DeleteRequest{Key: key}); code != http.StatusOK {
+			t.Errorf("expected %q to be deleted, got %d %+v", key, code, res)
+		}
+	}
+	if code, _ := groupCall(del, bob, secrets.DeleteRequest{Key: "a//b"}); code != http.StatusBadRequest {
+		t.Errorf("expected an invalid key that is not stored to be refused, got %d", code)
+	}
+	page, _ := refs.Store.List("bob", "", "", 0, nil)
+	if !reflect.DeepEqual(page.Entries, []string{"lead", "trail"}) {
+		t.Errorf("unexpected keys left %v", page.Entries)
+	}
+}
+
+func TestGetFieldSelector(t *testing.T) {
+	refs := unsealedRefs(t, server.DefaultConfig())
+	bob := groupUser(t, refs, "bob")
+	write, read := set.Handler(refs), get.Handler(refs)
+	groupCall(write, bob, set.SetRequest{Key: "api", Data: json.RawMessage(`{"token":"field"}`)})
+	groupCall(write, bob, set.SetRequest{Key: "old", Value: "whole"})
+	// keys holding "#" were stored before it picked a field.
+	cipher, _ := refs.Store.Get("bob", "old")
+	meta, _ := refs.Store.GetMetadata("bob", "old")
+	refs.Store.Set("bob", "api#token", cipher, meta)
+
+	if code, res := groupCall(read, bob, get.GetRequest{Key: "api", Field: "token"}); code != http.StatusOK || res.Data != "field" {
+		t.Fatalf("expected the field named by the field member, got %d %+v", code, res)
+	}
+	if code, res := groupCall(read, bob, get.GetRequest{Key: "api#token"}); code != http.StatusOK || res.Data != "whole" {
+		t.Fatalf("expected the secret stored under the whole key, got %d %+v", code, res)
+	}
+	if code, res := groupCall(read, bob, get.GetRequest{Key: "old#token"}); code != http.StatusBadRequest {
+		t.Fatalf("expected the shorthand to pick a field when no such key is stored, got %d %+v", code, res)
+	}
+}
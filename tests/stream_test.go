@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+var streamKey = []byte("0123456789abcdef0123456789abcdef")
+
+func sealStream(t *testing.T, plain []byte) []byte {
+	t.Helper()
+	var sealed bytes.Buffer
+	w, err := vault.NewStreamWriter(streamKey, &sealed)
+	if err != nil {
+		t.Fatalf("NewStreamWriter returned error: %v", err)
+	}
+	// odd sized writes so chunks don't line up with them.
+	for len(plain) > 0 {
+		n := min(len(plain), 1000)
+		if _, err := w.Write(plain[:n]); err != nil {
+			t.Fatalf("Write returned error: %v", err)
+		}
+		plain = plain[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	return sealed.Bytes()
+}
+
+func openStream(key, sealed []byte) ([]byte, error) {
+	r, err := vault.NewStreamReader(key, bytes.NewReader(sealed))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	chunk := vault.StreamChunkSize
+	for _, size := range []int{0, 1, chunk - 1, chunk, chunk + 1, 3*chunk + 17} {
+		plain, _ := vault.GenerateRandBytes(size)
+		sealed := sealStream(t, plain)
+		got, err := openStream(streamKey, sealed)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("size %d: expected the plaintext back, got %d bytes %v", size, len(got), err)
+		}
+		if size > 16 && bytes.Contains(sealed, plain) {
+			t.Errorf("size %d: expected the plaintext not to appear in the stream", size)
+		}
+	}
+}
+
+func TestStreamDetectsTampering(t *testing.T) {
+	chunk := vault.StreamChunkSize
+	plain, _ := vault.GenerateRandBytes(3*chunk + 17)
+	sealed := sealStream(t, plain)
+	header, sealedChunk := 17, chunk+16
+
+	flipped := bytes.Clone(sealed)
+	flipped[header+sealedChunk+5] ^= 1
+	// dropping whole chunks from the end leaves a stream whose last chunk
+	// wasn't sealed as the last.
+	truncated := sealed[:header+2*sealedChunk]
+	swapped := bytes.Clone(sealed)
+	copy(swapped[header:], sealed[header+sealedChunk:header+2*sealedChunk])
+	copy(swapped[header+sealedChunk:], sealed[header:header+sealedChunk])
+
+	for name, stream := range map[string][]byte{"flipped": flipped, "truncated": truncated, "swapped": swapped} {
+		if _, err := openStream(streamKey, stream); !errors.Is(err, vault.ErrStreamCorrupt) {
+			t.Errorf("%s: expected ErrStreamCorrupt, got %v", name, err)
+		}
+	}
+	if _, err := openStream([]byte("another key of thirty two bytes!"), sealed); !errors.Is(err, vault.ErrStreamCorrupt) {
+		t.Errorf("expected another key to fail, got %v", err)
+	}
+	if _, err := openStream(streamKey, sealed[:header]); !errors.Is(err, vault.ErrStreamCorrupt) {
+		t.Errorf("expected a stream without chunks to fail, got %v", err)
+	}
+	if _, err := openStream(streamKey, append([]byte{9}, sealed[1:]...)); !errors.Is(err, vault.ErrStreamVersion) {
+		t.Errorf("expected an unknown version to fail, got %v", err)
+	}
+}
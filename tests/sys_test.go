@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/audit"
+	"github.com/jdpolicano/govault/internal/server"
+	"github.com/jdpolicano/govault/internal/server/routes/sys"
+	"github.com/jdpolicano/govault/internal/store"
+)
+
+func TestJSONStoreLoad(t *testing.T) {
+	dir := t.TempDir()
+	js := store.NewJSONStore(dir)
+	js.AddUser("bob", []byte("login"), []byte("salt"))
+	js.Set("bob", "key", store.CipherText{Nonce: []byte("n"), Text: []byte("c")}, store.Metadata{})
+	js.SetRole(store.Role{ID: "r1", Owner: "bob"})
+
+	reloaded := store.NewJSONStore(dir)
+	if err := reloaded.Ready(); err != store.ErrNotLoaded {
+		t.Fatalf("expected ErrNotLoaded before Load, got %v", err)
+	}
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if _, ok := reloaded.Get("bob", "key"); !ok {
+		t.Errorf("expected secret to survive a reload")
+	}
+	if role, ok := reloaded.GetRole("r1"); !ok || role.Owner != "bob" {
+		t.Errorf("expected role index to be rebuilt, got %+v %v", role, ok)
+	}
+	if err := reloaded.Ready(); err != nil {
+		t.Errorf("expected loaded store to be ready, got %v", err)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	config := server.DefaultConfig()
+	config.VaultPath = t.TempDir()
+	refs := server.NewServerRefs(config)
+	h := sys.ReadyHandler(refs)
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while sealed, got %d", rec.Code)
+	}
+
+	unseal(t, refs)
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 once unsealed, got %d: %s", rec.Code, rec.Body)
+	}
+
+	refs.Audit, _ = audit.NewAuditor(chainKey, audit.NewSocketSink(filepath.Join(t.TempDir(), "missing.sock")))
+	refs.Audit.Record(audit.Event{Operation: "get"})
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 with every audit sink failing, got %d", rec.Code)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	refs := server.NewServerRefs(server.DefaultConfig())
+	h := sys.StatusHandler(refs)
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/v1/sys/status", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rec.Code)
+	}
+
+	token, _ := refs.Sessions.CreateUserSession("bob", []byte("key"), time.Minute)
+	req := httptest.NewRequest("GET", "/v1/sys/status", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+	h(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var res struct {
+		Data server.Status `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	if res.Data.Version != server.Version || res.Data.Store != "json" || res.Data.Sessions.Total != 1 {
+		t.Errorf("unexpected status %+v", res.Data)
+	}
+}
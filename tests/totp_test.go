@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jdpolicano/govault/internal/server"
+	e "github.com/jdpolicano/govault/internal/server/errors"
+	"github.com/jdpolicano/govault/internal/store"
+	"github.com/jdpolicano/govault/internal/vault"
+)
+
+func TestTOTPCodeVectors(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1, truncated to six digits.
+	secret := []byte("12345678901234567890")
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range cases {
+		if got := vault.TOTPCode(secret, vault.TOTPStep(time.Unix(unix, 0))); got != want {
+			t.Errorf("TOTPCode at %d = %s want %s", unix, got, want)
+		}
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := vault.TOTPURI("govault", "bob", []byte("12345678901234567890"))
+	if !strings.HasPrefix(uri, "otpauth://totp/govault:bob?") || !strings.Contains(uri, "secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ") {
+		t.Errorf("unexpected uri %s", uri)
+	}
+}
+
+func TestSecondFactorLifecycle(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	user := store.NewUser("bob", []byte("login"), []byte("salt"))
+	now := time.Now()
+
+	enrollment, err := server.BeginTOTPEnrollment(&user, key, "govault")
+	if err != nil {
+		t.Fatalf("BeginTOTPEnrollment returned error: %v", err)
+	}
+	if server.HasSecondFactor(user) {
+		t.Fatalf("enrollment should not be active before confirmation")
+	}
+	seed, err := vault.Decrypt(user.TOTP.Seed.Nonce, key, user.TOTP.Seed.Text)
+	if err != nil || vault.EncodeTOTPSecret(seed) != enrollment.Secret {
+		t.Fatalf("seed should be sealed with the vault key")
+	}
+
+	code := vault.TOTPCode(seed, vault.TOTPStep(now))
+	recovery, err := server.ConfirmTOTPEnrollment(&user, key, code, now)
+	if err != nil || len(recovery) == 0 {
+		t.Fatalf("ConfirmTOTPEnrollment failed: %v", err)
+	}
+
+	if err := server.CheckSecondFactor(&user, key, "", now); !errors.Is(err, e.OTPRequired) {
+		t.Errorf("expected a missing code to be required, got %v", err)
+	}
+	if err := server.CheckSecondFactor(&user, key, code, now); !errors.Is(err, e.IncorrectOTP) {
+		t.Errorf("expected a replayed code to be rejected, got %v", err)
+	}
+	next := now.Add(vault.TOTPPeriod * time.Second)
+	if err := server.CheckSecondFactor(&user, key, vault.TOTPCode(seed, vault.TOTPStep(next)), next); err != nil {
+		t.Errorf("expected the next code to be accepted, got %v", err)
+	}
+
+	if err := server.CheckSecondFactor(&user, key, recovery[0], now); err != nil {
+		t.Fatalf("expected recovery code to be accepted, got %v", err)
+	}
+	if err := server.CheckSecondFactor(&user, key, recovery[0], now); !errors.Is(err, e.IncorrectOTP) {
+		t.Errorf("expected recovery code to be single use, got %v", err)
+	}
+	if len(user.TOTP.RecoveryCodes) != len(recovery)-1 {
+		t.Errorf("expected one recovery code to be burnt")
+	}
+}
+
+// enrolledUser adds bob to refs with a confirmed second factor and returns his
+// vault key and recovery codes.
+func enrolledUser(t *testing.T, refs *server.ServerRefs) ([]byte, []string) {
+	t.Helper()
+	key := bytes.Repeat([]byte{1}, 32)
+	refs.Store.AddUser("bob", []byte("login"), []byte("salt"))
+	user, _ := refs.Store.GetUserInfo("bob")
+	enrollment, err := server.BeginTOTPEnrollment(&user, key, "govault")
+	if err != nil {
+		t.Fatalf("BeginTOTPEnrollment returned error: %v", err)
+	}
+	seed, _ := vault.Decrypt(user.TOTP.Seed.Nonce, key, user.TOTP.Seed.Text)
+	if vault.EncodeTOTPSecret(seed) != enrollment.Secret {
+		t.Fatalf("seed should be sealed with the vault key")
+	}
+	now := time.Now()
+	recovery, err := server.ConfirmTOTPEnrollment(&user, key, vault.TOTPCode(seed, vault.TOTPStep(now)), now)
+	if err != nil {
+		t.Fatalf("ConfirmTOTPEnrollment returned error: %v", err)
+	}
+	if err := refs.Store.SwapTOTP("bob", nil, user.TOTP); err != nil {
+		t.Fatalf("SwapTOTP returned error: %v", err)
+	}
+	return key, recovery
+}
+
+func TestRecoveryCodeBurnsOnce(t *testing.T) {
+	refs := unsealedRefs(t, server.DefaultConfig())
+	key, recovery := enrolledUser(t, refs)
+
+	var wg sync.WaitGroup
+	var accepted atomic.Int32
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if refs.BurnSecondFactor("bob", key, recovery[0], time.Now()) == nil {
+				accepted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := accepted.Load(); n != 1 {
+		t.Fatalf("expected a recovery code to be accepted once, got %d", n)
+	}
+	if user, _ := refs.Store.GetUserInfo("bob"); len(user.TOTP.RecoveryCodes) != len(recovery)-1 {
+		t.Fatalf("expected one recovery code to be burnt, %d left", len(user.TOTP.RecoveryCodes))
+	}
+}
+
+func TestStaleUserKeepsBurntCodes(t *testing.T) {
+	refs := unsealedRefs(t, server.DefaultConfig())
+	key, recovery := enrolledUser(t, refs)
+
+	stale, _ := refs.Store.GetUserInfo("bob")
+	if err := server.CheckSecondFactor(&stale, key, recovery[1], time.Now()); err != nil {
+		t.Fatalf("CheckSecondFactor returned error: %v", err)
+	}
+	if user, _ := refs.Store.GetUserInfo("bob"); len(user.TOTP.RecoveryCodes) != len(recovery) {
+		t.Fatalf("expected checking a copy to leave the stored enrollment alone")
+	}
+
+	if err := refs.BurnSecondFactor("bob", key, recovery[0], time.Now()); err != nil {
+		t.Fatalf("BurnSecondFactor returned error: %v", err)
+	}
+	stale.Disabled = true
+	if err := refs.Store.UpdateUser(stale); err != nil {
+		t.Fatalf("UpdateUser returned error: %v", err)
+	}
+	if err := refs.BurnSecondFactor("bob", key, recovery[0], time.Now()); !errors.Is(err, e.IncorrectOTP) {
+		t.Fatalf("expected a stale update not to bring back a burnt code, got %v", err)
+	}
+	if err := refs.Store.SwapTOTP("bob", stale.TOTP, nil); !errors.Is(err, store.ErrTOTPChanged) {
+		t.Fatalf("expected swapping out a stale enrollment to fail, got %v", err)
+	}
+}
+
+func TestNeedsEnrollment(t *testing.T) {
+	user := store.NewUser("bob", nil, nil)
+	if !server.NeedsEnrollment(server.TOTPRequired, user) {
+		t.Errorf("required policy should demand enrollment")
+	}
+	if server.NeedsEnrollment(server.TOTPOptional, user) {
+		t.Errorf("optional policy should not demand enrollment")
+	}
+}